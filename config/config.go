@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync/atomic"
 )
 
 // Configuration stores DAS configuration parameters
@@ -44,10 +45,37 @@ type Configuration struct {
 	UseDNSCache           bool     `json:"useDNSCache"`           // use DNS Cache
 	AuthDN                bool     `json:"authDN"`                // user user DN authentication
 	KeepAlive             bool     `json:"keepAlive"`             // use keep-alive HTTP header
+	AdminDNs              []string `json:"adminDNs"`              // list of user DNs allowed to use admin APIs
+	LineageDepth          int      `json:"lineageDepth"`          // maximum depth of lineage graphs
+	BulkParallel          int      `json:"bulkParallel"`          // number of bulk job queries processed in parallel
+	MaxArraySize          int      `json:"maxArraySize"`          // maximum number of values in DAS query array
+	WarmInterval          int      `json:"warmInterval"`          // interval in seconds of cache warming scheduler, 0 disables it
+	WarmLead              int      `json:"warmLead"`              // seconds before expiration when warm queries are refreshed
+	WarmQueries           []string `json:"warmQueries"`           // list of DAS queries to keep warm
+	WarmTop               int      `json:"warmTop"`               // number of most popular queries to keep warm
+	WarmMinHits           int      `json:"warmMinHits"`           // minimum number of recent requests of popular query
+	WarmBudget            int      `json:"warmBudget"`            // maximum number of refreshes per scheduler run
+	StaleMaxAge           int      `json:"staleMaxAge"`           // seconds after expiration expired records are served while refreshed, 0 disables it
+	SweepInterval         int      `json:"sweepInterval"`         // interval in seconds of DAS cache sweeper, default 600, negative value disables it
+	CacheMaxSize          int      `json:"cacheMaxSize"`          // maximum size of DAS cache in bytes, 0 means no limit
 }
 
-// Config variable represents configuration object
-var Config Configuration
+// current configuration, it is replaced atomically upon reload
+var _config atomic.Pointer[Configuration]
+
+// Current returns current configuration, returned configuration is shared
+// among all readers and should not be modified
+func Current() *Configuration {
+	if config := _config.Load(); config != nil {
+		return config
+	}
+	return &Configuration{}
+}
+
+// Publish replaces current configuration with given one
+func Publish(config Configuration) {
+	_config.Store(&config)
+}
 
 // String returns string representation of DAS Config
 func (c *Configuration) String() string {
@@ -56,25 +84,94 @@ func (c *Configuration) String() string {
 
 // ParseConfig parse given config file
 func ParseConfig(configFile string) error {
+	config, err := ReadConfig(configFile)
+	Publish(config)
+	return err
+}
+
+// ReadConfig reads and validates given config file without changing Config
+func ReadConfig(configFile string) (Configuration, error) {
+	var config Configuration
 	data, err := os.ReadFile(configFile)
 	if err != nil {
 		log.Printf("Unable to read: file %s, error %v\n", configFile, err)
-		return err
+		return config, err
 	}
-	err = json.Unmarshal(data, &Config)
+	err = json.Unmarshal(data, &config)
 	if err != nil {
 		log.Printf("Unable to parse: file %s, error %v\n", configFile, err)
-		return err
+		return config, err
 	}
-	if Config.Frontend == "" {
+	if config.Frontend == "" {
 		log.Printf("The frontend record is not set: file %s, error %v\n", configFile, err)
-		return errors.New("No frontend record found in config")
+		return config, errors.New("No frontend record found in config")
+	}
+	if config.TLSCertsRenewInterval == 0 {
+		config.TLSCertsRenewInterval = 600
 	}
-	if Config.TLSCertsRenewInterval == 0 {
-		Config.TLSCertsRenewInterval = 600
+	if config.RucioUrl == "" {
+		config.RucioUrl = "https://cms-rucio.cern.ch"
 	}
-	if Config.RucioUrl == "" {
-		Config.RucioUrl = "https://cms-rucio.cern.ch"
+	return config, nil
+}
+
+// RestartKeys returns list of configuration keys which differ between
+// given configurations but can not be changed without server restart
+func RestartKeys(old, new Configuration) []string {
+	var out []string
+	check := func(key string, changed bool) {
+		if changed {
+			out = append(out, key)
+		}
 	}
-	return nil
+	check("port", old.Port != new.Port)
+	check("uri", old.Uri != new.Uri)
+	check("base", old.Base != new.Base)
+	check("jscripts", old.Jscripts != new.Jscripts)
+	check("images", old.Images != new.Images)
+	check("styles", old.Styles != new.Styles)
+	check("hkey", old.Hkey != new.Hkey)
+	check("serverkey", old.ServerKey != new.ServerKey)
+	check("servercrt", old.ServerCrt != new.ServerCrt)
+	check("profileFile", old.ProfileFile != new.ProfileFile)
+	check("logFile", old.LogFile != new.LogFile)
+	check("useDNSCache", old.UseDNSCache != new.UseDNSCache)
+	check("authDN", old.AuthDN != new.AuthDN)
+	check("keepAlive", old.KeepAlive != new.KeepAlive)
+	check("tlsCertsRenewInterval", old.TLSCertsRenewInterval != new.TLSCertsRenewInterval)
+	check("rucioTokenCurl", old.RucioTokenCurl != new.RucioTokenCurl)
+	return out
+}
+
+// Reload returns new configuration where only settings which can be changed
+// at run time are taken from given configuration
+func Reload(old, new Configuration) Configuration {
+	config := old
+	config.Services = new.Services
+	config.UrlQueueLimit = new.UrlQueueLimit
+	config.UrlRetry = new.UrlRetry
+	config.Templates = new.Templates
+	config.DbsInstances = new.DbsInstances
+	config.Views = new.Views
+	config.Verbose = new.Verbose
+	config.DasMaps = new.DasMaps
+	config.DasExamples = new.DasExamples
+	config.UpdateDNs = new.UpdateDNs
+	config.Timeout = new.Timeout
+	config.Frontend = new.Frontend
+	config.RucioUrl = new.RucioUrl
+	config.AdminDNs = new.AdminDNs
+	config.LineageDepth = new.LineageDepth
+	config.BulkParallel = new.BulkParallel
+	config.MaxArraySize = new.MaxArraySize
+	config.WarmInterval = new.WarmInterval
+	config.WarmLead = new.WarmLead
+	config.WarmQueries = new.WarmQueries
+	config.WarmTop = new.WarmTop
+	config.WarmMinHits = new.WarmMinHits
+	config.WarmBudget = new.WarmBudget
+	config.StaleMaxAge = new.StaleMaxAge
+	config.SweepInterval = new.SweepInterval
+	config.CacheMaxSize = new.CacheMaxSize
+	return config
 }
@@ -0,0 +1,192 @@
+package das
+
+// DAS cache module, it lists DAS queries stored in DAS cache, invalidates
+// them and provides DAS cache statistics
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmwm/das2go/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CacheEntry represents DAS query stored in DAS cache
+type CacheEntry struct {
+	Qhash     string   `json:"qhash"`     // DAS query hash
+	Query     string   `json:"query"`     // DAS query
+	Instance  string   `json:"instance"`  // DBS instance of the query
+	Status    string   `json:"status"`    // DAS query status
+	Records   int      `json:"nrecords"`  // number of merged records
+	Bytes     int      `json:"bytes"`     // estimated size of merged records
+	Expire    int64    `json:"expire"`    // expire timestamp of the query
+	Timestamp int64    `json:"timestamp"` // time when query was requested
+	Access    int64    `json:"access"`    // time when query records were last accessed
+	Services  []string `json:"services"`  // services used by the query
+}
+
+// CacheFilter selects DAS queries in DAS cache
+type CacheFilter struct {
+	Qhash    string `json:"qhash"`    // DAS query hash
+	Pattern  string `json:"pattern"`  // regular expression to match DAS query
+	Service  string `json:"service"`  // system, e.g. dbs3, or system:urn used by the query
+	Instance string `json:"instance"` // DBS instance of the query
+}
+
+// CacheStatistics represents aggregated statistics of DAS cache
+type CacheStatistics struct {
+	Queries      int            `json:"queries"`       // number of cached queries
+	Expired      int            `json:"expired"`       // number of expired queries
+	CacheRecords int            `json:"cache_records"` // number of records in das.cache collection
+	MergeRecords int            `json:"merge_records"` // number of records in das.merge collection
+	CacheBytes   int            `json:"cache_bytes"`   // size of das.cache collection
+	MergeBytes   int            `json:"merge_bytes"`   // size of das.merge collection
+	Status       map[string]int `json:"status"`        // number of queries per status
+	Services     map[string]int `json:"services"`      // number of queries per service
+	Instances    map[string]int `json:"instances"`     // number of queries per DBS instance
+	Evictions    EvictionStats  `json:"evictions"`     // eviction metrics of DAS cache sweeper
+}
+
+// Empty reports if filter does not select any particular query
+func (f CacheFilter) Empty() bool {
+	return f.Qhash == "" && f.Pattern == "" && f.Service == "" && f.Instance == ""
+}
+
+// helper function to check if any of given services matches service filter,
+// filter without urn matches all APIs of the system
+func matchService(service string, services []string) bool {
+	for _, srv := range services {
+		if srv == service || strings.HasPrefix(srv, service+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to convert DAS record into cache entry
+func cacheEntry(rec mongo.DASRecord) CacheEntry {
+	entry := CacheEntry{}
+	entry.Qhash, _ = rec["qhash"].(string)
+	entry.Query, _ = rec["query"].(string)
+	entry.Instance, _ = mongo.GetStringValue(rec, "das.instance")
+	entry.Status, _ = mongo.GetStringValue(rec, "das.status")
+	entry.Expire, _ = mongo.GetInt64Value(rec, "das.expire")
+	entry.Timestamp, _ = mongo.GetInt64Value(rec, "das.ts")
+	if das, ok := rec["das"].(mongo.DASRecord); ok {
+		if srvs, ok := das["services"].([]interface{}); ok {
+			for _, srv := range srvs {
+				entry.Services = append(entry.Services, fmt.Sprintf("%v", srv))
+			}
+		}
+	}
+	return entry
+}
+
+// FilterCacheEntries returns cache entries matching given filter
+func FilterCacheEntries(entries []CacheEntry, filter CacheFilter) ([]CacheEntry, error) {
+	var pat *regexp.Regexp
+	if filter.Pattern != "" {
+		var err error
+		if pat, err = regexp.Compile(filter.Pattern); err != nil {
+			return nil, err
+		}
+	}
+	var out []CacheEntry
+	for _, entry := range entries {
+		if filter.Qhash != "" && entry.Qhash != filter.Qhash {
+			continue
+		}
+		if filter.Instance != "" && entry.Instance != filter.Instance {
+			continue
+		}
+		if filter.Service != "" && !matchService(filter.Service, entry.Services) {
+			continue
+		}
+		if pat != nil && !pat.MatchString(entry.Query) {
+			continue
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// helper function to get DAS records of all cached queries
+func cacheEntries() []CacheEntry {
+	var out []CacheEntry
+	spec := bson.M{"das.record": 0}
+	for _, rec := range mongo.Get("das", "cache", spec, 0, -1) {
+		out = append(out, cacheEntry(rec))
+	}
+	return out
+}
+
+// CacheEntries returns DAS queries from DAS cache matching given filter,
+// queries are ordered by their request time, the most recent first
+func CacheEntries(filter CacheFilter) ([]CacheEntry, error) {
+	entries, err := FilterCacheEntries(cacheEntries(), filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Records = Count(entries[i].Qhash)
+		entries[i].Bytes = Bytes(entries[i].Qhash)
+		entries[i].Access = Access(entries[i].Qhash)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp > entries[j].Timestamp
+	})
+	return entries, nil
+}
+
+// InvalidateCache removes DAS queries matching given filter from DAS cache,
+// it returns number of removed queries. Empty filter is not allowed.
+func InvalidateCache(filter CacheFilter) (int, error) {
+	if filter.Empty() {
+		return 0, errors.New("empty cache filter")
+	}
+	entries, err := FilterCacheEntries(cacheEntries(), filter)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		RemoveRecords(entry.Qhash)
+	}
+	return len(entries), nil
+}
+
+// CacheStats returns aggregated statistics of DAS cache
+func CacheStats() CacheStatistics {
+	stats := CacheStatistics{
+		Status:    make(map[string]int),
+		Services:  make(map[string]int),
+		Instances: make(map[string]int),
+	}
+	now := time.Now().Unix()
+	for _, entry := range cacheEntries() {
+		stats.Queries += 1
+		if entry.Expire < now {
+			stats.Expired += 1
+		}
+		stats.Status[entry.Status] += 1
+		stats.Instances[entry.Instance] += 1
+		systems := make(map[string]bool)
+		for _, srv := range entry.Services {
+			systems[strings.Split(srv, ":")[0]] = true
+		}
+		for system := range systems {
+			stats.Services[system] += 1
+		}
+	}
+	stats.CacheRecords = mongo.Count("das", "cache", bson.M{})
+	stats.MergeRecords = mongo.Count("das", "merge", bson.M{})
+	stats.CacheBytes = mongo.Size("das", "cache")
+	stats.MergeBytes = mongo.Size("das", "merge")
+	stats.Evictions = Evictions()
+	return stats
+}
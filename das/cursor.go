@@ -0,0 +1,332 @@
+package das
+
+// DAS cursor module, it provides stable pagination of DAS records. Cursor
+// keeps position of boundary record of the page, its _id and sort values,
+// and it is passed to clients as opaque string.
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Cursor represents position of page of DAS records
+type Cursor struct {
+	Pid    string        `json:"q"`           // DAS query hash
+	Filter string        `json:"f,omitempty"` // hash of DAS query filters, e.g. sort and grep
+	Id     string        `json:"i,omitempty"` // _id of boundary record
+	Values []interface{} `json:"v,omitempty"` // sort values of boundary record
+	Index  int           `json:"n"`           // index of first record of the page
+	Back   bool          `json:"b,omitempty"` // page contains records preceding boundary record
+}
+
+// Page represents page of DAS records along with cursors of adjacent pages
+type Page struct {
+	Index int    `json:"idx"`            // index of first record of the page
+	Next  string `json:"next,omitempty"` // cursor of next page
+	Prev  string `json:"prev,omitempty"` // cursor of previous page
+}
+
+// Encode returns opaque string representation of the cursor
+func (c *Cursor) Encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// helper function to return hash of filters of DAS query, cursors are bound
+// to them since sort values of boundary record depend on sort keys
+func filterHash(dasquery dasql.DASQuery) string {
+	if len(dasquery.Filters) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(dasquery.Filters)
+	if err != nil {
+		return ""
+	}
+	arr := md5.Sum(data)
+	return hex.EncodeToString(arr[:8])
+}
+
+// helper function to create cursor of given DAS query
+func newCursor(dasquery dasql.DASQuery, idx int, back bool) Cursor {
+	if idx < 0 {
+		idx = 0
+	}
+	return Cursor{Pid: dasquery.Qhash, Filter: filterHash(dasquery), Index: idx, Back: back}
+}
+
+// DecodeCursor decodes cursor of given DAS query, cursor should be issued for
+// the same query and the same filters
+func DecodeCursor(dasquery dasql.DASQuery, cursor string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Pid != dasquery.Qhash {
+		return nil, errors.New("cursor does not belong to DAS query")
+	}
+	if c.Filter != filterHash(dasquery) {
+		return nil, errors.New("cursor does not belong to filters of DAS query")
+	}
+	if c.Id != "" && !bson.IsObjectIdHex(c.Id) {
+		return nil, fmt.Errorf("invalid cursor record id %s", c.Id)
+	}
+	return &c, nil
+}
+
+// LastCursor returns cursor of the last page of DAS query records
+func LastCursor(dasquery dasql.DASQuery, nres, limit int) string {
+	c := newCursor(dasquery, nres-limit, true)
+	return c.Encode()
+}
+
+// helper function to create cursor with given boundary record
+func recordCursor(dasquery dasql.DASQuery, rec mongo.DASRecord, skeys []SortKey, idx int, back bool) string {
+	c := newCursor(dasquery, idx, back)
+	if oid, ok := rec["_id"].(bson.ObjectId); ok {
+		c.Id = oid.Hex()
+	}
+	for _, skey := range skeys {
+		c.Values = append(c.Values, sortValue(rec, skey.Key))
+	}
+	return c.Encode()
+}
+
+// PageCursors returns cursors of pages adjacent to given page of DAS records
+// which starts at given index, the full page is assumed to have next one
+func PageCursors(dasquery dasql.DASQuery, data []mongo.DASRecord, idx, limit int) Page {
+	page := Page{Index: idx}
+	if len(data) == 0 || limit <= 0 || len(dasquery.Aggregators) > 0 {
+		return page
+	}
+	skeys := ParseSortKeys(dasquery.Filters["sort"])
+	if len(data) == limit {
+		page.Next = recordCursor(dasquery, data[len(data)-1], skeys, idx+len(data), false)
+	}
+	if idx > 0 {
+		page.Prev = recordCursor(dasquery, data[0], skeys, idx-limit, true)
+	}
+	return page
+}
+
+// helper function to compare DAS record with boundary record of the cursor,
+// records are compared by sort values and then by their _id
+func compareCursor(rec mongo.DASRecord, skeys []SortKey, c *Cursor) int {
+	for i, skey := range skeys {
+		var val interface{}
+		if i < len(c.Values) {
+			val = c.Values[i]
+		}
+		if res := compareSortValues(sortValue(rec, skey.Key), val, skey); res != 0 {
+			return res
+		}
+	}
+	oid, _ := rec["_id"].(bson.ObjectId)
+	return strings.Compare(oid.Hex(), c.Id)
+}
+
+// helper function to find position of cursor boundary record in sorted DAS
+// records, it returns index of the boundary record and index of the first
+// record which follows it. The boundary record is located by its _id or by
+// its sort values if it no longer exists.
+func cursorPosition(data []mongo.DASRecord, skeys []SortKey, c *Cursor) (int, int) {
+	for i, rec := range data {
+		if oid, ok := rec["_id"].(bson.ObjectId); ok && oid.Hex() == c.Id {
+			return i, i + 1
+		}
+	}
+	for i, rec := range data {
+		if compareCursor(rec, skeys, c) > 0 {
+			return i, i
+		}
+	}
+	return len(data), len(data)
+}
+
+// CursorPage returns page of sorted DAS records for given cursor, it also
+// reports if there are more records beyond the page in cursor direction
+func CursorPage(data []mongo.DASRecord, skeys []SortKey, c *Cursor, limit int) ([]mongo.DASRecord, bool) {
+	if c.Back {
+		end := len(data)
+		if c.Id != "" {
+			end, _ = cursorPosition(data, skeys, c)
+		}
+		start := end - limit
+		if start < 0 {
+			start = 0
+		}
+		return data[start:end], start > 0
+	}
+	start := 0
+	if c.Id != "" {
+		_, start = cursorPosition(data, skeys, c)
+	}
+	end := start + limit
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[start:end], end < len(data)
+}
+
+// helper function to fetch page of unsorted DAS records for given cursor, it
+// uses range look-up over _id of records
+func idPage(coll string, spec bson.M, fields []string, c *Cursor, limit int) ([]mongo.DASRecord, bool) {
+	order, oper := "_id", "$gt"
+	if c.Back {
+		order, oper = "-_id", "$lt"
+	}
+	if c.Id != "" {
+		spec["_id"] = bson.M{oper: bson.ObjectIdHex(c.Id)}
+	}
+	data := mongo.GetPage("das", coll, spec, fields, []string{order}, limit+1)
+	more := len(data) > limit
+	if more {
+		data = data[:limit]
+	}
+	if c.Back {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+	return data, more
+}
+
+// CursorSpec returns look-up spec of DAS records which follow (or precede)
+// boundary record of given cursor in order of given sort keys, records with
+// the same sort values are ordered by their _id
+func CursorSpec(skeys []SortKey, c *Cursor) bson.M {
+	var conds []bson.M
+	equal := bson.M{}
+	for i, skey := range skeys {
+		var val interface{}
+		if i < len(c.Values) {
+			val = c.Values[i]
+		}
+		oper := "$gt"
+		if skey.Descending != c.Back {
+			oper = "$lt"
+		}
+		cond := bson.M{skey.Key: bson.M{oper: val}}
+		for key, v := range equal {
+			cond[key] = v
+		}
+		conds = append(conds, cond)
+		equal[skey.Key] = val
+	}
+	oper := "$gt"
+	if c.Back {
+		oper = "$lt"
+	}
+	cond := bson.M{"_id": bson.M{oper: bson.ObjectIdHex(c.Id)}}
+	for key, v := range equal {
+		cond[key] = v
+	}
+	return bson.M{"$or": append(conds, cond)}
+}
+
+// helper function to fetch page of DAS records sorted by MongoDB for given
+// cursor, it uses range look-up over sort values and _id of records
+func sortedPage(coll string, spec bson.M, fields []string, skeys []SortKey, c *Cursor, limit int) ([]mongo.DASRecord, bool) {
+	order := MongoSortKeys(skeys)
+	if c.Back {
+		for i, key := range order {
+			if strings.HasPrefix(key, "-") {
+				order[i] = key[1:]
+			} else {
+				order[i] = "-" + key
+			}
+		}
+	}
+	if c.Id != "" {
+		spec = bson.M{"$and": []bson.M{spec, CursorSpec(skeys, c)}}
+	}
+	data := mongo.GetPage("das", coll, spec, fields, order, limit+1)
+	more := len(data) > limit
+	if more {
+		data = data[:limit]
+	}
+	if c.Back {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+	return data, more
+}
+
+// GetDataCursor returns page of DAS records which follows (or precedes)
+// position of given cursor, empty cursor refers to the first page. Unlike
+// index based pagination of GetData, pages remain stable when DAS records
+// are added or removed.
+func GetDataCursor(dasquery dasql.DASQuery, coll, cursor string, limit int) (string, []mongo.DASRecord, Page) {
+
+	// defer function profiler
+	defer utils.MeasureTime("das/GetDataCursor")()
+
+	var page Page
+	if len(dasquery.Aggregators) > 0 || limit <= 0 {
+		status, data := GetData(dasquery, coll, 0, -1)
+		return status, data, page
+	}
+	pid := dasquery.Qhash
+	c := &Cursor{Pid: pid}
+	if cursor != "" {
+		var err error
+		if c, err = DecodeCursor(dasquery, cursor); err != nil {
+			return fmt.Sprintf("ERROR invalid cursor: %v\n", err), []mongo.DASRecord{}, page
+		}
+	}
+	spec, fields, skeys := dataSpec(dasquery)
+	var data []mongo.DASRecord
+	var more bool
+	if len(skeys) > 0 && querySortable(dasquery, coll, spec, skeys) {
+		data, more = sortedPage(coll, spec, fields, skeys, c, limit)
+	} else if len(skeys) > 0 {
+		// values of sort keys are compared as numbers or sizes, therefore we
+		// sort all records ourselves. Records are fetched in _id order which is
+		// used to break ties of sort values.
+		records := mongo.GetPage("das", coll, spec, fields, []string{"_id"}, -1)
+		data, more = CursorPage(SortRecords(records, skeys), skeys, c, limit)
+	} else {
+		data, more = idPage(coll, spec, fields, c, limit)
+	}
+	page.Index = c.Index
+	hasNext, hasPrev := more, c.Index > 0
+	if c.Back {
+		if !more {
+			page.Index = 0
+		}
+		hasNext, hasPrev = c.Id != "", more
+	}
+	if len(data) > 0 {
+		if hasNext {
+			page.Next = recordCursor(dasquery, data[len(data)-1], skeys, page.Index+len(data), false)
+		}
+		if hasPrev {
+			page.Prev = recordCursor(dasquery, data[0], skeys, page.Index-limit, true)
+		}
+	}
+	status := dataStatus(pid)
+	if strings.HasPrefix(status, "ERROR") {
+		return status, []mongo.DASRecord{}, Page{}
+	}
+	touch(pid)
+	return status, data, page
+}
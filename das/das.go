@@ -8,11 +8,8 @@ package das
 import (
 	"fmt"
 	"log"
-	"net/url"
-	"reflect"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dmwm/das2go/dasmaps"
@@ -43,362 +40,6 @@ func (r *DASRecord) Services() []string {
 	return []string{}
 }
 
-// Extract API call parameters from das map entry
-func getApiParams(dasmap mongo.DASRecord) (string, string, string, string) {
-	dasKey, ok := dasmap["das_key"].(string)
-	if !ok {
-		dasKey = ""
-	}
-	recKey, ok := dasmap["rec_key"].(string)
-	if !ok {
-		recKey = ""
-	}
-	apiArg, ok := dasmap["api_arg"].(string)
-	if !ok {
-		apiArg = ""
-	}
-	pattern, ok := dasmap["pattern"].(string)
-	if !ok {
-		pattern = ""
-	}
-	return dasKey, recKey, apiArg, pattern
-}
-
-// helper function to fix DBS instance in provided base string
-func fixDBSinstance(dbsInst, base string) string {
-	if strings.Contains(base, "http") && dbsInst != "" && len(dbsInst) > 0 && dbsInst != "prod/global" {
-		// we only have prod, int, dev DBSes
-		// all DAS DBS maps contain only URLs with global DBS instance
-		// therefore we'll replace xxx/global to provided dbsInst
-		defInstances := []string{"prod/global", "int/global", "dev/global"}
-		for _, i := range defInstances {
-			if strings.Contains(base, i) {
-				base = strings.Replace(base, i, dbsInst, -1)
-			}
-		}
-	}
-	return base
-}
-
-// FormUrlCall forms appropriate URL from given dasquery and dasmap, the final URL
-// contains all parameters
-func FormUrlCall(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string {
-
-	// defer function profiler
-	defer utils.MeasureTime("das/FormUrlCall")()
-
-	vals := url.Values{}
-	spec := dasquery.Spec
-	skeys := utils.MapKeys(spec)
-	base, ok := dasmap["url"].(string)
-	system, _ := dasmap["system"].(string)
-	// Adjust DBS URL wrt dbs instance name from query
-	if system == "dbs" || system == "dbs3" {
-		// adjust dbs instance in our base url
-		base = fixDBSinstance(dasquery.Instance, base)
-		// adjust APIs with 'run between' clause
-		if utils.InList("run", skeys) {
-			val := spec["run"]
-			if strings.Contains(dasquery.Query, "between") {
-				var minr, maxr, run string
-				switch runs := val.(type) {
-				case []string:
-					minr = runs[0]
-					maxr = runs[len(runs)-1]
-					run = fmt.Sprintf("\"%s-%s\"", minr, maxr)
-					vals.Add("run_num", run)
-				case string:
-					vals.Add("run_num", runs)
-				}
-			} else if strings.Contains(dasquery.Query, "in") && utils.InList("run", skeys) {
-				switch runs := val.(type) {
-				case []string:
-					for _, r := range runs {
-						vals.Add("run_num", r)
-					}
-				case string:
-					vals.Add("run_num", runs)
-				}
-			}
-		}
-		// return only valid files by default
-		if strings.Contains(base, "file") && !utils.InList("status", skeys) {
-			// do not use valid files for filechildren/fileparents
-			if !strings.Contains(base, "filechildren") && !strings.Contains(base, "fileparents") {
-				if _, ok := vals["validFileOnly"]; !ok {
-					vals.Add("validFileOnly", "1")
-				}
-			}
-			// for files API when file is used as parameter we look-up file regardless of its validity
-			fields := dasquery.Fields
-			if len(skeys) == 1 && skeys[0] == "file" && len(fields) == 1 && fields[0] == "file" {
-				vals.Del("validFileOnly")
-			}
-		}
-	}
-	if system == "phedex" {
-		if v, ok := spec["site"]; ok {
-			val := v.(string)
-			if !strings.Contains(val, "*") {
-				spec["site"] = fmt.Sprintf("%s*", val)
-			}
-		}
-	}
-	if system == "sitedb2" {
-		// all sitedb apis is better to treat as local APIs, since
-		// they don't really accept parameters. Instead, we'll use local
-		// APIs to fetch all data and match records with given parameters
-		return "local_api"
-	}
-	if system == "cric" {
-		// all cric apis is better to treat as local APIs, since
-		// they don't really accept parameters. Instead, we'll use local
-		// APIs to fetch all data and match records with given parameters
-		return "local_api"
-	}
-	if !strings.HasPrefix(base, "http") {
-		return "local_api"
-	}
-	// Exception block, current DAS maps contains APIs which should be treated
-	// as local apis, e.g. file_run_lumi4dataset in DBS3 maps. In a future
-	// I'll need to fix DBS3 maps to make it local_api
-	// For time being I'll list those exceptional APIs in DASLocalAPIs list
-	urn, _ := dasmap["urn"].(string)
-	if utils.InList(urn, services.DASLocalAPIs()) {
-		return "local_api"
-	}
-	// TMP, until we change phedex maps to use JSON
-	if strings.Contains(base, "phedex") {
-		base = strings.Replace(base, "xml", "json", -1)
-	}
-	if !ok {
-		log.Println("Unable to extract url from DAS map", dasmap)
-	}
-	dasmaps := dasmaps.GetDASMaps(dasmap["das_map"])
-	var useArgs []string
-	for _, dmap := range dasmaps {
-		dkey, rkey, arg, pat := getApiParams(dmap)
-		if utils.InList(dkey, skeys) {
-			val, ok := spec[dkey].(string)
-			if ok {
-				matched, _ := regexp.MatchString(pat, val)
-				if matched || pat == "" {
-					// exception for lumi_list input parameter, files DBS3 API accept only lists of lumis
-					if system == "dbs3" && arg == "lumi_list" {
-						vals.Add(arg, fmt.Sprintf("[%s]", val))
-					} else if system == "dbs3" && arg == "validFileOnly" {
-						v := strings.Replace(val, "*", "", -1)
-						if strings.ToLower(v) == "valid" {
-							delete(vals, "validFileOnly")
-							vals.Add("validFileOnly", "1")
-						} else {
-							delete(vals, "validFileOnly")
-							vals.Add("validFileOnly", "0")
-						}
-					} else if system == "dbs3" && arg == "status" {
-						// This may need revision, probably better to properly
-						// adjust DAS maps
-						if strings.ToLower(val) == "valid" {
-							delete(vals, "validFileOnly")
-							vals.Add("validFileOnly", "1")
-						} else {
-							delete(vals, "validFileOnly")
-							vals.Add("validFileOnly", "0")
-						}
-					} else if system == "dbs3" && arg == "min_cdate" {
-						vals.Add(arg, fmt.Sprintf("%d", utils.UnixTime(val)))
-						maxd := utils.UnixTime(val) + 24*60*60
-						vals.Add("max_cdate", fmt.Sprintf("%d", maxd))
-					} else if system == "dbs3" && arg == "cdate" {
-						vals.Add("min_cdate", fmt.Sprintf("%d", utils.UnixTime(val)))
-						maxd := utils.UnixTime(val) + 24*60*60
-						vals.Add("max_cdate", fmt.Sprintf("%d", maxd))
-					} else if dkey == "date" && system == "conddb" {
-						vals.Add("startTime", utils.ConddbTime(val))
-						eval := utils.Unix2DASTime(utils.UnixTime(val) + 37*3660)
-						vals.Add("endTime", utils.ConddbTime(eval))
-						useArgs = append(useArgs, arg)
-					} else {
-						if vvv, ok := vals[arg]; ok {
-							if !utils.InList(val, vvv) {
-								vals.Add(arg, val)
-							}
-						} else {
-							vals.Add(arg, val)
-						}
-					}
-					useArgs = append(useArgs, arg)
-				}
-			} else { // let's try array of strings
-				arr, ok := spec[dkey].([]string)
-				if system == "dbs3" && arg == "run_num" { // we already changed runs parameters above for DBS call
-					continue
-				}
-				if !ok {
-					fmt.Println("WARNING, unable to get value(s) for daskey=", dkey,
-						", reckey=", rkey, " from spec=", spec, " das map=", dmap)
-				}
-				if dkey == "date" && system == "dbs3" {
-					vals.Add("min_cdate", fmt.Sprintf("%d", utils.UnixTime(arr[0])))
-					vals.Add("max_cdate", fmt.Sprintf("%d", utils.UnixTime(arr[1])))
-					useArgs = append(useArgs, arg)
-				} else if dkey == "date" && system == "dashboard" {
-					vals.Add("date1", utils.DashboardTime(arr[0]))
-					vals.Add("date2", utils.DashboardTime(arr[1]))
-					useArgs = append(useArgs, arg)
-				} else if dkey == "date" && system == "conddb" {
-					vals.Add("startTime", utils.ConddbTime(arr[0]))
-					vals.Add("endTime", utils.ConddbTime(arr[1]))
-					useArgs = append(useArgs, arg)
-				} else if system == "conddb" && arg == "Runs" {
-					if len(arr) > 0 {
-						vals.Add(arg, strings.Join(arr, ","))
-						useArgs = append(useArgs, arg)
-					}
-				} else {
-					for _, val := range arr {
-						matched, _ := regexp.MatchString(pat, val)
-						if matched || pat == "" {
-							vals.Add(arg, val)
-							useArgs = append(useArgs, arg)
-						}
-					}
-				}
-			}
-		}
-	}
-	// loop over params in DAS maps and add additional arguments which have
-	// non empty, non optional and non required values
-	skipList := []string{"optional", "required"}
-	params := mongo.Convert2DASRecord(dasmap["params"])
-	for key, val := range params {
-		switch v := val.(type) {
-		case string:
-			// speed-up query by NOT fetching details
-			if system == "dbs3" && key == "detail" {
-				if utils.WEBSERVER == 0 {
-					if urn == "file4DatasetRunLumi" || urn == "files_via_block" {
-						v = "False"
-					}
-				}
-			}
-			vvv := v
-			if !utils.InList(key, useArgs) && !utils.InList(vvv, skipList) && vvv != "*" {
-				if _, ok := vals[key]; !ok {
-					vals.Add(key, vvv)
-				}
-			}
-		case []interface{}:
-			for _, value := range v {
-				vvv := fmt.Sprintf("%s", value)
-				if !utils.InList(key, useArgs) && !utils.InList(vvv, skipList) && vvv != "*" {
-					if _, ok := vals[key]; !ok {
-						vals.Add(key, vvv)
-					}
-				}
-			}
-		}
-	}
-
-	// TMP: exception, DAS maps use jobsummary-plot-or-table dashboard api, while we need
-	// jobsummary-plot-or-table2 which returns JSON
-	if strings.HasSuffix(base, "jobsummary-plot-or-table") {
-		base += "2" // add 2 at the end
-	}
-
-	// adjust datasets API to look-up all datasets regardless of their status
-	// if dataset name is provided
-	if system == "dbs3" && urn == "datasets" {
-		val, ok := spec["dataset"].(string)
-		if ok && !strings.Contains(val, "*") {
-			if _, ok := spec["status"]; !ok { // only if user didn't specified a status
-				delete(vals, "dataset_access_type")
-				vals.Add("dataset_access_type", "*")
-			}
-		}
-	}
-
-	// Encode all arguments for url
-	args := vals.Encode()
-	if len(vals) < len(skeys) {
-		return "" // number of arguments should be equal or more number of spec key values
-	}
-	// replace details=True argument in DBS calls
-	if dasquery.Detail == false {
-		args = strings.Replace(args, "detail=True", "detail=False", -1)
-	}
-	// replace details=True argument in DBS calls
-	if strings.Contains(args, "detail") {
-		if v, ok := vals["detail"]; ok {
-			sv := fmt.Sprintf("%v", v)
-			if sv == "0" || sv == "false" || sv == "False" {
-				args = strings.Replace(args, "detail=True", "detail=False", -1)
-			}
-		}
-	}
-	if len(args) > 0 {
-		return base + "?" + args
-	}
-	return base
-}
-
-// FormRESTUrl forms appropriate URL from given dasquery and dasmap, the final URL
-// contains all parameters
-func FormRESTUrl(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string {
-
-	// defer function profiler
-	defer utils.MeasureTime("das/FormRESTUrl")()
-
-	spec := dasquery.Spec
-	skeys := utils.MapKeys(spec)
-	base, ok := dasmap["url"].(string)
-	if !ok {
-		log.Println("Unable to extract url from DAS map", dasmap)
-	}
-	if !strings.HasPrefix(base, "http") {
-		return "local_api"
-	}
-	// Exception block, current DAS maps contains APIs which should be treated
-	// as local apis, e.g. reqmgr_config_cache
-	urn, _ := dasmap["urn"].(string)
-	if utils.InList(urn, services.DASLocalAPIs()) {
-		return "local_api"
-	}
-	dasmaps := dasmaps.GetDASMaps(dasmap["das_map"])
-	for _, dmap := range dasmaps {
-		dkey, _, _, pat := getApiParams(dmap)
-		if utils.InList(dkey, skeys) {
-			switch spec[dkey].(type) {
-			case string:
-				val, _ := spec[dkey].(string)
-				matched, _ := regexp.MatchString(pat, val)
-				if matched || pat == "" {
-					if strings.HasPrefix(val, "/") {
-						if strings.HasSuffix(base, "/") {
-							return base[0:len(base)-1] + val
-						}
-						return base + val
-					}
-					if strings.HasSuffix(base, "/") {
-						return base + val
-					}
-					return base + "/" + val
-				}
-			case []string:
-				val, _ := spec[dkey].([]string)
-				matched, _ := regexp.MatchString(pat, val[0])
-				if matched || pat == "" {
-					return base
-				}
-			default:
-				log.Printf("ERROR: invalid type for DAS key, type %T, key %v, map %v\n", spec[dkey], dkey, dmap)
-				return ""
-			}
-		}
-	}
-	return ""
-}
-
 // DASRecords holds list of DAS records
 type DASRecords []mongo.DASRecord
 
@@ -413,46 +54,39 @@ func processLocalApis(dasquery dasql.DASQuery, dmaps []mongo.DASRecord, pkeys []
 	// defer function profiler
 	defer utils.MeasureTime("das/processLocalApis")()
 
-	localApiMap := services.LocalAPIMap()
 	for _, dmap := range dmaps {
 		urn := dasmaps.GetString(dmap, "urn")
 		system := dasmaps.GetString(dmap, "system")
 		expire := dasmaps.GetInt(dmap, "expire")
-		api := fmt.Sprintf("%s_%s", system, urn)
-		apiFunc := localApiMap[api]
+		srv := fmt.Sprintf("%s:%s", system, urn)
+		api, ok := services.GetLocalAPI(system, urn)
+		if !ok {
+			log.Printf("ERROR: no local API registered for %s\n", srv)
+			msg := fmt.Sprintf("no local API registered for %s", srv)
+			recordCall(dasquery.Qhash, ServiceStatus{Service: srv, Instance: dasquery.Instance, Status: "skipped", Error: msg})
+			continue
+		}
 		if utils.VERBOSE > 0 {
-			log.Printf("DAS look-up: api %s, func %s\n", api, apiFunc)
+			log.Printf("DAS look-up: api %s, func %s\n", api.Name(), api.Function)
 		}
-		// we use reflection to look-up api from our services/localapis.go functions
-		// for details on reflection see
-		// http://stackoverflow.com/questions/12127585/go-lookup-function-by-name
-		t := reflect.ValueOf(services.LocalAPIs{})         // type of LocalAPIs struct
-		m := t.MethodByName(apiFunc)                       // associative function name for given api
-		args := []reflect.Value{reflect.ValueOf(dasquery)} // list of function arguments
-		vals := m.Call(args)[0]                            // return value
-		records := vals.Interface().([]mongo.DASRecord)    // cast reflect value to its type
+		start := time.Now()
+		records := api.Call(dasquery)
+		status := CallStatus(srv, records, nil, time.Since(start))
+		status.Instance = dasquery.Instance
+		status.Url = dasmaps.GetString(dmap, "url")
+		recordCall(dasquery.Qhash, status)
 		if utils.VERBOSE > 1 {
-			log.Printf("local apis, urn %v, system %v, expire %v, dmap %v, api %v, func %v, method %v, records %v\n", urn, system, expire, dmap, api, apiFunc, m, len(records))
+			log.Printf("local apis, urn %v, system %v, expire %v, dmap %v, api %v, records %v\n", urn, system, expire, dmap, api.Name(), len(records))
 		}
 
-		records = services.AdjustRecords(dasquery, system, urn, records, expire, pkeys)
+		records = services.AdjustRecords(dasquery, system, urn, dasmaps.GetString(dmap, "url"), records, expire, pkeys)
 
-		// get DAS record and adjust its settings
-		dasrecord := services.GetDASRecord(dasquery)
-		dasstatus := fmt.Sprintf("process %s:%s", system, urn)
-		dasexpire := services.GetExpire(dasrecord)
+		// adjust settings of DAS record
+		var recexpire int64
 		if len(records) != 0 {
-			rec := records[0]
-			recexpire := services.GetExpire(rec)
-			if dasexpire < recexpire {
-				dasexpire = recexpire
-			}
+			recexpire = services.GetExpire(records[0])
 		}
-		das := dasrecord["das"].(mongo.DASRecord)
-		das["expire"] = dasexpire
-		das["status"] = dasstatus
-		dasrecord["das"] = das
-		services.UpdateDASRecord(dasquery.Qhash, dasrecord)
+		dasexpire := updateDASRecord(dasquery, fmt.Sprintf("process %s:%s", system, urn), recexpire)
 
 		// fix all records expire values based on lowest one
 		records = services.UpdateExpire(dasquery.Qhash, records, dasexpire)
@@ -460,10 +94,17 @@ func processLocalApis(dasquery dasql.DASQuery, dmaps []mongo.DASRecord, pkeys []
 		// insert records into DAS cache collection
 		mongo.Insert("das", "cache", records)
 	}
-	// initial expire timestamp is 1h
-	//     expire := utils.Expire(3600)
-	expire := services.GetMinExpire(dasquery)
-	// get DAS record and adjust its settings
+}
+
+// lock which serialises updates of DAS records, DAS query is processed by
+// several goroutines when it runs against multiple DBS instances
+var _dasRecordLock sync.Mutex
+
+// helper function to set status of DAS record of given query and extend its
+// expire timestamp up to given one, it returns new expire timestamp
+func updateDASRecord(dasquery dasql.DASQuery, status string, expire int64) int64 {
+	_dasRecordLock.Lock()
+	defer _dasRecordLock.Unlock()
 	dasrecord := services.GetDASRecord(dasquery)
 	dasexpire := services.GetExpire(dasrecord)
 	if dasexpire < expire {
@@ -471,9 +112,19 @@ func processLocalApis(dasquery dasql.DASQuery, dmaps []mongo.DASRecord, pkeys []
 	}
 	das := dasrecord["das"].(mongo.DASRecord)
 	das["expire"] = dasexpire
-	das["status"] = "ok"
+	das["status"] = status
 	dasrecord["das"] = das
 	services.UpdateDASRecord(dasquery.Qhash, dasrecord)
+	return dasexpire
+}
+
+// helper function to mark DAS record of given query as processed, it should
+// be called once all data-service calls of the query are made
+func finishDASRecord(dasquery dasql.DASQuery) {
+	// initial expire timestamp is 1h
+	//     expire := utils.Expire(3600)
+	expire := services.GetMinExpire(dasquery)
+	updateDASRecord(dasquery, "ok", expire)
 }
 
 // helper function to process given set of URLs associted with dasquery
@@ -493,7 +144,11 @@ func processURLs(dasquery dasql.DASQuery, urls map[string]string, maps []mongo.D
 	client := utils.HttpClient()
 	for furl, args := range urls {
 		umap[furl] = 1 // keep track of processed urls below
-		go utils.Fetch(client, furl, args, out)
+		if post := services.FindPost(dasquery, maps, furl); post != nil && args != "" {
+			go services.FetchChunks(client, furl, args, post, out)
+		} else {
+			go utils.Fetch(client, furl, args, out)
+		}
 	}
 
 	// collect all results from out channel
@@ -505,18 +160,10 @@ func processURLs(dasquery dasql.DASQuery, urls map[string]string, maps []mongo.D
 			expire := 0
 			urn := ""
 			for _, dmap := range maps {
-				surl := dasmaps.GetString(dmap, "url")
-				// TMP fix, until we fix Phedex data to use JSON
-				if strings.Contains(surl, "phedex") {
-					surl = strings.Replace(surl, "xml", "json", -1)
-				}
 				// here we check that request Url match DAS map one either by splitting
 				// base from parameters or making a match for REST based urls
-				stm := dasmaps.GetString(dmap, "system")
-				if stm == "dbs3" {
-					surl = fixDBSinstance(dasquery.Instance, surl)
-				}
-				if strings.Split(r.Url, "?")[0] == surl || strings.HasPrefix(r.Url, surl) || r.Url == surl {
+				surl := services.BaseURL(dasquery, dmap)
+				if strings.Split(r.Url, "?")[0] == surl || strings.HasPrefix(r.Url, surl) || r.Url == surl || r.Url == services.PostURL(dasquery, dmap) {
 					urn = dasmaps.GetString(dmap, "urn")
 					system = dasmaps.GetString(dmap, "system")
 					expire = dasmaps.GetInt(dmap, "expire")
@@ -525,24 +172,18 @@ func processURLs(dasquery dasql.DASQuery, urls map[string]string, maps []mongo.D
 			// process data records
 			notations := dmaps.FindNotations(system)
 			records := services.Unmarshal(dasquery, system, urn, r, notations, pkeys)
-			records = services.AdjustRecords(dasquery, system, urn, records, expire, pkeys)
-
-			// get DAS record and adjust its settings
-			dasrecord := services.GetDASRecord(dasquery)
-			dasstatus := fmt.Sprintf("process %s:%s", system, urn)
-			dasexpire := services.GetExpire(dasrecord)
+			status := CallStatus(fmt.Sprintf("%s:%s", system, urn), records, r.Error, r.Time)
+			status.Instance = dasquery.Instance
+			status.Url = r.Url
+			recordCall(dasquery.Qhash, status)
+			records = services.AdjustRecords(dasquery, system, urn, r.Url, records, expire, pkeys)
+
+			// adjust settings of DAS record
+			var recexpire int64
 			if len(records) != 0 {
-				rec := records[0]
-				recexpire := services.GetExpire(rec)
-				if dasexpire < recexpire {
-					dasexpire = recexpire
-				}
+				recexpire = services.GetExpire(records[0])
 			}
-			das := dasrecord["das"].(mongo.DASRecord)
-			das["expire"] = dasexpire
-			das["status"] = dasstatus
-			dasrecord["das"] = das
-			services.UpdateDASRecord(dasquery.Qhash, dasrecord)
+			dasexpire := updateDASRecord(dasquery, fmt.Sprintf("process %s:%s", system, urn), recexpire)
 
 			// fix all records expire values based on lowest one
 			records = services.UpdateExpire(dasquery.Qhash, records, dasexpire)
@@ -552,19 +193,7 @@ func processURLs(dasquery dasql.DASQuery, urls map[string]string, maps []mongo.D
 			// remove from umap, indicate that we processed it
 			delete(umap, r.Url) // remove Url from map
 		default:
-			if len(umap) == 0 { // no more requests, merge data records
-				expire := services.GetMinExpire(dasquery)
-				// get DAS record and adjust its settings
-				dasrecord := services.GetDASRecord(dasquery)
-				dasexpire := services.GetExpire(dasrecord)
-				if dasexpire < expire {
-					dasexpire = expire
-				}
-				das := dasrecord["das"].(mongo.DASRecord)
-				das["expire"] = dasexpire
-				das["status"] = "ok"
-				dasrecord["das"] = das
-				services.UpdateDASRecord(dasquery.Qhash, dasrecord)
+			if len(umap) == 0 { // no more requests
 				exit = true
 			}
 			time.Sleep(time.Duration(10) * time.Millisecond) // wait for response
@@ -587,83 +216,14 @@ func ProcessLogic(dasquery dasql.DASQuery, maps []mongo.DASRecord, selectedServi
 	var srvs, pkeys []string
 	urls := make(map[string]string)
 	var localApis []mongo.DASRecord
-	var furl string
 	// loop over services and fetch data
 	for _, dmap := range maps {
-		args := ""
 		system, _ := dmap["system"].(string)
 		// for das2go we'll use empty selectedServices while for dasgoclient we'll pay attention here
 		if len(selectedServices) > 0 && !utils.InList(system, selectedServices) {
 			continue
 		}
-		if system == "runregistry" {
-			switch v := dasquery.Spec["run"].(type) {
-			case string:
-				args = fmt.Sprintf("{\"filter\": {\"number\": \">= %s and <= %s\"}}", v, v)
-			case []string:
-				cond := fmt.Sprintf("= %s", v[0])
-				for i, vvv := range v {
-					if i > 0 {
-						cond = fmt.Sprintf("%s or = %s", cond, vvv)
-					}
-				}
-				args = fmt.Sprintf("{\"filter\": {\"number\": \"%s\"}}", cond)
-			}
-			switch v := dasquery.Spec["date"].(type) {
-			case string:
-				t := utils.RunRegistryTime(v)
-				n := utils.RunRegistryTime(utils.Unix2DASTime(utils.UnixTime(v) + 25*60*60))
-				args = fmt.Sprintf("{\"filter\": {\"startTime\": \">= %s and < %s\"}}", t, n)
-			case []string:
-				cond := fmt.Sprintf(">= %s and <= %s", utils.RunRegistryTime(v[0]), utils.RunRegistryTime(v[len(v)-1]))
-				args = fmt.Sprintf("{\"filter\": {\"startTime\": \"%s\"}}", cond)
-			}
-			furl, _ = dmap["url"].(string)
-			// Adjust url to use custom columns
-			columns := "number%2CstartTime%2CstopTime%2Ctriggers%2CrunClassName%2CrunStopReason%2Cbfield%2CgtKey%2Cl1Menu%2ChltKeyDescription%2ClhcFill%2ClhcEnergy%2CrunCreated%2Cmodified%2ClsCount%2ClsRanges"
-			if furl[len(furl)-1:] == "/" { // look-up last slash
-				furl = fmt.Sprintf("%sapi/GLOBAL/runsummary/json/%s/none/data", furl, columns)
-			} else {
-				furl = fmt.Sprintf("%s/api/GLOBAL/runsummary/json/%s/none/data", furl, columns)
-			}
-		} else if system == "reqmgr" || system == "mcm" || system == "rucio" {
-			if system == "rucio" {
-				urn, _ := dmap["urn"].(string)
-				site, ok := dasquery.Spec["site"]
-				if ok && urn == "file4dataset_site" {
-					// remove site from site since it should not go to REST URL
-					delete(dasquery.Spec, "site")
-				}
-				furl = FormRESTUrl(dasquery, dmap)
-				if ok && urn == "file4dataset_site" { // put back site condition into dasquery spec
-					dasquery.Spec["site"] = site
-					furl += "?deep=True"
-				}
-				if urn == "block4dataset_size" {
-					// add datasets after url which will return CMS blocks (Rucio datasets)
-					furl = fmt.Sprintf("%s/datasets/", furl)
-				}
-				if urn == "rses" {
-					// cut off site parameter from REST URL since no site condition is supported yet
-					arr := strings.Split(furl, "/rses/")
-					furl = fmt.Sprintf("%s/rses/", arr[0])
-				}
-				if urn == "block4dataset" {
-					furl = fmt.Sprintf("%s/dids", furl)
-					if strings.Contains(furl, "#") {
-						furl = strings.Replace(furl, "#", "%23", -1)
-					}
-				}
-				if urn == "rules4dataset" || urn == "rules4block" || urn == "rules4file" {
-					// adjust rest URL
-					furl = fmt.Sprintf("%s/rules", furl)
-				}
-			} else {
-				furl = FormRESTUrl(dasquery, dmap)
-			}
-		} else {
-			furl = FormUrlCall(dasquery, dmap)
-		}
+		furl, args := services.Request(dasquery, dmap)
 		// adjust url with pound sign
 		if strings.Contains(furl, "#") {
 			furl = strings.Replace(furl, "#", "%23", -1)
@@ -671,10 +231,6 @@ func ProcessLogic(dasquery dasql.DASQuery, maps []mongo.DASRecord, selectedServi
 		if furl == "local_api" && !dasmaps.MapInList(dmap, localApis) {
 			localApis = append(localApis, dmap)
 		} else if furl != "" {
-			// adjust conddb URL, remove Runs= empty parater since it leads to an error
-			if strings.Contains(furl, "Runs=&") {
-				furl = strings.Replace(furl, "Runs=&", "", -1)
-			}
 			if _, ok := urls[furl]; !ok {
 				urls[furl] = args
 			}
@@ -698,6 +254,95 @@ func ProcessLogic(dasquery dasql.DASQuery, maps []mongo.DASRecord, selectedServi
 	return srvs, pkeys, urls, localApis
 }
 
+// list of systems whose APIs depend on DBS instance
+var instanceSystems = []string{"dbs3", "combined"}
+
+// instancePlan represents data-service calls of DAS query in DBS instance
+type instancePlan struct {
+	query     dasql.DASQuery    // DAS query of DBS instance
+	maps      []mongo.DASRecord // DAS maps selected for DBS instance
+	urls      map[string]string // URLs to fetch along with their arguments
+	localApis []mongo.DASRecord // local APIs to call
+}
+
+// helper function to plan processing of given DAS query across multiple DBS
+// instances. DAS maps are selected for every instance since their selection
+// depends on it, e.g. dbs3 site4dataset is not used for global instance, while
+// calls which do not depend on DBS instance are made only once. It returns
+// plans of all instances along with union of their services and primary keys.
+func planInstances(dasquery dasql.DASQuery, dmaps dasmaps.DASMaps) ([]instancePlan, []string, []string) {
+	var plans []instancePlan
+	var srvs, pkeys []string
+	seen := make(map[string]bool)
+	for _, inst := range dasquery.Instances {
+		query := dasquery
+		query.Instance = inst
+		query.Spec = make(bson.M, len(dasquery.Spec))
+		for key, val := range dasquery.Spec {
+			query.Spec[key] = val
+		}
+		maps := dmaps.FindServices(query)
+		var selectedServices []string
+		isrvs, ipkeys, urls, localApis := ProcessLogic(query, maps, selectedServices)
+		for _, srv := range isrvs {
+			if !utils.InList(srv, srvs) {
+				srvs = append(srvs, srv)
+			}
+		}
+		for _, pkey := range ipkeys {
+			if !utils.InList(pkey, pkeys) {
+				pkeys = append(pkeys, pkey)
+			}
+		}
+		for furl := range urls {
+			if seen[furl] {
+				delete(urls, furl)
+				continue
+			}
+			seen[furl] = true
+		}
+		var apis []mongo.DASRecord
+		for _, dmap := range localApis {
+			system := dasmaps.GetString(dmap, "system")
+			srv := fmt.Sprintf("%s:%s", system, dasmaps.GetString(dmap, "urn"))
+			if utils.InList(system, instanceSystems) || !seen[srv] {
+				seen[srv] = true
+				apis = append(apis, dmap)
+			}
+		}
+		plans = append(plans, instancePlan{query: query, maps: maps, urls: urls, localApis: apis})
+	}
+	return plans, srvs, pkeys
+}
+
+// helper function to process given plans of DAS query across multiple DBS
+// instances in parallel, DAS record of the query is marked as processed once
+// all instances are processed
+func processInstances(dasquery dasql.DASQuery, plans []instancePlan, dmaps dasmaps.DASMaps, pkeys []string) {
+
+	// defer function profiler
+	defer utils.MeasureTime("das/processInstances")()
+
+	var wg sync.WaitGroup
+	for _, plan := range plans {
+		if utils.WEBSERVER > 0 && utils.VERBOSE > 0 {
+			log.Println("processInstances, instance", plan.query.Instance, "urls", plan.urls, "localApis", plan.localApis)
+		}
+		wg.Add(1)
+		go func(plan instancePlan) {
+			defer wg.Done()
+			if len(plan.localApis) > 0 {
+				processLocalApis(plan.query, plan.localApis, pkeys)
+			}
+			if len(plan.urls) > 0 {
+				processURLs(plan.query, plan.urls, plan.maps, dmaps, pkeys)
+			}
+		}(plan)
+	}
+	wg.Wait()
+	finishDASRecord(dasquery)
+}
+
 // Process takes care of processing given DAS query
 func Process(dasquery dasql.DASQuery, dmaps dasmaps.DASMaps) {
 	// defer function will propagate error message to higher level
@@ -714,6 +359,12 @@ func Process(dasquery dasql.DASQuery, dmaps dasmaps.DASMaps) {
 	var selectedServices []string
 	srvs, pkeys, urls, localApis := ProcessLogic(dasquery, maps, selectedServices)
 
+	// services of DAS query across multiple DBS instances
+	var plans []instancePlan
+	if len(dasquery.Instances) > 1 {
+		plans, srvs, pkeys = planInstances(dasquery, dmaps)
+	}
+
 	if utils.WEBSERVER > 0 && utils.VERBOSE > 0 {
 		log.Println("ProcessLogic, services", srvs, "pkeys", pkeys, "urls", urls, "localApis", localApis)
 	}
@@ -725,6 +376,10 @@ func Process(dasquery dasql.DASQuery, dmaps dasmaps.DASMaps) {
 			fmt.Println("DAS WARNING", dasquery, "unable to find any CMS service to fullfil this request")
 		}
 		dasrecord := services.CreateDASErrorRecord(dasquery, pkeys)
+		// provide users with hints how to adjust their query
+		das := dasrecord["das"].(mongo.DASRecord)
+		das["suggestions"] = dmaps.Suggest(dasquery)
+		dasrecord["das"] = das
 		var records []mongo.DASRecord
 		records = append(records, dasrecord)
 		mongo.Insert("das", "cache", records)
@@ -739,67 +394,39 @@ func Process(dasquery dasql.DASQuery, dmaps dasmaps.DASMaps) {
 	records = append(records, dasrecord)
 	mongo.Insert("das", "cache", records)
 
-	// process local_api calls, we use GoDeferFunc to run processLocalApis as goroutine in defer/silent mode
-	// errors will be captured in GoDeferFunc and passed again into this local function
-	if len(localApis) > 0 {
-		utils.GoDeferFunc("go processLocalApis", func() { processLocalApis(dasquery, localApis, pkeys) })
-	}
-	// process URLs which will insert records into das cache and merge them into das merge collection
-	if urls != nil {
-		utils.GoDeferFunc("go processURLs", func() { processURLs(dasquery, urls, maps, dmaps, pkeys) })
+	if len(plans) > 0 {
+		// fan-out query to multiple DBS instances
+		utils.GoDeferFunc("go processInstances", func() { processInstances(dasquery, plans, dmaps, pkeys) })
+	} else {
+		// process local_api calls, we use GoDeferFunc to run processLocalApis as goroutine in defer/silent mode
+		// errors will be captured in GoDeferFunc and passed again into this local function
+		if len(localApis) > 0 {
+			utils.GoDeferFunc("go processLocalApis", func() { processLocalApis(dasquery, localApis, pkeys) })
+		}
+		// process URLs which will insert records into das cache and merge them into das merge collection
+		if urls != nil {
+			utils.GoDeferFunc("go processURLs", func() { processURLs(dasquery, urls, maps, dmaps, pkeys) })
+		}
+		finishDASRecord(dasquery)
 	}
 
 	// merge DAS cache records
-	records, _ = services.MergeDASRecords(dasquery)
+	var diffKeys []string
+	if len(pkeys) > 0 {
+		diffKeys = dmaps.DiffKeys(pkeys[0])
+	}
+	records, _ = services.MergeDASRecords(dasquery, pkeys, diffKeys)
 	mongo.Insert("das", "merge", records)
 
+	// keep outcome of every API call in DAS record
+	storeReport(dasquery.Qhash, srvs)
+
 	// insert das.record=0 into DAS Merge collection to indicate that we done with request
 	spec := bson.M{"das.record": 0, "qhash": dasquery.Qhash}
 	recs := mongo.Get("das", "cache", spec, 0, 1)
 	mongo.Insert("das", "merge", recs)
 }
 
-// helper function to modify spec with given filter
-func modSpec(spec bson.M, filter string) {
-	var key, val, op string
-	var vals []string
-	if strings.Index(filter, "<") > 0 {
-		if strings.Index(filter, "<=") > 0 {
-			vals = strings.Split(filter, "<=")
-			op = "$le"
-		} else {
-			vals = strings.Split(filter, "<")
-			op = "$lt"
-		}
-	} else if strings.Index(filter, "<") > 0 {
-		if strings.Index(filter, ">=") > 0 {
-			vals = strings.Split(filter, ">=")
-			op = "$ge"
-		} else {
-			vals = strings.Split(filter, ">")
-			op = "$gt"
-		}
-	} else if strings.Index(filter, "!=") > 0 {
-		vals = strings.Split(filter, "!=")
-		op = "$ne"
-	} else if strings.Index(filter, "=") > 0 {
-		vals = strings.Split(filter, "=")
-		op = "$eq"
-	} else {
-		return
-	}
-	key = vals[0]
-	val = vals[1]
-	var cond bson.M
-	if utils.IsInt(val) {
-		ival, _ := strconv.Atoi(val)
-		cond = bson.M{op: ival}
-	} else {
-		cond = bson.M{op: val}
-	}
-	spec[key] = cond
-}
-
 // GetData for given pid (DAS Query qhash)
 func GetData(dasquery dasql.DASQuery, coll string, idx, limit int) (string, []mongo.DASRecord) {
 
@@ -808,34 +435,32 @@ func GetData(dasquery dasql.DASQuery, coll string, idx, limit int) (string, []mo
 
 	var emptyData, data []mongo.DASRecord
 	pid := dasquery.Qhash
-	filters := dasquery.Filters
 	aggrs := dasquery.Aggregators
 	if len(aggrs) > 0 { // if we need to aggregate we should ignore pagination
 		idx = 0
 		limit = -1
 	}
-	spec := bson.M{"qhash": pid, "das.record": 1}
-	skeys := filters["sort"]
-	if len(filters) > 0 {
-		var afilters []string
-		for key, vals := range filters {
-			if key == "grep" {
-				for _, val := range vals {
-					if strings.Index(val, "<") > 0 || strings.Index(val, "<") > 0 || strings.Index(val, "!") > 0 || strings.Index(val, "=") > 0 {
-						modSpec(spec, val)
-					} else {
-						afilters = append(afilters, val)
-					}
-				}
-			}
-		}
-		if len(afilters) > 0 {
-			data = mongo.GetFilteredSorted("das", coll, spec, afilters, skeys, idx, limit)
+	spec, afilters, skeys := dataSpec(dasquery)
+	// sort should be applied to all records before pagination. MongoDB sorts
+	// records unless values of sort keys should be compared as numbers or
+	// sizes, in that case we fetch all records and sort them ourselves.
+	sidx, slimit := idx, limit
+	var msort []string
+	if len(skeys) > 0 {
+		if querySortable(dasquery, coll, spec, skeys) {
+			msort = MongoSortKeys(skeys)
 		} else {
-			data = mongo.Get("das", coll, spec, idx, limit)
+			sidx = 0
+			slimit = -1
 		}
+	}
+	if len(afilters) > 0 || len(msort) > 0 {
+		data = mongo.GetFilteredSorted("das", coll, spec, afilters, msort, sidx, slimit)
 	} else {
-		data = mongo.Get("das", coll, spec, idx, limit)
+		data = mongo.Get("das", coll, spec, sidx, slimit)
+	}
+	if len(skeys) > 0 && len(msort) == 0 {
+		data = paginate(SortRecords(data, skeys), idx, limit)
 	}
 	if len(aggrs) > 0 {
 		data = aggregateAll(data, aggrs)
@@ -844,20 +469,53 @@ func GetData(dasquery dasql.DASQuery, coll string, idx, limit int) (string, []mo
 	// perform post-processing of DAS records
 	//     data = PostProcessing(dasquery, data)
 
-	// Get DAS status from merge collection
-	spec = bson.M{"qhash": pid, "das.record": 0}
+	status := dataStatus(pid)
+	if strings.HasPrefix(status, "ERROR") {
+		return status, emptyData
+	}
+	touch(pid)
+	if len(data) == 0 {
+		return status, emptyData
+	}
+	return status, data
+}
+
+// helper function to build look-up spec of DAS query records, it returns the
+// spec along with list of fields to fetch and sort keys of the query
+func dataSpec(dasquery dasql.DASQuery) (bson.M, []string, []SortKey) {
+	spec := bson.M{"qhash": dasquery.Qhash, "das.record": 1}
+	skeys := ParseSortKeys(dasquery.Filters["sort"])
+	var afilters []string
+	for _, val := range dasquery.Filters["grep"] {
+		if isCondition(val) {
+			modSpec(spec, val)
+		} else {
+			afilters = append(afilters, val)
+		}
+	}
+	if len(afilters) > 0 {
+		// we should always fetch sort keys to be able to sort records
+		for _, skey := range skeys {
+			if !utils.InList(skey.Key, afilters) {
+				afilters = append(afilters, skey.Key)
+			}
+		}
+	}
+	return spec, afilters, skeys
+}
+
+// helper function to get DAS status of given query from merge collection
+func dataStatus(pid string) string {
+	spec := bson.M{"qhash": pid, "das.record": 0}
 	dasData := mongo.Get("das", "merge", spec, 0, 1)
 	if len(dasData) == 0 {
-		return fmt.Sprintf("ERROR no DAS record found in das.merge collection\n"), emptyData
+		return fmt.Sprintf("ERROR no DAS record found in das.merge collection\n")
 	}
 	status, err := mongo.GetStringValue(dasData[0], "das.status")
 	if err != nil {
-		return fmt.Sprintf("ERROR failed to get data from DAS cache: %s\n", err), emptyData
+		return fmt.Sprintf("ERROR failed to get data from DAS cache: %s\n", err)
 	}
-	if len(data) == 0 {
-		return status, emptyData
-	}
-	return status, data
+	return status
 }
 
 // helper function to perform post-processing of DAS data, e.g.
@@ -931,7 +589,7 @@ func aggregateAll(data []mongo.DASRecord, aggrs [][]string) []mongo.DASRecord {
 	for _, agg := range aggrs {
 		fagg := agg[0]
 		fval := agg[1]
-		go aggregate(data, fagg, fval, ch)
+		go aggregate(data, fagg, fval, agg[2:], ch)
 	}
 	// collect results
 	for {
@@ -949,34 +607,25 @@ func aggregateAll(data []mongo.DASRecord, aggrs [][]string) []mongo.DASRecord {
 }
 
 // helper function to aggregate results for given function and key and yield them to channel
-func aggregate(data []mongo.DASRecord, agg, key string, ch chan mongo.DASRecord) {
-	ch <- Aggregate(data, agg, key)
+func aggregate(data []mongo.DASRecord, agg, key string, args []string, ch chan mongo.DASRecord) {
+	ch <- Aggregate(data, agg, key, args...)
 }
 
-// Aggregate function aggregates results for given function and key
-func Aggregate(data []mongo.DASRecord, agg, key string) mongo.DASRecord {
+// Aggregate function aggregates results for given function and key,
+// optional args are passed to aggregator, e.g. number of histogram bins
+func Aggregate(data []mongo.DASRecord, agg, key string, args ...string) mongo.DASRecord {
 	var values []interface{}
 	for _, r := range data {
 		val := mongo.GetValue(r, key)
 		values = append(values, val)
 	}
 	var rec mongo.DASRecord
-	switch agg {
-	case "sum":
-		rec = mongo.DASRecord{"result": mongo.DASRecord{"value": utils.Sum(values)}, "function": "sum", "key": key}
-	case "min":
-		rec = mongo.DASRecord{"result": mongo.DASRecord{"value": utils.Min(values)}, "function": "min", "key": key}
-	case "max":
-		rec = mongo.DASRecord{"result": mongo.DASRecord{"value": utils.Max(values)}, "function": "max", "key": key}
-	case "mean":
-		rec = mongo.DASRecord{"result": mongo.DASRecord{"value": utils.Mean(values)}, "function": "mean", "key": key}
-	case "count":
-		rec = mongo.DASRecord{"result": mongo.DASRecord{"value": len(values)}, "function": "count", "key": key}
-	case "median":
-		rec = mongo.DASRecord{"result": mongo.DASRecord{"value": utils.Median(values)}, "function": "median", "key": key}
-	case "avg":
-		rec = mongo.DASRecord{"result": mongo.DASRecord{"value": utils.Avg(values)}, "function": "avg", "key": key}
-	default:
+	if f, ok := utils.GetAggregator(agg); ok {
+		rec = mongo.DASRecord{"result": mongo.DASRecord{"value": f(values, args)}, "function": agg, "key": key}
+		if len(args) > 0 {
+			rec["args"] = args
+		}
+	} else {
 		rec = make(mongo.DASRecord)
 	}
 	if len(data) > 0 {
@@ -1003,6 +652,9 @@ func Bytes(pid string) int {
 func GetTimestamp(pid string) int64 {
 	spec := bson.M{"qhash": pid, "das.record": 0}
 	data := mongo.Get("das", "cache", spec, 0, 1)
+	if len(data) == 0 {
+		return time.Now().Unix()
+	}
 	ts, err := mongo.GetInt64Value(data[0], "das.ts")
 	if err != nil {
 		return time.Now().Unix()
@@ -1033,6 +685,42 @@ func CheckData(pid string) bool {
 	return false
 }
 
+// Expire returns expire timestamp of DAS query records in merge collection,
+// it returns zero if query is not in DAS cache
+func Expire(pid string) int64 {
+	spec := bson.M{"qhash": pid, "das.record": 0}
+	recs := mongo.Get("das", "merge", spec, 0, 1)
+	if len(recs) == 0 {
+		return 0
+	}
+	expire, err := mongo.GetInt64Value(recs[0], "das.expire")
+	if err != nil {
+		return 0
+	}
+	return expire
+}
+
+// StaleData checks if DAS cache holds expired but complete records of given
+// query which expired no more than maxAge seconds ago, it returns age of the
+// records, i.e. time passed since they were fetched
+func StaleData(pid string, maxAge int64) (int64, bool) {
+	if maxAge <= 0 {
+		return 0, false
+	}
+	now := time.Now().Unix()
+	espec := bson.M{"$lte": now, "$gte": now - maxAge}
+	spec := bson.M{"qhash": pid, "das.expire": espec, "das.record": 0, "das.status": "ok"}
+	recs := mongo.Get("das", "merge", spec, 0, 1)
+	if len(recs) == 0 {
+		return 0, false
+	}
+	ts, err := mongo.GetInt64Value(recs[0], "das.ts")
+	if err != nil {
+		return 0, true
+	}
+	return now - ts, true
+}
+
 // RemoveExpired remove expired records
 func RemoveExpired(pid string) {
 	espec := bson.M{"$lt": time.Now().Unix()}
@@ -0,0 +1,65 @@
+package das
+
+// DAS explain module, it reports how DAS query would be processed
+// without contacting any data-service
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"sort"
+
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/services"
+)
+
+// ExplainURL represents URL call DAS would make for DAS query
+type ExplainURL struct {
+	Url  string `json:"url"`
+	Args string `json:"args,omitempty"`
+}
+
+// ExplainLocalAPI represents local API DAS would call for DAS query
+type ExplainLocalAPI struct {
+	System   string `json:"system"`
+	Urn      string `json:"urn"`
+	Function string `json:"function"`
+}
+
+// Explanation represents dry-run of DAS query processing
+type Explanation struct {
+	DASQuery  dasql.DASQuery        `json:"dasquery"`
+	Maps      []dasmaps.MapDecision `json:"maps"`
+	Services  []string              `json:"services"`
+	Pkeys     []string              `json:"pkeys"`
+	Urls      []ExplainURL          `json:"urls"`
+	LocalApis []ExplainLocalAPI     `json:"local_apis"`
+}
+
+// Explain reports DAS maps chosen for given DAS query along with reasons of
+// rejected ones, and URLs and local APIs Process would call. It performs the
+// same steps as Process but does not contact any data-service.
+func Explain(dasquery dasql.DASQuery, dmaps dasmaps.DASMaps) Explanation {
+	explain := Explanation{DASQuery: dasquery}
+	explain.Maps = dmaps.ExplainServices(dasquery)
+	maps := dmaps.FindServices(dasquery)
+	var selectedServices []string
+	srvs, pkeys, urls, localApis := ProcessLogic(dasquery, maps, selectedServices)
+	explain.Services = srvs
+	explain.Pkeys = pkeys
+	for furl, args := range urls {
+		explain.Urls = append(explain.Urls, ExplainURL{Url: furl, Args: args})
+	}
+	sort.Slice(explain.Urls, func(i, j int) bool { return explain.Urls[i].Url < explain.Urls[j].Url })
+	for _, dmap := range localApis {
+		system := dasmaps.GetString(dmap, "system")
+		urn := dasmaps.GetString(dmap, "urn")
+		rec := ExplainLocalAPI{System: system, Urn: urn}
+		if api, ok := services.GetLocalAPI(system, urn); ok {
+			rec.Function = api.Function
+		}
+		explain.LocalApis = append(explain.LocalApis, rec)
+	}
+	return explain
+}
@@ -0,0 +1,191 @@
+package das
+
+// DAS filters module, it converts grep conditions of DAS queries into
+// MongoDB query conditions which are pushed down into the cache query
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmwm/das2go/utils"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// list of supported condition operators, longer operators must come first
+var conditionOperators = []string{"<=", ">=", "!=", "<", ">", "~", "="}
+
+// mapping of condition operators to MongoDB operators
+var mongoOperators = map[string]string{
+	"<":  "$lt",
+	"<=": "$lte",
+	">":  "$gt",
+	">=": "$gte",
+	"=":  "$in",
+	"!=": "$nin",
+	"~":  "$regex",
+	"in": "$in",
+}
+
+// helper function to check if given grep filter is a condition, e.g.
+// file.size>1GB, file.name~RAW or file.nevents in [1,2], rather than
+// a plain key selection
+func isCondition(filter string) bool {
+	_, _, _, ok := parseCondition(filter)
+	return ok
+}
+
+// helper function to split grep condition into key, operator and value
+func parseCondition(filter string) (string, string, string, bool) {
+	filter = strings.TrimSpace(filter)
+	if idx := strings.Index(filter, " in "); idx > 0 {
+		return filter[:idx], "in", strings.TrimSpace(filter[idx+4:]), true
+	}
+	idx := strings.IndexAny(filter, "<>!=~")
+	if idx <= 0 {
+		return "", "", "", false
+	}
+	key := strings.TrimSpace(filter[:idx])
+	rest := filter[idx:]
+	for _, op := range conditionOperators {
+		if strings.HasPrefix(rest, op) {
+			return key, op, strings.TrimSpace(rest[len(op):]), true
+		}
+	}
+	return "", "", "", false
+}
+
+// helper function to convert condition value into number, size or date
+// if it is possible, otherwise original string is returned
+func conditionValue(key, val string) interface{} {
+	if strings.HasSuffix(key, "time") || strings.HasSuffix(key, "date") {
+		if ts, ok := dateValue(val); ok {
+			return ts
+		}
+	}
+	if v, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseFloat(val, 64); err == nil {
+		return v
+	}
+	if v, ok := utils.ParseSize(val); ok {
+		return v
+	}
+	return val
+}
+
+// helper function to convert date value, e.g. 20230101, 2023-01-01 or
+// unix timestamp, into unix time
+func dateValue(val string) (int64, bool) {
+	if t, err := time.Parse("2006-01-02", val); err == nil {
+		return t.Unix(), true
+	}
+	if len(val) == 8 || len(val) == 10 {
+		if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+			if ts := utils.UnixTime(val); ts > 0 {
+				return ts, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// helper function to return list of values used for equality matches,
+// numeric values are matched both as numbers and strings since data-services
+// do not agree on value types
+func matchValues(key, val string) []interface{} {
+	out := []interface{}{val}
+	v := conditionValue(key, val)
+	if _, ok := v.(string); !ok {
+		out = append(out, v)
+	}
+	return out
+}
+
+// helper function to convert wildcard pattern into anchored regular expression
+func wildcardPattern(val string) string {
+	var parts []string
+	for _, part := range strings.Split(val, "*") {
+		parts = append(parts, regexp.QuoteMeta(part))
+	}
+	return "^" + strings.Join(parts, ".*") + "$"
+}
+
+// helper function to validate regular expression, invalid patterns are
+// treated as literal strings
+func regexPattern(val string) string {
+	if _, err := regexp.Compile(val); err != nil {
+		log.Printf("WARNING: invalid regular expression %s, error %v\n", val, err)
+		return regexp.QuoteMeta(val)
+	}
+	return val
+}
+
+// helper function to add condition to the spec, multiple conditions on the same
+// key are combined into single condition, while conflicting ones are joined via $and
+func addCondition(spec bson.M, key, op string, val interface{}) {
+	cond, ok := spec[key].(bson.M)
+	if !ok {
+		if _, exists := spec[key]; !exists {
+			spec[key] = bson.M{op: val}
+			return
+		}
+	} else if _, exists := cond[op]; !exists {
+		cond[op] = val
+		return
+	}
+	and, _ := spec["$and"].([]bson.M)
+	spec["$and"] = append(and, bson.M{key: bson.M{op: val}})
+}
+
+// helper function to modify spec with given grep condition
+func modSpec(spec bson.M, filter string) {
+	key, op, val, ok := parseCondition(filter)
+	if !ok || key == "" {
+		return
+	}
+	switch op {
+	case "in":
+		val = strings.TrimSuffix(strings.TrimPrefix(val, "["), "]")
+		var vals []interface{}
+		for _, v := range strings.Split(val, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				vals = append(vals, matchValues(key, v)...)
+			}
+		}
+		addCondition(spec, key, "$in", vals)
+	case "~":
+		addCondition(spec, key, "$regex", regexPattern(val))
+	case "=", "!=":
+		if strings.Contains(val, "*") {
+			pat := bson.RegEx{Pattern: wildcardPattern(val)}
+			if op == "=" {
+				addCondition(spec, key, "$regex", pat.Pattern)
+			} else {
+				addCondition(spec, key, "$not", pat)
+			}
+			return
+		}
+		addCondition(spec, key, mongoOperators[op], matchValues(key, val))
+	default:
+		addCondition(spec, key, mongoOperators[op], conditionValue(key, val))
+	}
+}
+
+// ConditionSpec returns MongoDB spec for given list of grep conditions
+func ConditionSpec(conditions []string) bson.M {
+	spec := bson.M{}
+	for _, cond := range conditions {
+		if isCondition(cond) {
+			modSpec(spec, cond)
+		}
+	}
+	return spec
+}
@@ -0,0 +1,19 @@
+package das
+
+// DAS plugins module, it registers CMS data-services DAS talks to.
+// To add new data-service implement services.Service interface in its own
+// package and import it here.
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	_ "github.com/dmwm/das2go/services/conddb"
+	_ "github.com/dmwm/das2go/services/cric"
+	_ "github.com/dmwm/das2go/services/dashboard"
+	_ "github.com/dmwm/das2go/services/dbs"
+	_ "github.com/dmwm/das2go/services/mcm"
+	_ "github.com/dmwm/das2go/services/reqmgr"
+	_ "github.com/dmwm/das2go/services/rucio"
+	_ "github.com/dmwm/das2go/services/runregistry"
+)
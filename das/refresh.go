@@ -0,0 +1,81 @@
+package das
+
+// DAS refresh module, it re-processes cached DAS queries in background and
+// replaces their records with fresh ones
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+
+import (
+	"log"
+	"sync"
+
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DAS queries which are refreshing in background
+var _refreshing = struct {
+	sync.Mutex
+	pids map[string]bool
+}{pids: make(map[string]bool)}
+
+// Refreshing reports if given DAS query is refreshing in background
+func Refreshing(pid string) bool {
+	_refreshing.Lock()
+	defer _refreshing.Unlock()
+	return _refreshing.pids[pid]
+}
+
+// RemoveRecords removes all records of given DAS query from DAS cache, it
+// returns number of removed records
+func RemoveRecords(pid string) int {
+	spec := bson.M{"qhash": pid}
+	return mongo.Remove("das", "cache", spec) + mongo.Remove("das", "merge", spec)
+}
+
+// Refresh processes given DAS query anew and replaces its records in DAS
+// cache by fresh ones. The query is processed under temporary hash, therefore
+// existing records are served until processing is finished. It returns false
+// if the query is already refreshing.
+func Refresh(dasquery dasql.DASQuery, dmaps dasmaps.DASMaps) bool {
+	pid := dasquery.Qhash
+	_refreshing.Lock()
+	if _refreshing.pids[pid] {
+		_refreshing.Unlock()
+		return false
+	}
+	_refreshing.pids[pid] = true
+	_refreshing.Unlock()
+	defer func() {
+		_refreshing.Lock()
+		delete(_refreshing.pids, pid)
+		_refreshing.Unlock()
+	}()
+
+	tmp := dasquery
+	tmp.Qhash = pid + "-refresh"
+	RemoveRecords(tmp.Qhash) // leftovers of interrupted refresh
+	Process(tmp, dmaps)
+	if !CheckDataReadiness(tmp.Qhash) {
+		log.Printf("ERROR: unable to refresh %s, pid=%s\n", dasquery, pid)
+		RemoveRecords(tmp.Qhash)
+		return true
+	}
+	// replace old records with fresh ones, while it happens the query is
+	// reported as refreshing and clients wait for its records. The DAS record
+	// of merge collection is moved last, since readers treat its presence as
+	// indication that all data records are in place. Access time of the query
+	// is preserved to keep its position in least recently used order.
+	access := Access(pid)
+	RemoveRecords(pid)
+	update := bson.M{"$set": bson.M{"qhash": pid}}
+	mongo.UpdateAll("das", "cache", bson.M{"qhash": tmp.Qhash}, update)
+	mongo.UpdateAll("das", "merge", bson.M{"qhash": tmp.Qhash, "das.record": bson.M{"$ne": 0}}, update)
+	if access > 0 {
+		update = bson.M{"$set": bson.M{"qhash": pid, "das.access": access}}
+	}
+	mongo.UpdateAll("das", "merge", bson.M{"qhash": tmp.Qhash, "das.record": 0}, update)
+	return true
+}
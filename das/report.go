@@ -0,0 +1,174 @@
+package das
+
+// DAS report module, it keeps outcome of every data-service API call made
+// for DAS query and summarises it into overall state of the query
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ServiceStatus represents outcome of data-service API call made for DAS query
+type ServiceStatus struct {
+	Service  string  `json:"service" bson:"service"`                 // data-service, i.e. system:api
+	Instance string  `json:"instance,omitempty" bson:"instance"`     // DBS instance of the call
+	Url      string  `json:"url,omitempty" bson:"url"`               // URL of data-service API
+	Status   string  `json:"status" bson:"status"`                   // ok, empty, error, timeout or skipped
+	Latency  float64 `json:"latency" bson:"latency"`                 // duration of the call in seconds
+	Records  int     `json:"nrecords" bson:"nrecords"`               // number of records provided by the call
+	Error    string  `json:"error,omitempty" bson:"error,omitempty"` // error message of the call
+}
+
+// QueryReport represents structured status of DAS query
+type QueryReport struct {
+	State    string          `json:"state" bson:"state"`       // complete, partial, failed or skipped
+	Services []ServiceStatus `json:"services" bson:"services"` // outcome of every data-service API call
+}
+
+// outcomes of data-service API calls of DAS queries which are processing
+var _calls = struct {
+	sync.Mutex
+	calls map[string][]ServiceStatus
+}{calls: make(map[string][]ServiceStatus)}
+
+// helper function to record outcome of data-service API call of DAS query
+func recordCall(pid string, status ServiceStatus) {
+	_calls.Lock()
+	defer _calls.Unlock()
+	_calls.calls[pid] = append(_calls.calls[pid], status)
+}
+
+// helper function to return and forget outcomes of API calls of DAS query
+func takeCalls(pid string) []ServiceStatus {
+	_calls.Lock()
+	defer _calls.Unlock()
+	calls := _calls.calls[pid]
+	delete(_calls.calls, pid)
+	return calls
+}
+
+// helper function to check if given error is caused by timeout
+func timeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, http.ErrHandlerTimeout) {
+		return true
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "timeout")
+}
+
+// CallStatus returns outcome of data-service API call which returned given
+// records and error, it fills status, number of records and error message
+func CallStatus(srv string, records []mongo.DASRecord, err error, latency time.Duration) ServiceStatus {
+	status := ServiceStatus{Service: srv, Latency: latency.Seconds()}
+	if err != nil {
+		status.Status = "error"
+		if timeoutError(err) {
+			status.Status = "timeout"
+		}
+		status.Error = err.Error()
+		return status
+	}
+	var msg string
+	for _, rec := range records {
+		if e, ok := rec["error"]; ok {
+			if msg == "" {
+				msg = fmt.Sprintf("%v", e)
+			}
+			continue
+		}
+		status.Records += 1
+	}
+	switch {
+	case status.Records > 0:
+		status.Status = "ok"
+	case msg != "":
+		status.Status = "error"
+		status.Error = msg
+		if strings.Contains(strings.ToLower(msg), "timeout") {
+			status.Status = "timeout"
+		}
+	default:
+		status.Status = "empty"
+	}
+	return status
+}
+
+// NewQueryReport creates report of DAS query from outcomes of its API calls,
+// services which were selected for the query but not called are reported as
+// skipped. The query is complete if some calls succeeded and none of them
+// failed, partial if some of them succeeded and others failed, failed if all
+// of them failed and skipped if none of the services was called.
+func NewQueryReport(srvs []string, calls []ServiceStatus) QueryReport {
+	report := QueryReport{Services: calls}
+	called := make(map[string]bool)
+	for _, call := range calls {
+		called[call.Service] = true
+	}
+	for _, srv := range utils.List2Set(srvs) {
+		if !called[srv] {
+			report.Services = append(report.Services, ServiceStatus{Service: srv, Status: "skipped"})
+		}
+	}
+	var nok, nfail int
+	for _, call := range report.Services {
+		switch call.Status {
+		case "ok", "empty":
+			nok += 1
+		case "error", "timeout":
+			nfail += 1
+		}
+	}
+	switch {
+	case nok > 0 && nfail == 0:
+		report.State = "complete"
+	case nok > 0:
+		report.State = "partial"
+	case nfail > 0:
+		report.State = "failed"
+	default:
+		report.State = "skipped"
+	}
+	return report
+}
+
+// helper function to store report of DAS query in its DAS record
+func storeReport(pid string, srvs []string) {
+	report := NewQueryReport(srvs, takeCalls(pid))
+	spec := bson.M{"qhash": pid, "das.record": 0}
+	mongo.UpdateAll("das", "cache", spec, bson.M{"$set": bson.M{"das.report": report}})
+}
+
+// GetReport returns report of processed DAS query
+func GetReport(pid string) QueryReport {
+	var report QueryReport
+	spec := bson.M{"qhash": pid, "das.record": 0}
+	recs := mongo.Get("das", "merge", spec, 0, 1)
+	if len(recs) == 0 {
+		return report
+	}
+	das, ok := recs[0]["das"].(mongo.DASRecord)
+	if !ok {
+		return report
+	}
+	data, err := bson.Marshal(das["report"])
+	if err != nil {
+		return report
+	}
+	bson.Unmarshal(data, &report)
+	return report
+}
@@ -0,0 +1,161 @@
+package das
+
+// DAS sort module, it implements sort pipe of DAS queries
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// pattern of string values which are compared as numbers or sizes, e.g. 2GB
+var numericPattern = `^\s*[-+]?[0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?\s*([kKmMgGtTpP]?[bB])?\s*$`
+
+// SortKey represents single sort key of DAS query, e.g. file.size or -file.size
+type SortKey struct {
+	Key        string
+	Descending bool
+}
+
+// ParseSortKeys converts sort filter values into list of sort keys,
+// the leading minus sign indicates descending order
+func ParseSortKeys(skeys []string) []SortKey {
+	var out []SortKey
+	for _, k := range skeys {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if strings.HasPrefix(k, "-") {
+			out = append(out, SortKey{Key: k[1:], Descending: true})
+		} else {
+			out = append(out, SortKey{Key: strings.TrimPrefix(k, "+")})
+		}
+	}
+	return out
+}
+
+// SortRecords sorts given DAS records over provided sort keys, records are
+// compared key by key and numbers/sizes are compared numerically
+func SortRecords(data []mongo.DASRecord, skeys []SortKey) []mongo.DASRecord {
+	if len(skeys) == 0 {
+		return data
+	}
+	sort.SliceStable(data, func(i, j int) bool {
+		for _, skey := range skeys {
+			res := compareSortValues(sortValue(data[i], skey.Key), sortValue(data[j], skey.Key), skey)
+			if res != 0 {
+				return res < 0
+			}
+		}
+		return false
+	})
+	return data
+}
+
+// MongoSortKeys converts sort keys into MongoDB sort spec, records with the
+// same sort values are ordered by their _id
+func MongoSortKeys(skeys []SortKey) []string {
+	var out []string
+	for _, skey := range skeys {
+		if skey.Descending {
+			out = append(out, "-"+skey.Key)
+		} else {
+			out = append(out, skey.Key)
+		}
+	}
+	return append(out, "_id")
+}
+
+// helper function to check if records matching given spec can be sorted by
+// MongoDB over given sort keys, i.e. MongoDB order of their values is the
+// same as the one of SortRecords. It is the case when every record has value
+// of sort key and values are either all numbers or all strings which are
+// neither numbers nor sizes.
+func mongoSortable(coll string, spec bson.M, skeys []SortKey) bool {
+	total := mongo.Count("das", coll, spec)
+	for _, skey := range skeys {
+		invalid := bson.M{"$or": []bson.M{
+			{skey.Key: nil},
+			{skey.Key: ""},
+			{skey.Key: bson.M{"$regex": numericPattern}},
+		}}
+		if mongo.Count("das", coll, bson.M{"$and": []bson.M{spec, invalid}}) > 0 {
+			return false
+		}
+		numbers := bson.M{"$or": []bson.M{
+			{skey.Key: bson.M{"$type": 1}},  // double
+			{skey.Key: bson.M{"$type": 16}}, // int
+			{skey.Key: bson.M{"$type": 18}}, // long
+		}}
+		nrec := mongo.Count("das", coll, bson.M{"$and": []bson.M{spec, numbers}})
+		if nrec > 0 && nrec < total {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function to check if records of given DAS query can be sorted by
+// MongoDB, see mongoSortable. The outcome is kept in DAS record of the query
+// for hash of its filters, therefore it is computed once per query and
+// filters, while refreshed query gets new DAS record.
+func querySortable(dasquery dasql.DASQuery, coll string, spec bson.M, skeys []SortKey) bool {
+	hash := filterHash(dasquery)
+	hspec := bson.M{"qhash": dasquery.Qhash, "das.record": 0}
+	recs := mongo.Get("das", coll, hspec, 0, 1)
+	if len(recs) > 0 {
+		das, _ := recs[0]["das"].(mongo.DASRecord)
+		sortable, _ := das["sortable"].(mongo.DASRecord)
+		if val, ok := sortable[hash].(bool); ok {
+			return val
+		}
+	}
+	val := mongoSortable(coll, spec, skeys)
+	if len(recs) > 0 {
+		mongo.UpdateAll("das", coll, hspec, bson.M{"$set": bson.M{"das.sortable." + hash: val}})
+	}
+	return val
+}
+
+// helper function to compare two values of given sort key, records without
+// value are always placed last
+func compareSortValues(a, b interface{}, skey SortKey) int {
+	res := utils.CompareValues(a, b)
+	if res != 0 && skey.Descending && a != nil && a != "" && b != nil && b != "" {
+		return -res
+	}
+	return res
+}
+
+// helper function to get value from DAS record for sorting purposes
+func sortValue(rec mongo.DASRecord, key string) interface{} {
+	keys := strings.Split(key, ".")
+	if len(keys) > 1 {
+		if _, ok := rec[keys[0]]; !ok {
+			return nil
+		}
+	}
+	return mongo.GetValue(rec, key)
+}
+
+// helper function to return given page of DAS records
+func paginate(data []mongo.DASRecord, idx, limit int) []mongo.DASRecord {
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(data) {
+		return []mongo.DASRecord{}
+	}
+	if limit <= 0 || idx+limit > len(data) {
+		return data[idx:]
+	}
+	return data[idx : idx+limit]
+}
@@ -0,0 +1,190 @@
+package das
+
+// DAS sweep module, it evicts expired DAS queries from DAS cache and keeps
+// DAS cache within its size limit by evicting least recently used queries
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dmwm/das2go/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// EvictionStats represents eviction metrics of DAS cache sweeper
+type EvictionStats struct {
+	Sweeps    int     `json:"sweeps"`     // number of sweeps
+	LastSweep int64   `json:"last_sweep"` // time of last sweep
+	SweepTime float64 `json:"sweep_time"` // duration of last sweep in seconds
+	Expired   int     `json:"expired"`    // number of queries evicted due to expiration
+	Evicted   int     `json:"evicted"`    // number of queries evicted due to cache size limit
+	Records   int     `json:"records"`    // number of evicted records
+	Size      int     `json:"size"`       // size of DAS cache after last sweep
+}
+
+// eviction metrics of DAS cache sweeper
+var _evictions = struct {
+	sync.Mutex
+	stats EvictionStats
+}{}
+
+// ProcessingTimeout is maximum time in seconds DAS query is considered
+// processing, queries which are processing for longer are considered stuck
+// and can be evicted
+var ProcessingTimeout int64 = 3600
+
+// Evictions returns eviction metrics of DAS cache sweeper
+func Evictions() EvictionStats {
+	_evictions.Lock()
+	defer _evictions.Unlock()
+	return _evictions.stats
+}
+
+// helper function to record access time of DAS query, it is used by least
+// recently used eviction policy
+func touch(pid string) {
+	spec := bson.M{"qhash": pid, "das.record": 0}
+	mongo.UpdateAll("das", "merge", spec, bson.M{"$set": bson.M{"das.access": time.Now().Unix()}})
+}
+
+// Access returns last access time of DAS query, it returns zero if query
+// was not accessed since it was fetched
+func Access(pid string) int64 {
+	spec := bson.M{"qhash": pid, "das.record": 0}
+	recs := mongo.Get("das", "merge", spec, 0, 1)
+	if len(recs) == 0 {
+		return 0
+	}
+	if das, ok := recs[0]["das"].(mongo.DASRecord); ok {
+		if access, ok := das["access"].(int64); ok {
+			return access
+		}
+	}
+	return 0
+}
+
+// helper function to return DAS queries which should not be evicted, i.e.
+// queries which are processing or refreshing
+func activeQueries() map[string]bool {
+	active := make(map[string]bool)
+	spec := bson.M{
+		"das.record": 0,
+		"das.status": bson.M{"$in": []string{"requested", "processing"}},
+		"das.ts":     bson.M{"$gt": time.Now().Unix() - ProcessingTimeout},
+	}
+	for _, rec := range mongo.Get("das", "cache", spec, 0, -1) {
+		if pid, ok := rec["qhash"].(string); ok {
+			active[pid] = true
+		}
+	}
+	_refreshing.Lock()
+	for pid := range _refreshing.pids {
+		active[pid] = true
+		active[pid+"-refresh"] = true
+	}
+	_refreshing.Unlock()
+	return active
+}
+
+// helper function to return hashes of DAS queries whose records match given spec
+func queryHashes(coll string, spec bson.M) []string {
+	var out []string
+	for _, rec := range mongo.Get("das", coll, spec, 0, -1) {
+		if pid, ok := rec["qhash"].(string); ok {
+			out = append(out, pid)
+		}
+	}
+	return out
+}
+
+// LRUQueries returns given number of least recently used DAS queries, it
+// takes list of DAS records of queries ordered by access time and skips
+// active queries
+func LRUQueries(recs []mongo.DASRecord, active map[string]bool, n int) []string {
+	var out []string
+	for _, rec := range recs {
+		if len(out) >= n {
+			break
+		}
+		pid, ok := rec["qhash"].(string)
+		if !ok || active[pid] {
+			continue
+		}
+		out = append(out, pid)
+	}
+	return out
+}
+
+// helper function to return size of DAS cache
+func cacheSize() int {
+	return mongo.Size("das", "cache") + mongo.Size("das", "merge")
+}
+
+// Sweep evicts DAS queries which expired more than graceTime seconds ago.
+// If maxSize is positive and DAS cache exceeds it, least recently used
+// queries are evicted as well. Queries which are processing or refreshing
+// are never evicted.
+func Sweep(graceTime int64, maxSize int) EvictionStats {
+	start := time.Now()
+	active := activeQueries()
+	var stats EvictionStats
+
+	// evict expired queries
+	cutoff := start.Unix() - graceTime
+	pids := make(map[string]bool)
+	spec := bson.M{"das.record": 0, "das.expire": bson.M{"$lt": cutoff}}
+	for _, coll := range []string{"cache", "merge"} {
+		for _, pid := range queryHashes(coll, spec) {
+			if !active[pid] && !pids[pid] {
+				pids[pid] = true
+				stats.Records += RemoveRecords(pid)
+			}
+		}
+	}
+	stats.Expired = len(pids)
+	// remove expired records left without DAS record of their query
+	keep := []string{}
+	for pid := range active {
+		keep = append(keep, pid)
+	}
+	spec = bson.M{"das.expire": bson.M{"$lt": cutoff}, "qhash": bson.M{"$nin": keep}}
+	stats.Records += mongo.Remove("das", "cache", spec)
+	stats.Records += mongo.Remove("das", "merge", spec)
+
+	// evict least recently used queries
+	stats.Size = cacheSize()
+	if maxSize > 0 && stats.Size > maxSize {
+		spec = bson.M{"das.record": 0}
+		recs := mongo.GetSorted("das", "merge", spec, []string{"das.access", "das.ts"})
+		if len(recs) > 0 {
+			// number of queries to evict is estimated by average query size
+			avg := stats.Size/len(recs) + 1
+			nrec := (stats.Size-maxSize)/avg + 1
+			for _, pid := range LRUQueries(recs, active, nrec) {
+				stats.Records += RemoveRecords(pid)
+				stats.Evicted += 1
+			}
+			stats.Size = cacheSize()
+		}
+	}
+	stats.Sweeps = 1
+	stats.LastSweep = start.Unix()
+	stats.SweepTime = time.Since(start).Seconds()
+
+	_evictions.Lock()
+	_evictions.stats.Sweeps += stats.Sweeps
+	_evictions.stats.LastSweep = stats.LastSweep
+	_evictions.stats.SweepTime = stats.SweepTime
+	_evictions.stats.Expired += stats.Expired
+	_evictions.stats.Evicted += stats.Evicted
+	_evictions.stats.Records += stats.Records
+	_evictions.stats.Size = stats.Size
+	_evictions.Unlock()
+	if stats.Expired > 0 || stats.Evicted > 0 {
+		log.Printf("DAS cache sweep: expired %d, evicted %d queries, removed %d records, cache size %d, time %v\n", stats.Expired, stats.Evicted, stats.Records, stats.Size, time.Since(start))
+	}
+	return stats
+}
@@ -11,6 +11,7 @@ import (
 	"log"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -206,13 +207,36 @@ func (m *DASMaps) PresentationMap() mongo.DASRecord {
 			continue
 		}
 		if value == "presentation" {
-			m.presentations = rec["presentation"].(mongo.DASRecord)
+			m.presentations = mongo.Convert2DASRecord(rec["presentation"])
 			break
 		}
 	}
 	return m.presentations
 }
 
+// DiffKeys returns list of keys, defined by diff key of presentation map,
+// whose values should be compared among services for given primary key,
+// e.g. block.name
+func (m *DASMaps) DiffKeys(pkey string) []string {
+	var out []string
+	mkey := strings.Split(pkey, ".")[0]
+	rows, ok := m.PresentationMap()[mkey].([]interface{})
+	if !ok {
+		return out
+	}
+	for _, row := range rows {
+		rec := mongo.Convert2DASRecord(row)
+		if diff, ok := rec["diff"].([]interface{}); ok {
+			for _, key := range diff {
+				if v, ok := key.(string); ok {
+					out = append(out, v)
+				}
+			}
+		}
+	}
+	return out
+}
+
 // DASKeysMaps provides presentation map of DAS maps
 func (m *DASMaps) DASKeysMaps() []DASKeysMap {
 	if len(m.daskeysMaps) != 0 {
@@ -359,6 +383,11 @@ func getRequiredArgs(rec mongo.DASRecord) []string {
 	return out
 }
 
+// RequiredKeys returns DAS keys required by given DAS map record
+func RequiredKeys(rec mongo.DASRecord) []string {
+	return getRequiredArgs(rec)
+}
+
 // helper function to extract all required arguments for given dasmap record
 func getAllArgs(rec mongo.DASRecord) []string {
 	var out, args []string
@@ -397,113 +426,214 @@ func MapInList(a mongo.DASRecord, list []mongo.DASRecord) bool {
 	return false
 }
 
+// helper function to match das_map entries of DAS map record against spec
+// of DAS query, it returns number of entries which match query keys along
+// with pattern mismatches of the entries which do not
+func keyMatches(rec mongo.DASRecord, spec bson.M, keys []string) (int, []string) {
+	var matches int
+	var mismatches []string
+	urn, _ := rec["urn"].(string)
+	for _, dmap := range GetDASMaps(rec["das_map"]) {
+		dasKey, _ := dmap["das_key"].(string)
+		if !utils.InList(dasKey, keys) {
+			continue
+		}
+		pat, ok := dmap["pattern"].(string)
+		if !ok {
+			matches += 1
+			continue
+		}
+		dasValue := fmt.Sprintf("%v", spec[dasKey])
+		if matched, _ := regexp.MatchString(fmt.Sprintf("^%s", pat), dasValue); matched {
+			matches += 1
+		} else if urn == "datasetlist" && spec != nil {
+			// TMP: exception in Go we can't use certain patterns
+			// e.g. in datasetlist we have [/a/b/c,/a/b/c] one while
+			// in Go it should be [/a/b/c /a/b/c]
+			// Once we switch to Go compeletely we need this exception
+			matches += 1
+		} else {
+			mismatches = append(mismatches, fmt.Sprintf("pattern mismatch: %s=%s does not match %s", dasKey, dasValue, pat))
+		}
+	}
+	return matches, mismatches
+}
+
+// helper function to count query keys matched by das_map entries of DAS map
+// records with the same urn
+func (m *DASMaps) urnMatches(dasquery dasql.DASQuery) map[string]int {
+	keys := utils.MapKeys(dasquery.Spec)
+	out := make(map[string]int)
+	for _, rec := range m.records {
+		urn, _ := rec["urn"].(string)
+		nmatches, _ := keyMatches(rec, dasquery.Spec, keys)
+		out[urn] += nmatches
+	}
+	return out
+}
+
+// helper function to match DAS map record against DAS query, it takes number
+// of query keys matched by records with the same urn, see urnMatches. It
+// returns true if record provides data for the query and reasons why it is
+// rejected otherwise.
+func (m *DASMaps) matchService(rec mongo.DASRecord, dasquery dasql.DASQuery, urnMatches int) (bool, []string) {
+	var reasons []string
+	keys := utils.MapKeys(dasquery.Spec)
+	system, _ := rec["system"].(string)
+	urn, _ := rec["urn"].(string)
+	lookup, _ := rec["lookup"].(string)
+	if !utils.EqualLists(strings.Split(lookup, ","), dasquery.Fields) {
+		reasons = append(reasons, fmt.Sprintf("lookup mismatch: map provides %s, query requests %v", lookup, dasquery.Fields))
+	}
+	if dasquery.System != "" && dasquery.System != system {
+		reasons = append(reasons, fmt.Sprintf("system filter: query requests system %s", dasquery.System))
+	}
+	if !utils.InList(system, m.Services()) {
+		reasons = append(reasons, fmt.Sprintf("system filter: system %s is not enabled", system))
+	}
+	// our selection keys should not exceed number of possible matched keys
+	nmatches, mismatches := keyMatches(rec, dasquery.Spec, keys)
+	covered := nmatches > 0 && urnMatches >= len(keys)
+	if !covered {
+		reasons = append(reasons, mismatches...)
+	}
+	rkeys := getRequiredArgs(rec)
+	akeys := getAllArgs(rec)
+	if !utils.CheckEntries(rkeys, keys) {
+		reasons = append(reasons, fmt.Sprintf("required args mismatch: map requires %v, query provides %v", rkeys, keys))
+	}
+	if !utils.CheckEntries(keys, akeys) {
+		reasons = append(reasons, fmt.Sprintf("all args mismatch: query keys %v, map accepts %v", keys, akeys))
+	}
+	if !covered && len(mismatches) == 0 {
+		reasons = append(reasons, fmt.Sprintf("query keys %v are not covered by das_map entries", keys))
+	}
+	// special case of using site4dataset DBS api only for non global instances
+	if urn == "site4dataset" && system == "dbs3" && strings.Contains(dasquery.Instance, "global") {
+		reasons = append(reasons, "special case: site4dataset DBS api is used only for non global instances")
+	}
+	return len(reasons) == 0, reasons
+}
+
 // FindServices look-up DAS services for given set fields and spec pair, return DAS maps associated with found services
 func (m *DASMaps) FindServices(dasquery dasql.DASQuery) []mongo.DASRecord {
-	fields := dasquery.Fields
-	spec := dasquery.Spec
-	system := dasquery.System
-	keys := utils.MapKeys(spec)
-	var condRecords, out []mongo.DASRecord
-	specKeysMatches := make(map[string][]bool)
+	var out []mongo.DASRecord
+	keys := utils.MapKeys(dasquery.Spec)
+	urnMatches := m.urnMatches(dasquery)
 	for _, rec := range m.records {
-		dasmaps := GetDASMaps(rec["das_map"])
-		var urn string
-		r := rec["urn"]
-		if r != nil {
-			urn = r.(string)
-		}
-		for _, dmap := range dasmaps {
-			dasKey := dmap["das_key"].(string)
-			dasPattern := dmap["pattern"]
-			if utils.InList(dasKey, keys) {
-				if dasPattern == nil {
-					condRecords = append(condRecords, rec)
-					if v, ok := specKeysMatches[urn]; ok {
-						v = append(v, true)
-						specKeysMatches[urn] = v
-					} else {
-						specKeysMatches[urn] = []bool{true}
-					}
+		urn, _ := rec["urn"].(string)
+		matched, reasons := m.matchService(rec, dasquery, urnMatches[urn])
+		if !matched || MapInList(rec, out) {
+			if utils.VERBOSE > 1 && urnMatches[urn] > 0 {
+				if utils.WEBSERVER > 0 {
+					log.Printf("DAS map skip, system %v, urn %s, reasons %v\n", rec["system"], urn, reasons)
 				} else {
-					dasValue := fmt.Sprintf("%v", spec[dasKey])
-					pat := fmt.Sprintf("^%s", dasPattern.(string))
-					matched, _ := regexp.MatchString(pat, dasValue)
-					if matched {
-						condRecords = append(condRecords, rec)
-						if v, ok := specKeysMatches[urn]; ok {
-							v = append(v, true)
-							specKeysMatches[urn] = v
-						} else {
-							specKeysMatches[urn] = []bool{true}
-						}
-					} else if urn == "datasetlist" && spec != nil {
-						// TMP: exception in Go we can't use certain patterns
-						// e.g. in datasetlist we have [/a/b/c,/a/b/c] one while
-						// in Go it should be [/a/b/c /a/b/c]
-						// Once we switch to Go compeletely we need this exception
-						condRecords = append(condRecords, rec)
-						specKeysMatches[urn] = []bool{true}
-					}
+					fmt.Printf("DAS map skip, system %v, urn %s, reasons %v\n", rec["system"], urn, reasons)
 				}
 			}
-
+			continue
 		}
-	}
-	var values []string
-	for _, key := range keys {
-		val, _ := spec[key].(string)
-		values = append(values, val)
-	}
-	for _, rec := range condRecords {
-		lkeys := strings.Split(rec["lookup"].(string), ",")
 		rkeys := getRequiredArgs(rec)
 		akeys := getAllArgs(rec)
-		if utils.VERBOSE > 1 {
-			if utils.WEBSERVER > 0 {
-				log.Printf("DAS map lookup, system %s, urn %s, lookup %v, required keys %v, all keys %v\n", rec["system"].(string), rec["urn"].(string), lkeys, rkeys, akeys)
-			} else {
-				fmt.Printf("DAS map lookup, system %s, urn %s, lookup %v, required keys %v, all keys %v\n", rec["system"].(string), rec["urn"].(string), lkeys, rkeys, akeys)
-			}
+		if utils.VERBOSE > 0 && utils.WEBSERVER > 0 {
+			msg := fmt.Sprintf("DAS match: system=%s urn=%s url=%s spec keys=%s requested keys=%s all api keys %s", rec["system"], rec["urn"], rec["url"], keys, rkeys, akeys)
+			log.Println(msg)
 		}
-		if system != "" && rec["system"].(string) != system { // requested system does not match the record one
-			if system != rec["system"] {
-				continue
-			}
+		if utils.VERBOSE > 1 && utils.WEBSERVER == 0 {
+			// used by dasgoclient, keep fmt.Println
+			msg := utils.Color(utils.GREEN, fmt.Sprintf("DAS match: system=%s urn=%s url=%s spec keys=%s requested keys=%s all api keys %s", rec["system"], rec["urn"], rec["url"], keys, rkeys, akeys))
+			fmt.Println(msg)
 		}
-		// check that system is supported
-		if !utils.InList(rec["system"].(string), m.Services()) {
+		out = append(out, rec)
+	}
+	return out
+}
+
+// MapDecision describes whether DAS map was selected for DAS query and
+// reasons why it was rejected otherwise
+type MapDecision struct {
+	System   string   `json:"system"`
+	Urn      string   `json:"urn"`
+	Url      string   `json:"url"`
+	Selected bool     `json:"selected"`
+	Reasons  []string `json:"reasons,omitempty"`
+}
+
+// ExplainServices returns decisions made by FindServices for all DAS maps
+// which provide lookup keys of given DAS query
+func (m *DASMaps) ExplainServices(dasquery dasql.DASQuery) []MapDecision {
+	var out []MapDecision
+	var selected []mongo.DASRecord
+	urnMatches := m.urnMatches(dasquery)
+	for _, rec := range m.records {
+		lookup, ok := rec["lookup"].(string)
+		if !ok || !utils.EqualLists(strings.Split(lookup, ","), dasquery.Fields) {
 			continue
 		}
+		urn := GetString(rec, "urn")
+		decision := MapDecision{System: GetString(rec, "system"), Urn: urn, Url: GetString(rec, "url")}
+		matched, reasons := m.matchService(rec, dasquery, urnMatches[urn])
+		switch {
+		case matched && !MapInList(rec, selected):
+			decision.Selected = true
+			selected = append(selected, rec)
+		case matched:
+			decision.Reasons = []string{"duplicate of already selected map"}
+		default:
+			decision.Reasons = reasons
+		}
+		out = append(out, decision)
+	}
+	return out
+}
 
-		// this dict keep track of matched keys for given urn
-		// we need that our selection keys not exceed number of possible matched keys
-		allMatches := specKeysMatches[rec["urn"].(string)]
-		if utils.EqualLists(lkeys, fields) && utils.CheckEntries(rkeys, keys) && utils.CheckEntries(keys, akeys) && !MapInList(rec, out) && len(allMatches) >= len(keys) {
-			if utils.VERBOSE > 0 && utils.WEBSERVER > 0 {
-				msg := fmt.Sprintf("DAS match: system=%s urn=%s url=%s spec keys=%s requested keys=%s all api keys %s", rec["system"], rec["urn"], rec["url"], keys, rkeys, akeys)
-				log.Println(msg)
+// Suggestions represents hints provided to users for DAS queries which
+// can't be parsed or processed
+type Suggestions struct {
+	Keys       []string `json:"keys,omitempty"`
+	Conditions []string `json:"conditions,omitempty"`
+	Examples   []string `json:"examples,omitempty"`
+}
+
+// Suggest provides closest DAS keys, valid condition combinations and example
+// queries for given DAS query
+func (m *DASMaps) Suggest(dasquery dasql.DASQuery) Suggestions {
+	var out Suggestions
+	out.Keys = dasquery.Suggestions
+	skeys := dasquery.Fields
+	if len(skeys) == 0 {
+		skeys = out.Keys
+	}
+	for _, skey := range skeys {
+		for _, rec := range m.records {
+			if rec["type"] != "service" {
+				continue
 			}
-			if utils.VERBOSE > 1 && utils.WEBSERVER == 0 {
-				// used by dasgoclient, keep fmt.Println
-				msg := utils.Color(utils.GREEN, fmt.Sprintf("DAS match: system=%s urn=%s url=%s spec keys=%s requested keys=%s all api keys %s", rec["system"], rec["urn"], rec["url"], keys, rkeys, akeys))
-				fmt.Println(msg)
+			lookup, _ := rec["lookup"].(string)
+			if lookup != skey {
+				continue
 			}
-			// special case of using site4dataset DBS api only for non global instances
-			system := rec["system"].(string)
-			urn := rec["urn"].(string)
-			if urn == "site4dataset" && system == "dbs3" && strings.Contains(dasquery.Instance, "global") {
-				if utils.VERBOSE > 0 && utils.WEBSERVER > 0 {
-					log.Println("DAS match but skip (special case)")
-				}
-				if utils.VERBOSE > 1 && utils.WEBSERVER > 0 {
-					msg := utils.Color(utils.CYAN, "DAS match but skip (special case)")
-					fmt.Println(msg)
-				}
+			rkeys := getRequiredArgs(rec)
+			if len(rkeys) == 0 {
 				continue
 			}
-			out = append(out, rec)
+			sort.Strings(rkeys)
+			var conds []string
+			for _, key := range rkeys {
+				conds = append(conds, fmt.Sprintf("%s=<%s>", key, key))
+			}
+			cond := fmt.Sprintf("%s %s", skey, strings.Join(conds, " "))
+			if !utils.InList(cond, out.Conditions) {
+				out.Conditions = append(out.Conditions, cond)
+			}
+		}
+		for _, dmap := range m.DASKeysMaps() {
+			if dmap.Key == skey {
+				out.Examples = append(out.Examples, dmap.Examples...)
+			}
 		}
 	}
+	sort.Strings(out.Conditions)
 	return out
 }
 
@@ -0,0 +1,344 @@
+package dasmaps
+
+// DAS maps linter, it checks consistency of records of DAS map files
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
+// LintIssue represents problem found in DAS map or example file
+type LintIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	Warning bool   `json:"warning,omitempty"` // problem which does not break DAS maps
+}
+
+// String implements Stringer interface for LintIssue
+func (i LintIssue) String() string {
+	if i.Warning {
+		return fmt.Sprintf("%s:%d: warning: %s", i.File, i.Line, i.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+}
+
+// mapPositions keeps lines of keys and of list items of documents of DAS map
+// file, documents are identified by their urn, other documents by their first
+// key, e.g. notations
+type mapPositions struct {
+	keys  map[string]map[string]int   // line of every key, "" key is line of document
+	items map[string]map[string][]int // lines where items of list values start
+}
+
+// helper function to return line of given key of given document
+func (p mapPositions) line(doc, key string) int {
+	if line, ok := p.keys[doc][key]; ok {
+		return line
+	}
+	return p.keys[doc][""]
+}
+
+// helper function to return line of given item of list value of given document
+func (p mapPositions) item(doc, key string, idx int) int {
+	if lines := p.items[doc][key]; idx < len(lines) {
+		return lines[idx]
+	}
+	return p.line(doc, key)
+}
+
+// helper function to scan DAS map file for positions of its documents, every
+// document key starts at the beginning of the line and every item of list
+// value starts on its own line
+func scanPositions(fname string) mapPositions {
+	pos := mapPositions{keys: make(map[string]map[string]int), items: make(map[string]map[string][]int)}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return pos
+	}
+	var doc, key string
+	keys := make(map[string]int)
+	items := make(map[string][]int)
+	addDoc := func() {
+		if len(keys) > 0 {
+			pos.keys[doc] = keys
+			pos.items[doc] = items
+		}
+		doc, key = "", ""
+		keys = make(map[string]int)
+		items = make(map[string][]int)
+	}
+	for idx, text := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "---" {
+			addDoc()
+			continue
+		}
+		if match := mapKeyPattern.FindStringSubmatch(text); len(match) == 3 {
+			key = match[1]
+			if len(keys) == 0 {
+				doc = key
+				keys[""] = idx + 1
+			}
+			keys[key] = idx + 1
+			if key == "urn" {
+				doc = strings.Trim(strings.TrimSpace(match[2]), `"`)
+			}
+		} else if key != "" && strings.HasPrefix(trimmed, "{") {
+			items[key] = append(items[key], idx+1)
+		}
+	}
+	addDoc()
+	return pos
+}
+
+// IsLocalAPI checks if given DAS map is served by local API, it follows
+// the same rules as services.FormUrlCall
+func IsLocalAPI(system, urn, url string, localUrns []string) bool {
+	if system == "cric" || system == "sitedb2" {
+		return true
+	}
+	if !strings.HasPrefix(url, "http") {
+		return true
+	}
+	return utils.InList(urn, localUrns)
+}
+
+// LintMaps reads all DAS map files from given directory and checks
+// consistency of their records. The local APIs and list of urns treated as
+// local APIs are provided by services package, e.g. services.LocalAPIMap() and
+// services.DASLocalAPIs(). Every query from examples directory should be
+// resolved to at least one service. It returns all found problems.
+func LintMaps(mapsDir, examplesDir string, localApis map[string]string, localUrns []string) []LintIssue {
+	var issues []LintIssue
+	files, err := filepath.Glob(filepath.Join(mapsDir, "*.yml"))
+	if err != nil || len(files) == 0 {
+		issues = append(issues, LintIssue{File: mapsDir, Message: "no DAS map files found"})
+		return issues
+	}
+	sort.Strings(files)
+
+	// read all map files
+	var dmaps DASMaps
+	fileMaps := make(map[string][]mongo.DASRecord)
+	for _, fname := range files {
+		var fmaps DASMaps
+		issues = append(issues, fmaps.ReadYamlFile(fname)...)
+		fileMaps[fname] = fmaps.Maps()
+		dmaps.records = append(dmaps.records, fmaps.Maps()...)
+	}
+	presentation := dmaps.PresentationMap()
+
+	// check service and notation maps, broken service maps can't be used by
+	// FindServices and are skipped when examples are checked
+	var smaps DASMaps
+	for _, fname := range files {
+		pos := scanPositions(fname)
+		apis := make(map[string]bool)
+		for _, rec := range fileMaps[fname] {
+			if rec["type"] != "service" {
+				continue
+			}
+			issues = append(issues, lintService(fname, pos, rec, presentation, localApis, localUrns)...)
+			urn, _ := rec["urn"].(string)
+			apis[urn] = true
+			if validService(rec) {
+				smaps.records = append(smaps.records, rec)
+			}
+		}
+		for _, rec := range fileMaps[fname] {
+			if rec["type"] == "notation" {
+				issues = append(issues, lintNotations(fname, pos, rec, apis)...)
+			}
+		}
+	}
+
+	// check that examples resolve to DAS services
+	if examplesDir != "" {
+		issues = append(issues, lintExamples(&smaps, examplesDir)...)
+	}
+	return issues
+}
+
+// helper function to check notation record of DAS maps, notations of APIs
+// unknown to the system are never applied and reported as warnings
+func lintNotations(fname string, pos mapPositions, rec mongo.DASRecord, apis map[string]bool) []LintIssue {
+	var issues []LintIssue
+	system, _ := rec["system"].(string)
+	nmaps, ok := rec["notations"].([]interface{})
+	if !ok {
+		issues = append(issues, LintIssue{File: fname, Line: pos.line("notations", "notations"), Message: "notations should be a list"})
+		return issues
+	}
+	for idx, item := range nmaps {
+		nmap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		line := pos.item("notations", "notations", idx)
+		if _, ok := nmap["api_output"].(string); !ok {
+			issues = append(issues, LintIssue{File: fname, Line: line, Message: "notation without api_output"})
+		}
+		if _, ok := nmap["rec_key"].(string); !ok {
+			issues = append(issues, LintIssue{File: fname, Line: line, Message: "notation without rec_key"})
+		}
+		api, _ := nmap["api"].(string)
+		if api != "" && !apis[api] {
+			msg := fmt.Sprintf("notation api %s does not match any %s API", api, system)
+			issues = append(issues, LintIssue{File: fname, Line: line, Message: msg, Warning: true})
+		}
+	}
+	return issues
+}
+
+// helper function to check that DAS service map can be used to look-up services
+func validService(rec mongo.DASRecord) bool {
+	for _, key := range []string{"urn", "url", "lookup"} {
+		if _, ok := rec[key].(string); !ok {
+			return false
+		}
+	}
+	dmaps, ok := rec["das_map"].([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range dmaps {
+		dmap, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := dmap["das_key"].(string); !ok {
+			return false
+		}
+		if _, ok := dmap["rec_key"].(string); !ok {
+			return false
+		}
+		if pat, ok := dmap["pattern"].(string); ok {
+			if _, err := regexp.Compile(pat); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// helper function to check DAS service map entry
+func lintService(fname string, pos mapPositions, rec, presentation mongo.DASRecord, localApis map[string]string, localUrns []string) []LintIssue {
+	var issues []LintIssue
+	system, _ := rec["system"].(string)
+	urn, _ := rec["urn"].(string)
+	for _, key := range []string{"urn", "url", "lookup", "params", "das_map"} {
+		if _, ok := rec[key]; !ok {
+			msg := fmt.Sprintf("missing %s in DAS map", key)
+			issues = append(issues, LintIssue{File: fname, Line: pos.line(urn, ""), Message: msg})
+		}
+	}
+	url, _ := rec["url"].(string)
+	if lookup, ok := rec["lookup"].(string); ok && len(presentation) > 0 {
+		for _, key := range strings.Split(lookup, ",") {
+			if _, ok := presentation[key]; !ok {
+				msg := fmt.Sprintf("lookup key %s of %s:%s is missing in presentation map", key, system, urn)
+				issues = append(issues, LintIssue{File: fname, Line: pos.line(urn, "lookup"), Message: msg})
+			}
+		}
+	}
+	if _, ok := rec["url"]; ok && IsLocalAPI(system, urn, url, localUrns) {
+		api := fmt.Sprintf("%s_%s", system, urn)
+		if _, ok := localApis[api]; !ok {
+			msg := fmt.Sprintf("local api %s has no entry in LocalAPIMap", api)
+			issues = append(issues, LintIssue{File: fname, Line: pos.line(urn, "url"), Message: msg})
+		}
+	}
+	post, err := GetPost(rec)
+	if err != nil {
+		issues = append(issues, LintIssue{File: fname, Line: pos.line(urn, "post"), Message: err.Error()})
+	}
+	dmaps, ok := rec["das_map"].([]interface{})
+	if post != nil && !postArgInMaps(post.Arg, dmaps) {
+		msg := fmt.Sprintf("post arg %s of %s:%s is not used in das_map", post.Arg, system, urn)
+		issues = append(issues, LintIssue{File: fname, Line: pos.line(urn, "post"), Message: msg})
+	}
+	if _, exists := rec["das_map"]; exists && !ok {
+		issues = append(issues, LintIssue{File: fname, Line: pos.line(urn, "das_map"), Message: "das_map should be a list"})
+	}
+	for idx, item := range dmaps {
+		line := pos.item(urn, "das_map", idx)
+		dmap, ok := item.(map[string]interface{})
+		if !ok {
+			issues = append(issues, LintIssue{File: fname, Line: line, Message: "das_map entry should be a dictionary"})
+			continue
+		}
+		if _, ok := dmap["das_key"].(string); !ok {
+			issues = append(issues, LintIssue{File: fname, Line: line, Message: "das_map entry without das_key"})
+		}
+		if _, ok := dmap["rec_key"].(string); !ok {
+			issues = append(issues, LintIssue{File: fname, Line: line, Message: "das_map entry without rec_key"})
+		}
+		if pat, ok := dmap["pattern"].(string); ok {
+			if _, err := regexp.Compile(pat); err != nil {
+				msg := fmt.Sprintf("invalid pattern %s: %v", pat, err)
+				issues = append(issues, LintIssue{File: fname, Line: line, Message: msg})
+			}
+		}
+		if _, err := GetTransform(dmap); err != nil {
+			issues = append(issues, LintIssue{File: fname, Line: line, Message: err.Error()})
+		}
+	}
+	return issues
+}
+
+// helper function to check that every example query resolves to DAS service
+func lintExamples(dmaps *DASMaps, examplesDir string) []LintIssue {
+	var issues []LintIssue
+	files, err := filepath.Glob(filepath.Join(examplesDir, "*.txt"))
+	if err != nil {
+		issues = append(issues, LintIssue{File: examplesDir, Message: err.Error()})
+		return issues
+	}
+	sort.Strings(files)
+	daskeys := dmaps.DASKeys()
+	for _, fname := range files {
+		data, err := os.ReadFile(fname)
+		if err != nil {
+			issues = append(issues, LintIssue{File: fname, Message: err.Error()})
+			continue
+		}
+		for idx, query := range strings.Split(string(data), "\n") {
+			query = strings.TrimSpace(query)
+			if query == "" || strings.HasPrefix(query, "#") {
+				continue
+			}
+			dasquery, qlerr, _ := dasql.Parse(query, "prod/global", daskeys)
+			if qlerr != "" {
+				issues = append(issues, LintIssue{File: fname, Line: idx + 1, Message: qlerr})
+				continue
+			}
+			if len(dmaps.FindServices(dasquery)) == 0 {
+				msg := fmt.Sprintf("query \"%s\" does not resolve to any DAS service", query)
+				issues = append(issues, LintIssue{File: fname, Line: idx + 1, Message: msg})
+			}
+		}
+	}
+	return issues
+}
+
+// helper function to check that POST argument is api_arg of one of das_map entries
+func postArgInMaps(arg string, dmaps []interface{}) bool {
+	for _, item := range dmaps {
+		if dmap, ok := item.(map[string]interface{}); ok && dmap["api_arg"] == arg {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package dasmaps
+
+// DAS maps POST declarations, they describe data-service APIs which accept
+// list of values in POST body, e.g. DBS fileArray API
+// post : {"url": "https://cmsweb.cern.ch:8443/dbs/prod/global/DBSReader/fileArray",
+//         "arg": "logical_file_name", "chunk": 500, "threshold": 50}
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dmwm/das2go/mongo"
+)
+
+// default number of values sent in single POST request
+const defaultPostChunk = 500
+
+// default number of values up to which GET request is used
+const defaultPostThreshold = 50
+
+// Post represents POST declaration of DAS map record. Lists of values of API
+// argument longer than threshold are sent to POST url in chunks.
+type Post struct {
+	Url       string `json:"url"`                 // API url which accepts POST requests
+	Arg       string `json:"arg"`                 // API argument which holds list of values
+	Chunk     int    `json:"chunk,omitempty"`     // number of values sent in single POST request
+	Threshold int    `json:"threshold,omitempty"` // number of values up to which GET request is used
+}
+
+// GetPost returns POST declaration of given DAS map record, records
+// without declaration return nil
+func GetPost(rec mongo.DASRecord) (*Post, error) {
+	val, ok := rec["post"]
+	if !ok || val == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var p Post
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid post %s: %v", string(data), err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Chunk == 0 {
+		p.Chunk = defaultPostChunk
+	}
+	if p.Threshold == 0 {
+		p.Threshold = defaultPostThreshold
+	}
+	return &p, nil
+}
+
+// Validate checks consistency of POST declaration
+func (p *Post) Validate() error {
+	if !strings.HasPrefix(p.Url, "http") {
+		return fmt.Errorf("post url %s should be http(s) url", p.Url)
+	}
+	if p.Arg == "" {
+		return fmt.Errorf("post declaration without arg")
+	}
+	if p.Chunk < 0 || p.Threshold < 0 {
+		return fmt.Errorf("post chunk and threshold should be positive")
+	}
+	return nil
+}
+
+// Chunks splits given values into chunks of POST requests
+func (p *Post) Chunks(values []string) [][]string {
+	size := p.Chunk
+	if size <= 0 {
+		size = defaultPostChunk
+	}
+	var out [][]string
+	for len(values) > size {
+		out = append(out, values[:size])
+		values = values[size:]
+	}
+	if len(values) > 0 {
+		out = append(out, values)
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package dasmaps
+
+// DAS maps transformation rules, they describe how values of DAS keys are
+// converted into data-service API arguments, e.g.
+// {"das_key": "date", "rec_key": "date", "api_arg": "cdate",
+//  "transform": {"range": ["min_cdate", "max_cdate"], "offset": 86400, "format": "unix"}}
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Transform represents transformation rules of DAS map entry. Rules are applied
+// to every value in the following order: values/default, format and wrap.
+type Transform struct {
+	Arg     string            `json:"arg,omitempty"`     // API argument to use instead of api_arg
+	Values  map[string]string `json:"values,omitempty"`  // mapping of lower-case values without wildcards
+	Default string            `json:"default,omitempty"` // value to use when no mapping matches
+	Format  string            `json:"format,omitempty"`  // value format: unix, conddb, dashboard, runregistry, lower, upper
+	Wrap    string            `json:"wrap,omitempty"`    // printf template to wrap value, e.g. [%s]
+	Range   []string          `json:"range,omitempty"`   // pair of API arguments list of values is split into
+	Offset  int64             `json:"offset,omitempty"`  // seconds added to single value to form end of range
+	Join    string            `json:"join,omitempty"`    // separator used to join list of values
+}
+
+// list of supported value formats
+var transformFormats = map[string]func(string) string{
+	"unix":        func(v string) string { return fmt.Sprintf("%d", utils.UnixTime(v)) },
+	"conddb":      utils.ConddbTime,
+	"dashboard":   utils.DashboardTime,
+	"runregistry": utils.RunRegistryTime,
+	"lower":       strings.ToLower,
+	"upper":       strings.ToUpper,
+}
+
+// GetTransform returns transformation rules of given DAS map entry, entries
+// without rules return nil
+func GetTransform(dmap mongo.DASRecord) (*Transform, error) {
+	val, ok := dmap["transform"]
+	if !ok || val == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var t Transform
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&t); err != nil {
+		return nil, fmt.Errorf("invalid transform %s: %v", string(data), err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Validate checks consistency of transformation rules
+func (t *Transform) Validate() error {
+	if _, ok := transformFormats[t.Format]; t.Format != "" && !ok {
+		return fmt.Errorf("unknown transform format %s", t.Format)
+	}
+	if t.Wrap != "" && strings.Count(t.Wrap, "%s") != 1 {
+		return fmt.Errorf("transform wrap %s should contain single %%s", t.Wrap)
+	}
+	if t.Range != nil && len(t.Range) != 2 {
+		return fmt.Errorf("transform range %v should contain two API arguments", t.Range)
+	}
+	if t.Offset != 0 && t.Range == nil {
+		return fmt.Errorf("transform offset requires range")
+	}
+	if t.Join != "" && t.Range != nil {
+		return fmt.Errorf("transform join can not be used with range")
+	}
+	return nil
+}
+
+// helper function to apply value rules to single value
+func (t *Transform) value(val string) string {
+	if t.Values != nil || t.Default != "" {
+		key := strings.ToLower(strings.Replace(val, "*", "", -1))
+		if v, ok := t.Values[key]; ok {
+			val = v
+		} else if t.Default != "" {
+			val = t.Default
+		}
+	}
+	if f, ok := transformFormats[t.Format]; ok {
+		val = f(val)
+	}
+	if t.Wrap != "" {
+		val = fmt.Sprintf(t.Wrap, val)
+	}
+	return val
+}
+
+// helper function to find end of the range for single value, the end keeps
+// representation of the value, i.e. DAS date or unix time
+func (t *Transform) rangeEnd(val string) string {
+	if t.Offset == 0 {
+		return val
+	}
+	ts := utils.UnixTime(val) + t.Offset
+	if len(val) == 10 {
+		return fmt.Sprintf("%d", ts)
+	}
+	return utils.Unix2DASTime(ts)
+}
+
+// Apply converts value of DAS key, either string or list of strings, into
+// API arguments. The arg is api_arg of DAS map entry. Range rule splits list
+// of values into pair of API arguments, single value is split only if range
+// has offset, otherwise it is passed as is.
+func (t *Transform) Apply(arg string, val interface{}) url.Values {
+	var vals []string
+	switch v := val.(type) {
+	case string:
+		vals = []string{v}
+	case []string:
+		vals = v
+	}
+	out := url.Values{}
+	if len(vals) == 0 {
+		return out
+	}
+	if t.Arg != "" {
+		arg = t.Arg
+	}
+	if len(t.Range) == 2 && len(vals) == 1 && t.Offset == 0 {
+		out.Add(arg, vals[0])
+		return out
+	}
+	if len(t.Range) == 2 {
+		start, end := vals[0], vals[len(vals)-1]
+		if len(vals) == 1 {
+			end = t.rangeEnd(start)
+		}
+		out.Add(t.Range[0], t.value(start))
+		out.Add(t.Range[1], t.value(end))
+		return out
+	}
+	var values []string
+	for _, v := range vals {
+		values = append(values, t.value(v))
+	}
+	if t.Join != "" {
+		out.Add(arg, strings.Join(values, t.Join))
+		return out
+	}
+	out[arg] = values
+	return out
+}
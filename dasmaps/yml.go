@@ -0,0 +1,205 @@
+package dasmaps
+
+// DAS maps YAML reader, it converts DAS map files, e.g. maps/dbs3.yml, into
+// DAS map records, i.e. the same records DAS server loads from mapping database
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dmwm/das2go/mongo"
+)
+
+// regular expressions used to convert DAS map values into JSON
+var mapKeyPattern = regexp.MustCompile(`^([A-Za-z_]\w*)\s*:\s*(.*)$`)
+var trailingCommaPattern = regexp.MustCompile(`,(\s*[\]}])`)
+var bareKeyPattern = regexp.MustCompile(`(?m)^(\s*)([A-Za-z_]\w*)\s*:`)
+
+// helper function to scan given text and return brackets depth of DAS map value
+func scanDepth(text string, depth int) int {
+	quote := false
+	escape := false
+	for _, c := range text {
+		if escape {
+			escape = false
+			continue
+		}
+		switch {
+		case c == '\\' && quote:
+			escape = true
+		case c == '"':
+			quote = !quote
+		case quote:
+		case c == '#':
+			return depth // rest of the line is a comment
+		case c == '[' || c == '{':
+			depth += 1
+		case c == ']' || c == '}':
+			depth -= 1
+		}
+	}
+	return depth
+}
+
+// helper function to convert python like literals used in DAS maps into JSON
+func jsonLiteral(val string) string {
+	var out strings.Builder
+	quote := false
+	escape := false
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		if escape {
+			escape = false
+			out.WriteByte(c)
+			continue
+		}
+		if c == '\\' && quote && i+1 < len(val) && val[i+1] == '\n' {
+			// line continuation within string
+			i += 1
+			continue
+		}
+		if c == '\\' && quote {
+			escape = true
+		} else if c == '"' {
+			quote = !quote
+		} else if c == '#' && !quote {
+			// skip comment till the end of line
+			for i+1 < len(val) && val[i+1] != '\n' {
+				i += 1
+			}
+			continue
+		} else if !quote {
+			replaced := false
+			for lit, rep := range map[string]string{"True": "true", "False": "false", "None": "null"} {
+				if strings.HasPrefix(val[i:], lit) {
+					out.WriteString(rep)
+					i += len(lit) - 1
+					replaced = true
+					break
+				}
+			}
+			if replaced {
+				continue
+			}
+		}
+		out.WriteByte(c)
+	}
+	res := trailingCommaPattern.ReplaceAllString(out.String(), "$1")
+	return bareKeyPattern.ReplaceAllString(res, `$1"$2":`)
+}
+
+// helper function to convert DAS map value into Go value
+func mapValue(val string) (interface{}, error) {
+	val = strings.TrimSpace(val)
+	if strings.HasPrefix(val, "[") || strings.HasPrefix(val, "{") {
+		var out interface{}
+		err := json.Unmarshal([]byte(jsonLiteral(val)), &out)
+		return out, err
+	}
+	if strings.HasPrefix(val, "\"") {
+		if idx := strings.Index(val[1:], "\""); idx >= 0 {
+			return val[1 : idx+1], nil
+		}
+		return nil, fmt.Errorf("unterminated string %s", val)
+	}
+	if idx := strings.Index(val, " #"); idx >= 0 {
+		val = strings.TrimSpace(val[:idx])
+	}
+	var num json.Number
+	if err := json.Unmarshal([]byte(val), &num); err == nil {
+		if v, err := num.Int64(); err == nil {
+			return int(v), nil
+		}
+	}
+	return val, nil
+}
+
+// ReadYamlFile reads DAS map file and appends its records to DAS maps. The
+// first document of the file describes the system and its keys, e.g. system
+// and format, are added to every service record, while notations and
+// presentation documents become notation and presentation records. It
+// returns problems found while reading the file.
+func (m *DASMaps) ReadYamlFile(fname string) []LintIssue {
+	var issues []LintIssue
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		issues = append(issues, LintIssue{File: fname, Message: err.Error()})
+		return issues
+	}
+	header := make(mongo.DASRecord)
+	doc := make(mongo.DASRecord)
+	addDoc := func() {
+		switch {
+		case doc["urn"] != nil:
+			for key, val := range header {
+				if _, ok := doc[key]; !ok {
+					doc[key] = val
+				}
+			}
+			doc["type"] = "service"
+		case doc["notations"] != nil:
+			doc["system"] = header["system"]
+			doc["type"] = "notation"
+		case doc["presentation"] != nil:
+			doc["type"] = "presentation"
+		case doc["system"] != nil:
+			header = doc
+		}
+		if doc["type"] != nil {
+			m.records = append(m.records, doc)
+		}
+		doc = make(mongo.DASRecord)
+	}
+	var key, value string
+	var kline, depth int
+	for idx, text := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(text)
+		if key == "" {
+			if trimmed == "---" {
+				addDoc()
+				continue
+			}
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			match := mapKeyPattern.FindStringSubmatch(trimmed)
+			if len(match) != 3 {
+				msg := fmt.Sprintf("unable to parse line: %s", trimmed)
+				issues = append(issues, LintIssue{File: fname, Line: idx + 1, Message: msg})
+				continue
+			}
+			key, value, kline = match[1], match[2], idx+1
+			depth = scanDepth(value, 0)
+		} else {
+			// we're inside multi-line value
+			if strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			value += "\n" + text
+			depth = scanDepth(text, depth)
+		}
+		if depth > 0 {
+			continue
+		}
+		val, err := mapValue(value)
+		if err != nil {
+			msg := fmt.Sprintf("unable to parse value of %s: %v", key, err)
+			issues = append(issues, LintIssue{File: fname, Line: kline, Message: msg})
+		} else {
+			doc[key] = val
+		}
+		key = ""
+	}
+	if key != "" {
+		msg := fmt.Sprintf("unbalanced brackets in value of %s", key)
+		issues = append(issues, LintIssue{File: fname, Line: kline, Message: msg})
+	}
+	addDoc()
+	return issues
+}
@@ -30,12 +30,14 @@ type DASQuery struct {
 	Fields       []string            `json:"fields"`
 	Pipe         string              `json:"pipe"`
 	Instance     string              `json:"instance"`
+	Instances    []string            `json:"instances,omitempty"`
 	Detail       bool                `json:"detail"`
 	System       string              `json:"system"`
 	Filters      map[string][]string `json:"filters"`
 	Aggregators  [][]string          `json:"aggregators"`
 	Error        string              `json:"error"`
 	Time         int64               `json:"tstamp"`
+	Suggestions  []string            `json:"suggestions,omitempty"`
 }
 
 // String method implements own formatter using DASQuery rather then *DASQuery, since
@@ -121,6 +123,26 @@ func qlError(query string, idx int, msg string) (string, string) {
 	log.Println("ERROR", fullmsg)
 	return fullmsg, posLine(query, idx)
 }
+
+// helper function to form "did you mean" part of DAS QL error message
+func didYouMean(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean: %s?", strings.Join(keys, ", "))
+}
+
+// default maximum number of values in DAS array
+const defaultMaxArraySize = 10000
+
+// MaxArraySize returns maximum number of values allowed in DAS array
+func MaxArraySize() int {
+	if config.Current().MaxArraySize > 0 {
+		return config.Current().MaxArraySize
+	}
+	return defaultMaxArraySize
+}
+
 func parseArray(rquery string, odx int, oper string, val string) ([]string, int, string, string) {
 	qlerr := ""
 	posLine := ""
@@ -135,8 +157,14 @@ func parseArray(rquery string, odx int, oper string, val string) ([]string, int,
 	idx := strings.Index(query, "[")
 	jdx := strings.Index(query, "]")
 	vals := strings.Split(string(query[idx+1:jdx]), ",")
+	maxSize := MaxArraySize()
 	var values []string
 	if oper == "in" {
+		if len(vals) > maxSize {
+			msg := fmt.Sprintf("DAS array has %d values, maximum is %d", len(vals), maxSize)
+			qlerr, posLine = qlError(rquery, odx, msg)
+			return out, -1, qlerr, posLine
+		}
 		values = vals
 	} else if oper == "between" {
 		minr, e1 := strconv.Atoi(strings.TrimSpace(vals[0]))
@@ -149,6 +177,11 @@ func parseArray(rquery string, odx int, oper string, val string) ([]string, int,
 			qlerr, posLine = qlError(rquery, odx, fmt.Sprintf("%v", e2))
 			return out, -1, qlerr, posLine
 		}
+		if maxr-minr >= maxSize {
+			msg := fmt.Sprintf("DAS range [%d, %d] exceeds maximum of %d values", minr, maxr, maxSize)
+			qlerr, posLine = qlError(rquery, odx, msg)
+			return out, -1, qlerr, posLine
+		}
 		for v := minr; v <= maxr; v++ {
 			values = append(values, fmt.Sprintf("%d", v))
 		}
@@ -227,8 +260,8 @@ func parseLastValue(val string) []string {
 
 // Validate DBS instance
 func validateDBSInstance(inst string) error {
-	if len(config.Config.DbsInstances) != 0 && !utils.InList(inst, config.Config.DbsInstances) {
-		return errors.New(fmt.Sprintf("Invalid DBS instance: %s, dbs instances=%v", inst, config.Config.DbsInstances))
+	if len(config.Current().DbsInstances) != 0 && !utils.InList(inst, config.Current().DbsInstances) {
+		return errors.New(fmt.Sprintf("Invalid DBS instance: %s, dbs instances=%v", inst, config.Current().DbsInstances))
 	}
 	return nil
 }
@@ -290,13 +323,18 @@ func Parse(query, inst string, daskeys []string) (DASQuery, string, string) {
 		if nval != nan && (nval == "," || utils.InList(nval, daskeys) == true) {
 			if utils.InList(val, daskeys) {
 				fields = append(fields, val)
+			} else {
+				rec.Suggestions = utils.ClosestMatches(val, daskeys, 3)
+				qlerr, posLine = qlError(relaxedQuery, idx, "Wrong DAS key: "+val+didYouMean(rec.Suggestions))
+				return rec, qlerr, posLine
 			}
 			idx += 1
 			continue
 		} else if utils.InList(nval, operators()) {
 			firstNextNextValue := string(nnval[0])
 			if !utils.InList(val, append(daskeys, specials...)) {
-				qlerr, posLine = qlError(relaxedQuery, idx, "Wrong DAS key: "+val)
+				rec.Suggestions = utils.ClosestMatches(val, append(daskeys, specials...), 3)
+				qlerr, posLine = qlError(relaxedQuery, idx, "Wrong DAS key: "+val+didYouMean(rec.Suggestions))
 				return rec, qlerr, posLine
 			}
 			if firstNextNextValue == "[" {
@@ -328,11 +366,21 @@ func Parse(query, inst string, daskeys []string) (DASQuery, string, string) {
 				idx += 1
 				continue
 			} else {
-				qlerr, posLine = qlError(relaxedQuery, idx, "Not a DAS key")
+				rec.Suggestions = utils.ClosestMatches(val, daskeys, 3)
+				qlerr, posLine = qlError(relaxedQuery, idx, "Not a DAS key"+didYouMean(rec.Suggestions))
 				return rec, qlerr, posLine
 			}
 		} else {
-			qlerr, posLine = qlError(relaxedQuery, idx, "unable to parse DAS query")
+			msg := "unable to parse DAS query"
+			if utils.InList(val, daskeys) && !utils.InList(nval, append(daskeys, specials...)) {
+				// next value is likely misspelled DAS key
+				rec.Suggestions = utils.ClosestMatches(nval, append(daskeys, specials...), 3)
+				if len(rec.Suggestions) > 0 {
+					msg = "Wrong DAS key: " + nval + didYouMean(rec.Suggestions)
+					idx += 1
+				}
+			}
+			qlerr, posLine = qlError(relaxedQuery, idx, msg)
 			return rec, qlerr, posLine
 		}
 
@@ -357,11 +405,31 @@ func Parse(query, inst string, daskeys []string) (DASQuery, string, string) {
 	if inst == "" && utils.WEBSERVER == 0 {
 		inst = "prod/global"
 	}
-	// remove instance from spec
-	instance := spec["instance"]
-	if instance != nil {
-		inst = instance.(string)
-		delete(spec, "instance")
+	// remove instance from spec, instance=* or instance in [...] fan-out
+	// query to multiple DBS instances
+	var instances []string
+	switch v := spec["instance"].(type) {
+	case string:
+		if v == "*" {
+			instances = config.Current().DbsInstances
+			if len(instances) == 0 {
+				qlerror = "No DBS instances are configured for instance=*"
+			}
+		} else {
+			inst = v
+		}
+	case []string:
+		instances = v
+	}
+	delete(spec, "instance")
+	if len(instances) == 1 {
+		inst = instances[0]
+		instances = nil
+	}
+	hashInst := inst
+	if len(instances) > 1 {
+		inst = instances[0]
+		hashInst = strings.Join(instances, ",")
 	}
 
 	// remove detail from spec
@@ -391,9 +459,10 @@ func Parse(query, inst string, daskeys []string) (DASQuery, string, string) {
 	rec.relaxedQuery = relaxedQuery
 	rec.Spec = spec
 	rec.Fields = fields
-	rec.Qhash = qhash(relaxedQuery, inst)
+	rec.Qhash = qhash(relaxedQuery, hashInst)
 	rec.Pipe = pipe
 	rec.Instance = inst
+	rec.Instances = instances
 	rec.Detail = detail
 	rec.Filters = filters
 	rec.Aggregators = aggregators
@@ -402,9 +471,52 @@ func Parse(query, inst string, daskeys []string) (DASQuery, string, string) {
 	if err := validateDBSInstance(inst); err != nil {
 		qlerror = fmt.Sprintf("Invalid DBS instance %s, error %v", inst, err)
 	}
+	for _, dbsInst := range instances {
+		if err := validateDBSInstance(dbsInst); err != nil {
+			qlerror = fmt.Sprintf("Invalid DBS instance %s, error %v", dbsInst, err)
+		}
+	}
 	return rec, qlerror, pLine
 }
 
+// list of operators supported by grep conditions
+var grepOperators = []string{">", "<", ">=", "<=", "=", "!=", "~", "in"}
+
+// helper function to parse grep condition which starts at given position of
+// pipe tokens, e.g. file.size > 2GB, file.name ~ RAW or file.nevents in [1, 2],
+// it returns condition and number of consumed tokens
+func grepCondition(arr []string, idx int) (string, int) {
+	qlen := len(arr)
+	if idx >= qlen {
+		return "_NA_", 1
+	}
+	key := arr[idx]
+	if idx+1 >= qlen || !utils.InList(arr[idx+1], grepOperators) {
+		return key, 1
+	}
+	oper := arr[idx+1]
+	jdx := idx + 2
+	var vals []string
+	if oper == "in" {
+		for jdx < qlen && arr[jdx] != "]" && arr[jdx] != "|" {
+			if arr[jdx] != "[" && arr[jdx] != "," && arr[jdx] != "" {
+				vals = append(vals, arr[jdx])
+			}
+			jdx += 1
+		}
+		if jdx < qlen && arr[jdx] == "]" {
+			jdx += 1
+		}
+		return fmt.Sprintf("%s in [%s]", key, strings.Join(vals, ",")), jdx - idx
+	}
+	// value may be split by relaxed parser, e.g. regex with brackets, we join it back
+	for jdx < qlen && arr[jdx] != "," && arr[jdx] != "|" {
+		vals = append(vals, arr[jdx])
+		jdx += 1
+	}
+	return fmt.Sprintf("%s%s%s", key, oper, strings.Join(vals, "")), jdx - idx
+}
+
 func parsePipe(query, pipe string) (map[string][]string, [][]string, string, string) {
 	qlerr := ""
 	pLine := ""
@@ -413,10 +525,9 @@ func parsePipe(query, pipe string) (map[string][]string, [][]string, string, str
 	if !strings.Contains(query, "|") {
 		return filters, aggregators, qlerr, pLine
 	}
-	var item, next, nnext, nnnext, cfilter string
+	var item, next, nnext, cfilter string
 	nan := "_NA_"
-	aggrs := []string{"sum", "min", "max", "avg", "median", "count"}
-	opers := []string{">", "<", ">=", "<=", "=", "!="}
+	aggrs := utils.AggregatorNames()
 	idx := 0
 	arr := strings.Split(pipe, " ")
 	qlen := len(arr)
@@ -438,24 +549,18 @@ func parsePipe(query, pipe string) (map[string][]string, [][]string, string, str
 		} else {
 			nnext = nan
 		}
-		if idx+3 < qlen {
-			nnnext = arr[idx+3]
-		} else {
-			nnnext = nan
-		}
 		if item == "grep" {
 			cfilter = item
-			filters["grep"] = append(filters[item], next)
-			idx += 2
+			cond, step := grepCondition(arr, idx+1)
+			filters["grep"] = append(filters[item], cond)
+			idx += 1 + step
 		} else if item == "," {
 			if cfilter == "grep" {
-				if utils.InList(nnext, opers) {
-					val := fmt.Sprintf("%s%s%s", next, nnext, nnnext)
-					filters[cfilter] = append(filters[cfilter], val)
-					idx += 2
-				} else {
-					filters[cfilter] = append(filters[cfilter], next)
-				}
+				cond, step := grepCondition(arr, idx+1)
+				filters[cfilter] = append(filters[cfilter], cond)
+				idx += 1 + step
+			} else if cfilter == "sort" {
+				filters[cfilter] = append(filters[cfilter], next)
 				idx += 2
 			} else {
 				idx += 1
@@ -472,15 +577,27 @@ func parsePipe(query, pipe string) (map[string][]string, [][]string, string, str
 			cfilter = item
 			left := next
 			val := nnext
-			right := nnnext
-			if left != "(" || right != ")" || idx+3 >= qlen {
+			if left != "(" || idx+3 >= qlen {
 				msg := "Wrong aggregator representation, please check your query"
 				qlerr, pLine = qlError(pipe, idx, msg)
 				return filters, aggregators, qlerr, pLine
 			}
+			// aggregator may have additional arguments, e.g. histogram(file.size, 20)
 			pair := []string{item, val}
+			jdx := idx + 3
+			for jdx < qlen && arr[jdx] != ")" {
+				if arr[jdx] != "," {
+					pair = append(pair, arr[jdx])
+				}
+				jdx += 1
+			}
+			if jdx >= qlen {
+				msg := "Wrong aggregator representation, please check your query"
+				qlerr, pLine = qlError(pipe, idx, msg)
+				return filters, aggregators, qlerr, pLine
+			}
 			aggregators = append(aggregators, pair)
-			idx += 3
+			idx = jdx + 1
 		} else {
 			idx += 1
 		}
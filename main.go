@@ -8,9 +8,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
 	"time"
 
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/services"
 	"github.com/dmwm/das2go/utils"
 	"github.com/dmwm/das2go/web"
 )
@@ -29,6 +32,14 @@ func main() {
 	flag.BoolVar(&version, "version", false, "Show version")
 	var config string
 	flag.StringVar(&config, "config", "dasconfig.json", "DAS server config JSON file")
+	var mapsDir string
+	flag.StringVar(&mapsDir, "mapsDir", "maps", "DAS maps area used by maps lint command")
+	var examplesDir string
+	flag.StringVar(&examplesDir, "examplesDir", "examples", "DAS examples area used by maps lint command")
+	flag.Usage = func() {
+		fmt.Println("Usage: das2go [options] [maps lint]")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	utils.VERSION = info()
 	utils.WEBSERVER = 1
@@ -36,5 +47,30 @@ func main() {
 		fmt.Println("DAS version:", info())
 		return
 	}
+	if args := flag.Args(); len(args) == 2 && args[0] == "maps" && args[1] == "lint" {
+		os.Exit(lintMaps(mapsDir, examplesDir))
+	}
 	web.Server(config)
 }
+
+// helper function to lint DAS maps, it prints all found problems and
+// returns exit code of lint command
+func lintMaps(mapsDir, examplesDir string) int {
+	utils.WEBSERVER = 0
+	issues := dasmaps.LintMaps(mapsDir, examplesDir, services.LocalAPIMap(), services.DASLocalAPIs())
+	var nerr, nwarn int
+	for _, issue := range issues {
+		fmt.Println(issue)
+		if issue.Warning {
+			nwarn += 1
+		} else {
+			nerr += 1
+		}
+	}
+	if nerr > 0 {
+		fmt.Printf("found %d problem(s) and %d warning(s) in DAS maps\n", nerr, nwarn)
+		return 1
+	}
+	fmt.Printf("DAS maps are consistent, %d warning(s)\n", nwarn)
+	return 0
+}
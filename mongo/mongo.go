@@ -170,7 +170,7 @@ type MongoConnection struct {
 func (m *MongoConnection) Connect() *mgo.Session {
 	var err error
 	if m.Session == nil {
-		m.Session, err = mgo.Dial(config.Config.Uri)
+		m.Session, err = mgo.Dial(config.Current().Uri)
 		if err != nil {
 			log.Fatal("ERROR ", err)
 		}
@@ -254,7 +254,8 @@ func sel(q ...string) (r bson.M) {
 	return
 }
 
-// GetFilteredSorted get records from MongoDB filtered and sorted by given key
+// GetFilteredSorted get records from MongoDB filtered and sorted by given key,
+// only given fields are returned if they are provided
 func GetFilteredSorted(dbname, collname string, spec bson.M, fields, skeys []string, idx, limit int) []DASRecord {
 
 	// defer function profiler
@@ -264,27 +265,52 @@ func GetFilteredSorted(dbname, collname string, spec bson.M, fields, skeys []str
 	s := _Mongo.Connect()
 	defer s.Close()
 	c := s.DB(dbname).C(collname)
-	var err error
-	fields = append(fields, "das") // always extract das part of the record
+	query := c.Find(spec).Skip(idx)
 	if limit > 0 {
-		if len(skeys) > 0 {
-			err = c.Find(spec).Skip(idx).Limit(limit).Select(sel(fields...)).Sort(skeys...).All(&out)
-		} else {
-			err = c.Find(spec).Skip(idx).Limit(limit).Select(sel(fields...)).All(&out)
-		}
-	} else {
-		if len(skeys) > 0 {
-			err = c.Find(spec).Select(sel(fields...)).Sort(skeys...).All(&out)
-		} else {
-			err = c.Find(spec).Select(sel(fields...)).All(&out)
-		}
+		query = query.Limit(limit)
 	}
-	if err != nil {
+	if len(fields) > 0 {
+		fields = append(fields, "das") // always extract das part of the record
+		query = query.Select(sel(fields...))
+	}
+	if len(skeys) > 0 {
+		query = query.Sort(skeys...)
+	}
+	if err := query.All(&out); err != nil {
 		log.Println("ERROR: unable to fetch from MOngoDB", time.Now(), err)
 	}
 	return out
 }
 
+// GetPage returns up to limit records (all records if limit is not positive)
+// matching given spec and sorted by given keys, only given fields are
+// returned if they are provided
+func GetPage(dbname, collname string, spec bson.M, fields, skeys []string, limit int) []DASRecord {
+
+	// defer function profiler
+	defer utils.MeasureTime("mongo/GetPage")()
+
+	out := []DASRecord{}
+	s := _Mongo.Connect()
+	defer s.Close()
+	c := s.DB(dbname).C(collname)
+	query := c.Find(spec)
+	if len(fields) > 0 {
+		fields = append(fields, "das") // always extract das part of the record
+		query = query.Select(sel(fields...))
+	}
+	if len(skeys) > 0 {
+		query = query.Sort(skeys...)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.All(&out); err != nil {
+		log.Println("ERROR: unable to get page of records", err)
+	}
+	return out
+}
+
 // Update inplace for given spec
 func Update(dbname, collname string, spec, newdata bson.M) {
 
@@ -300,6 +326,21 @@ func Update(dbname, collname string, spec, newdata bson.M) {
 	}
 }
 
+// UpdateAll updates all records matching given spec
+func UpdateAll(dbname, collname string, spec, update bson.M) {
+
+	// defer function profiler
+	defer utils.MeasureTime("mongo/UpdateAll")()
+
+	s := _Mongo.Connect()
+	defer s.Close()
+	c := s.DB(dbname).C(collname)
+	_, err := c.UpdateAll(spec, update)
+	if err != nil {
+		log.Printf("ERROR: unable to update records, spec %v, update %+v, error %v\n", spec, update, err)
+	}
+}
+
 // Count gets number records from MongoDB
 func Count(dbname, collname string, spec bson.M) int {
 
@@ -341,8 +382,8 @@ func Bytes(dbname, collname string, spec bson.M) int {
 	return nrec * len(data)
 }
 
-// Remove records from MongoDB
-func Remove(dbname, collname string, spec bson.M) {
+// Remove records from MongoDB, it returns number of removed records
+func Remove(dbname, collname string, spec bson.M) int {
 
 	// defer function profiler
 	defer utils.MeasureTime("mongo/Remove")()
@@ -350,10 +391,39 @@ func Remove(dbname, collname string, spec bson.M) {
 	s := _Mongo.Connect()
 	defer s.Close()
 	c := s.DB(dbname).C(collname)
-	_, err := c.RemoveAll(spec)
+	info, err := c.RemoveAll(spec)
 	if err != nil && err != mgo.ErrNotFound {
 		log.Printf("ERROR: untable to remove records, spec %+v, error %v\n", spec, err)
 	}
+	if info == nil {
+		return 0
+	}
+	return info.Removed
+}
+
+// Size returns size of given collection in bytes
+func Size(dbname, collname string) int {
+
+	// defer function profiler
+	defer utils.MeasureTime("mongo/Size")()
+
+	s := _Mongo.Connect()
+	defer s.Close()
+	var stats bson.M
+	err := s.DB(dbname).Run(bson.D{{Name: "collStats", Value: collname}}, &stats)
+	if err != nil {
+		log.Printf("ERROR: unable to get collection stats, collection %s.%s, error %v\n", dbname, collname, err)
+		return 0
+	}
+	switch v := stats["size"].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
 }
 
 // LoadJsonData stream from series of bytes
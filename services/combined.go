@@ -19,6 +19,19 @@ import (
 	"github.com/dmwm/das2go/utils"
 )
 
+// register local APIs of this module
+func init() {
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "dataset4site_release", Required: []string{"release", "site"}, Description: "datasets for given release and site", Function: "Dataset4SiteRelease", Call: LocalAPIs{}.Dataset4SiteRelease})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "dataset4site_release_parent", Required: []string{"release", "site", "parent"}, Description: "datasets for given release, site and parent", Function: "Dataset4SiteReleaseParent", Call: LocalAPIs{}.Dataset4SiteReleaseParent})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "child4site_release_dataset", Required: []string{"release", "site", "dataset"}, Description: "child datasets for given release, site and dataset", Function: "Child4SiteReleaseDataset", Call: LocalAPIs{}.Child4SiteReleaseDataset})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "site4block", Required: []string{"block"}, Description: "sites for given block", Function: "Site4Block", Call: LocalAPIs{}.Site4Block})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "site4dataset", Required: []string{"dataset"}, Description: "sites for given dataset", Function: "Site4Dataset", Call: LocalAPIs{}.Site4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "site4dataset_pct", Required: []string{"dataset"}, Description: "sites for given dataset along with replica completion", Function: "Site4DatasetPct", Call: LocalAPIs{}.Site4DatasetPct})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "lumi4dataset", Required: []string{"dataset"}, Description: "lumis for given dataset", Function: "Lumi4Dataset", Call: LocalAPIs{}.Lumi4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "files4dataset_runs_site", Required: []string{"dataset", "run", "site"}, Description: "files for given dataset, runs and site", Function: "Files4DatasetRunsSite", Call: LocalAPIs{}.Files4DatasetRunsSite})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "files4block_runs_site", Required: []string{"block", "run", "site"}, Description: "files for given block, runs and site", Function: "Files4BlockRunsSite", Call: LocalAPIs{}.Files4BlockRunsSite})
+}
+
 // global variables used in this module
 var _phedexNodes PhedexNodes
 
@@ -197,11 +210,11 @@ func getBlockNameFromUrl(rurl string) string {
 			blk = arr[0]
 		}
 	} else if strings.Contains(rurl, "dids/cms/") {
-		// url/dids/cms/blk/dids
+		// url/dids/cms/blk/dids or url/dids/cms/blk/files
 		parts := strings.Split(rurl, "dids/cms/")
 		if len(parts) > 1 {
 			arr := strings.Split(parts[1], "/dids")
-			blk = arr[0]
+			blk = strings.TrimSuffix(arr[0], "/files")
 		}
 	}
 	b, err := url.QueryUnescape(blk)
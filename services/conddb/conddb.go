@@ -0,0 +1,39 @@
+package conddb
+
+// DAS service module
+// CondDB service plugin
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"strings"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Service represents CondDB data-service
+type Service struct {
+	services.Base
+}
+
+func init() {
+	srv := &Service{services.Base{Name: "conddb", Pattern: "conddb", ErrorCode: utils.CondDBError, ErrorName: utils.CondDBErrorName}}
+	services.RegisterService(srv)
+}
+
+// Request forms CondDB URL for given DAS query and DAS map
+func (s *Service) Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string) {
+	furl := services.FormUrlCall(dasquery, dasmap, nil)
+	// remove Runs= empty parameter since it leads to an error
+	furl = strings.Replace(furl, "Runs=&", "", -1)
+	return furl, ""
+}
+
+// Decode converts CondDB response into DAS records
+func (s *Service) Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord {
+	return services.CondDBUnmarshal(api, data)
+}
@@ -0,0 +1,147 @@
+package services
+
+// DAS service module
+// consistency module, it compares DBS and Rucio file catalogs for given
+// dataset or block
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+)
+
+// register local APIs of this module
+func init() {
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "consistency4dataset", Required: []string{"dataset"}, Description: "DBS and Rucio file consistency for given dataset", Function: "Consistency4Dataset", Call: LocalAPIs{}.Consistency4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "combined", Urn: "consistency4block", Required: []string{"block"}, Description: "DBS and Rucio file consistency for given block", Function: "Consistency4Block", Call: LocalAPIs{}.Consistency4Block})
+}
+
+// Consistency4Dataset returns DBS and Rucio consistency report for blocks of given dataset
+func (LocalAPIs) Consistency4Dataset(dasquery dasql.DASQuery) []mongo.DASRecord {
+	return ConsistencyReport(dasquery)
+}
+
+// Consistency4Block returns DBS and Rucio consistency report for given block
+func (LocalAPIs) Consistency4Block(dasquery dasql.DASQuery) []mongo.DASRecord {
+	return ConsistencyReport(dasquery)
+}
+
+// ConsistencyReport compares DBS and Rucio files of dataset or block of given
+// DAS query and returns one consistency record per block
+func ConsistencyReport(dasquery dasql.DASQuery) []mongo.DASRecord {
+	var out []mongo.DASRecord
+	inst := dasquery.Instance
+	blocks := findBlocks(dasquery)
+	var dbsUrls, rucioUrls []string
+	for _, blk := range blocks {
+		dbsUrls = append(dbsUrls, fmt.Sprintf("%s/files?block_name=%s&detail=True", DBSUrl(inst), url.QueryEscape(blk)))
+		rucioUrls = append(rucioUrls, fmt.Sprintf("%s/dids/cms/%s/files", RucioUrl(), url.QueryEscape(blk)))
+	}
+	dbsFiles := make(map[string][]mongo.DASRecord)
+	for _, rec := range processUrls(dasquery, "dbs3", "files", dbsUrls) {
+		if blk, ok := rec["block_name"].(string); ok {
+			dbsFiles[blk] = append(dbsFiles[blk], rec)
+		}
+	}
+	rucioFiles := make(map[string][]mongo.DASRecord)
+	for _, rec := range processUrls(dasquery, "rucio", "full_record", rucioUrls) {
+		if rurl, ok := rec["url"].(string); ok {
+			blk := getBlockNameFromUrl(rurl)
+			rucioFiles[blk] = append(rucioFiles[blk], rec)
+		}
+	}
+	for _, blk := range blocks {
+		out = append(out, ConsistencyRecord(blk, dbsFiles[blk], rucioFiles[blk]))
+	}
+	return out
+}
+
+// helper function to normalize adler32 checksum, DBS does not always keep leading zeros
+func adler32(val interface{}) string {
+	sum, _ := val.(string)
+	return strings.TrimLeft(strings.ToLower(sum), "0")
+}
+
+// helper function to create mismatch record
+func mismatch(fname string, dbsValue, rucioValue interface{}) mongo.DASRecord {
+	return mongo.DASRecord{"file": fname, "dbs": dbsValue, "rucio": rucioValue}
+}
+
+// ConsistencyRecord compares DBS and Rucio files of given block. DBS records
+// are expected to carry logical_file_name, file_size, adler32 and is_file_valid
+// attributes, while Rucio ones name, bytes and adler32.
+func ConsistencyRecord(block string, dbsFiles, rucioFiles []mongo.DASRecord) mongo.DASRecord {
+	dbs := make(map[string]mongo.DASRecord)
+	for _, rec := range dbsFiles {
+		if fname, ok := rec["logical_file_name"].(string); ok {
+			dbs[fname] = rec
+		}
+	}
+	rucio := make(map[string]mongo.DASRecord)
+	for _, rec := range rucioFiles {
+		if fname, ok := rec["name"].(string); ok {
+			rucio[fname] = rec
+		}
+	}
+	missingInRucio := []string{}
+	missingInDBS := []string{}
+	invalidInDBS := []string{}
+	sizeMismatch := []mongo.DASRecord{}
+	checksumMismatch := []mongo.DASRecord{}
+	for fname := range dbs {
+		if _, ok := rucio[fname]; !ok {
+			missingInRucio = append(missingInRucio, fname)
+		}
+	}
+	for fname, rrec := range rucio {
+		drec, ok := dbs[fname]
+		if !ok {
+			missingInDBS = append(missingInDBS, fname)
+			continue
+		}
+		if diffValue(drec["is_file_valid"]) == "0" {
+			invalidInDBS = append(invalidInDBS, fname)
+		}
+		if drec["file_size"] != nil && rrec["bytes"] != nil && diffValue(drec["file_size"]) != diffValue(rrec["bytes"]) {
+			sizeMismatch = append(sizeMismatch, mismatch(fname, drec["file_size"], rrec["bytes"]))
+		}
+		dsum, rsum := adler32(drec["adler32"]), adler32(rrec["adler32"])
+		if dsum != "" && rsum != "" && dsum != rsum {
+			checksumMismatch = append(checksumMismatch, mismatch(fname, drec["adler32"], rrec["adler32"]))
+		}
+	}
+	sort.Strings(missingInRucio)
+	sort.Strings(missingInDBS)
+	sort.Strings(invalidInDBS)
+	sort.Slice(sizeMismatch, func(i, j int) bool {
+		return sizeMismatch[i]["file"].(string) < sizeMismatch[j]["file"].(string)
+	})
+	sort.Slice(checksumMismatch, func(i, j int) bool {
+		return checksumMismatch[i]["file"].(string) < checksumMismatch[j]["file"].(string)
+	})
+	nissues := len(missingInRucio) + len(missingInDBS) + len(invalidInDBS) + len(sizeMismatch) + len(checksumMismatch)
+	status := "consistent"
+	if nissues > 0 {
+		status = "inconsistent"
+	}
+	return mongo.DASRecord{
+		"name":              block,
+		"dataset":           strings.Split(block, "#")[0],
+		"status":            status,
+		"nissues":           nissues,
+		"nfiles_dbs":        len(dbs),
+		"nfiles_rucio":      len(rucio),
+		"missing_in_rucio":  missingInRucio,
+		"missing_in_dbs":    missingInDBS,
+		"invalid_in_dbs":    invalidInDBS,
+		"size_mismatch":     sizeMismatch,
+		"checksum_mismatch": checksumMismatch,
+	}
+}
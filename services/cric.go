@@ -19,6 +19,16 @@ import (
 	"github.com/dmwm/das2go/utils"
 )
 
+// register local APIs of this module
+func init() {
+	RegisterLocalAPI(LocalAPI{System: "cric", Urn: "site_names", Required: nil, Description: "CRIC site names", Function: "CricSiteNames", Call: LocalAPIs{}.CricSiteNames})
+	RegisterLocalAPI(LocalAPI{System: "cric", Urn: "groups", Required: nil, Description: "CRIC groups", Function: "CricGroups", Call: LocalAPIs{}.CricGroups})
+	RegisterLocalAPI(LocalAPI{System: "cric", Urn: "group_responsibilities", Required: nil, Description: "CRIC group responsibilities", Function: "CricGroupResponsibilities", Call: LocalAPIs{}.CricGroupResponsibilities})
+	RegisterLocalAPI(LocalAPI{System: "cric", Urn: "people_via_email", Required: nil, Description: "CRIC people for given email", Function: "CricPeopleEmail", Call: LocalAPIs{}.CricPeopleEmail})
+	RegisterLocalAPI(LocalAPI{System: "cric", Urn: "people_via_name", Required: nil, Description: "CRIC people for given name", Function: "CricPeopleName", Call: LocalAPIs{}.CricPeopleName})
+	RegisterLocalAPI(LocalAPI{System: "cric", Urn: "roles", Required: nil, Description: "CRIC roles", Function: "CricRoles", Call: LocalAPIs{}.CricRoles})
+}
+
 // helper function to load CRIC data stream
 func loadCRICData(api string, data []byte) []mongo.DASRecord {
 	var out []mongo.DASRecord
@@ -0,0 +1,35 @@
+package cric
+
+// DAS service module
+// CRIC service plugin
+//
+// Copyright (c) 2020 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Service represents CRIC data-service
+type Service struct {
+	services.Base
+}
+
+func init() {
+	srv := &Service{services.Base{Name: "cric", Pattern: "cric", ErrorCode: utils.CRICError, ErrorName: utils.CRICErrorName}}
+	services.RegisterService(srv)
+}
+
+// Request returns local_api since all CRIC apis don't really accept parameters.
+// Instead, we use local APIs to fetch all data and match records with given parameters
+func (s *Service) Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string) {
+	return "local_api", ""
+}
+
+// Decode converts CRIC response into DAS records
+func (s *Service) Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord {
+	return services.CRICUnmarshal(api, data)
+}
@@ -0,0 +1,29 @@
+package dashboard
+
+// DAS service module
+// Dashboard service plugin
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Service represents Dashboard data-service
+type Service struct {
+	services.Base
+}
+
+func init() {
+	srv := &Service{services.Base{Name: "dashboard", Pattern: "dashboard", ErrorCode: utils.DashboardError, ErrorName: utils.DashboardErrorName}}
+	services.RegisterService(srv)
+}
+
+// Decode converts Dashboard response into DAS records
+func (s *Service) Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord {
+	return services.DashboardUnmarshal(api, data)
+}
@@ -20,6 +20,30 @@ import (
 	"github.com/dmwm/das2go/utils"
 )
 
+// register local APIs of this module
+func init() {
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "dataset4block", Required: []string{"block"}, Description: "dataset for given block", Function: "Dataset4Block", Call: LocalAPIs{}.Dataset4Block})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "lumi4dataset", Required: []string{"dataset"}, Description: "lumis for given dataset", Function: "Lumi4Dataset", Call: LocalAPIs{}.Lumi4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "lumi4block", Required: []string{"block"}, Description: "lumis for given block", Function: "Lumi4Block", Call: LocalAPIs{}.Lumi4Block})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "run_lumi4dataset", Required: []string{"dataset"}, Description: "run and lumis for given dataset", Function: "RunLumi4Dataset", Call: LocalAPIs{}.RunLumi4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "run_lumi_evts4dataset", Required: []string{"dataset"}, Description: "run, lumis and events for given dataset", Function: "RunLumiEvents4Dataset", Call: LocalAPIs{}.RunLumiEvents4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "run_lumi4block", Required: []string{"block"}, Description: "run and lumis for given block", Function: "RunLumi4Block", Call: LocalAPIs{}.RunLumi4Block})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "run_lumi_evts4block", Required: []string{"block"}, Description: "run, lumis and events for given block", Function: "RunLumiEvents4Block", Call: LocalAPIs{}.RunLumiEvents4Block})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file_lumi4dataset", Required: []string{"dataset"}, Description: "files and lumis for given dataset", Function: "FileLumi4Dataset", Call: LocalAPIs{}.FileLumi4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file_lumi_evts4dataset", Required: []string{"dataset"}, Description: "files, lumis and events for given dataset", Function: "FileLumiEvents4Dataset", Call: LocalAPIs{}.FileLumiEvents4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file_lumi4block", Required: []string{"block"}, Description: "files and lumis for given block", Function: "FileLumi4Block", Call: LocalAPIs{}.FileLumi4Block})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file_lumi_evts4block", Required: []string{"block"}, Description: "files, lumis and events for given block", Function: "FileLumiEvents4Block", Call: LocalAPIs{}.FileLumiEvents4Block})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file_run_lumi4dataset", Required: []string{"dataset"}, Description: "files, runs and lumis for given dataset", Function: "FileRunLumi4Dataset", Call: LocalAPIs{}.FileRunLumi4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file_run_lumi_evts4dataset", Required: []string{"dataset"}, Description: "files, runs, lumis and events for given dataset", Function: "FileRunLumiEvents4Dataset", Call: LocalAPIs{}.FileRunLumiEvents4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file_run_lumi4block", Required: []string{"block"}, Description: "files, runs and lumis for given block", Function: "FileRunLumi4Block", Call: LocalAPIs{}.FileRunLumi4Block})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file_run_lumi_evts4block", Required: []string{"block"}, Description: "files, runs, lumis and events for given block", Function: "FileRunLumiEvents4Block", Call: LocalAPIs{}.FileRunLumiEvents4Block})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "block_run_lumi4dataset", Required: []string{"dataset"}, Description: "blocks, runs and lumis for given dataset", Function: "BlockRunLumi4Dataset", Call: LocalAPIs{}.BlockRunLumi4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "file4dataset_run_lumi", Required: []string{"dataset", "run", "lumi"}, Description: "files for given dataset, run and lumi", Function: "File4DatasetRunLumi", Call: LocalAPIs{}.File4DatasetRunLumi})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "blocks4tier_dates", Required: []string{"tier", "date"}, Description: "blocks for given tier and dates", Function: "Blocks4TierDates", Call: LocalAPIs{}.Blocks4TierDates})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "lumi4block_run", Required: []string{"block"}, Description: "lumis for given block and run", Function: "Lumi4BlockRun", Call: LocalAPIs{}.Lumi4BlockRun})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "datasetlist", Required: []string{"dataset"}, Description: "datasets for given list of datasets", Function: "DatasetList", Call: LocalAPIs{}.DatasetList})
+}
+
 // helper function to load DBS data stream
 func loadDBSData(api string, data []byte) []mongo.DASRecord {
 	var out []mongo.DASRecord
@@ -0,0 +1,134 @@
+package dbs
+
+// DAS service module
+// DBS service plugin
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Service represents DBS data-service
+type Service struct {
+	services.Base
+}
+
+func init() {
+	srv := &Service{services.Base{Name: "dbs3", Pattern: "dbs", ErrorCode: utils.DBSError, ErrorName: utils.DBSErrorName}}
+	services.RegisterService(srv, "dbs3", "dbs")
+}
+
+// FixInstance replaces global DBS instance in provided base URL with given one
+func FixInstance(dbsInst, base string) string {
+	if strings.Contains(base, "http") && dbsInst != "" && len(dbsInst) > 0 && dbsInst != "prod/global" {
+		// we only have prod, int, dev DBSes
+		// all DAS DBS maps contain only URLs with global DBS instance
+		// therefore we'll replace xxx/global to provided dbsInst
+		defInstances := []string{"prod/global", "int/global", "dev/global"}
+		for _, i := range defInstances {
+			if strings.Contains(base, i) {
+				base = strings.Replace(base, i, dbsInst, -1)
+			}
+		}
+	}
+	return base
+}
+
+// BaseURL returns DAS map url adjusted to DBS instance of DAS query
+func (s *Service) BaseURL(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string {
+	base, _ := dasmap["url"].(string)
+	return FixInstance(dasquery.Instance, base)
+}
+
+// Request forms DBS URL for given DAS query and DAS map
+func (s *Service) Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string) {
+	spec := dasquery.Spec
+	skeys := utils.MapKeys(spec)
+	base := s.BaseURL(dasquery, dasmap)
+	urn, _ := dasmap["urn"].(string)
+	vals := url.Values{}
+	// adjust APIs with 'run between' clause
+	if utils.InList("run", skeys) {
+		val := spec["run"]
+		if strings.Contains(dasquery.Query, "between") {
+			switch runs := val.(type) {
+			case []string:
+				vals.Add("run_num", fmt.Sprintf("\"%s-%s\"", runs[0], runs[len(runs)-1]))
+			case string:
+				vals.Add("run_num", runs)
+			}
+		} else if strings.Contains(dasquery.Query, "in") {
+			switch runs := val.(type) {
+			case []string:
+				for _, r := range runs {
+					vals.Add("run_num", r)
+				}
+			case string:
+				vals.Add("run_num", runs)
+			}
+		}
+	}
+	// return only valid files by default
+	if strings.Contains(base, "file") && !utils.InList("status", skeys) {
+		// do not use valid files for filechildren/fileparents
+		// and for files API when file is used as parameter we look-up file regardless of its validity
+		fields := dasquery.Fields
+		fileLookup := len(skeys) == 1 && skeys[0] == "file" && len(fields) == 1 && fields[0] == "file"
+		if !strings.Contains(base, "filechildren") && !strings.Contains(base, "fileparents") && !fileLookup {
+			vals.Add("validFileOnly", "1")
+		}
+	}
+	// speed-up query by NOT fetching details
+	if utils.WEBSERVER == 0 && (urn == "file4DatasetRunLumi" || urn == "files_via_block") {
+		vals.Add("detail", "False")
+	}
+	// adjust datasets API to look-up all datasets regardless of their status
+	// if dataset name is provided
+	if urn == "datasets" {
+		val, ok := spec["dataset"].(string)
+		if ok && !strings.Contains(val, "*") {
+			if _, ok := spec["status"]; !ok { // only if user didn't specified a status
+				vals.Add("dataset_access_type", "*")
+			}
+		}
+	}
+	hooks := &services.URLHooks{Base: base, Values: vals, Arg: argValues}
+	return services.FormUrlCall(dasquery, dasmap, hooks), ""
+}
+
+// helper function to skip run values since they are converted into run_num in Request
+func argValues(dasquery dasql.DASQuery, dkey, arg string, val interface{}, vals url.Values) (bool, bool) {
+	if _, ok := val.([]string); ok && arg == "run_num" {
+		return true, false
+	}
+	return false, false
+}
+
+// Authenticate asks DBS to use gzip encoding
+func (s *Service) Authenticate(req *http.Request) error {
+	req.Header.Add("Accept-Encoding", "gzip")
+	return nil
+}
+
+// Decode converts DBS response into DAS records
+func (s *Service) Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord {
+	return services.DBSUnmarshal(api, data)
+}
+
+// Health checks DBS server info API
+func (s *Service) Health(client *http.Client, base string) error {
+	if idx := strings.Index(base, "DBSReader"); idx > 0 {
+		base = base[:idx] + "DBSReader/serverinfo"
+	}
+	return s.Base.Health(client, base)
+}
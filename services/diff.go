@@ -0,0 +1,77 @@
+package services
+
+// DAS service module
+// diff module, it compares values of DAS keys provided by different
+// data-services for the same primary key, see diff key of presentation map
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dmwm/das2go/mongo"
+)
+
+// helper function to normalize value for comparison, numbers coming from
+// different services can be represented by different types
+func diffValue(val interface{}) string {
+	switch v := val.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// DiffRecord compares values of given keys, e.g. block.size, among DAS records
+// of the same entity provided by different services and returns list of
+// conflicts. Values of every record are attributed to service of its own das
+// part, therefore services may provide any number of sub-records. Every
+// conflict has the following structure
+// {"key": "block.size", "values": [{"service": "dbs3:blocks", "value": 1}, ...]}
+func DiffRecord(records []mongo.DASRecord, mkey string, keys []string) []mongo.DASRecord {
+	var out []mongo.DASRecord
+	if len(keys) == 0 || len(records) < 2 {
+		return out
+	}
+	for _, key := range keys {
+		attr := strings.TrimPrefix(key, mkey+".")
+		var values []mongo.DASRecord
+		systems := make(map[string]bool)
+		distinct := make(map[string]bool)
+		for _, rec := range records {
+			das, ok := rec["das"].(mongo.DASRecord)
+			if !ok {
+				continue
+			}
+			srvs := services(das)
+			if len(srvs) == 0 {
+				continue
+			}
+			srv := srvs[0]
+			for _, r := range subRecords(rec, mkey) {
+				val := mongo.GetValue(r, attr)
+				if val == nil || val == "" {
+					continue
+				}
+				systems[strings.Split(srv, ":")[0]] = true
+				distinct[diffValue(val)] = true
+				values = append(values, mongo.DASRecord{"service": srv, "value": val})
+			}
+		}
+		if len(distinct) > 1 && len(systems) > 1 {
+			out = append(out, mongo.DASRecord{"key": key, "values": values})
+		}
+	}
+	return out
+}
@@ -190,6 +190,8 @@ func processUrls(dasquery dasql.DASQuery, system, api string, urls []string) []m
 				records = DBSUnmarshal(api, r.Data)
 			} else if system == "phedex" {
 				records = PhedexUnmarshal(api, r.Data)
+			} else if system == "rucio" {
+				records = RucioUnmarshal(dasquery, api, r.Data)
 			}
 			for _, rec := range records {
 				rec["url"] = r.Url
@@ -0,0 +1,341 @@
+package services
+
+// DAS service module
+// lineage module, it walks parents and children of DBS datasets and files
+// recursively and provides lineage graph
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmwm/das2go/config"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
+// register local APIs of this module
+func init() {
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "lineage4dataset", Required: []string{"dataset"}, Description: "recursive parents and children of given dataset", Function: "Lineage4Dataset", Call: LocalAPIs{}.Lineage4Dataset})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "lineage4file", Required: []string{"file"}, Description: "recursive parents and children of given file", Function: "Lineage4File", Call: LocalAPIs{}.Lineage4File})
+	RegisterLocalAPI(LocalAPI{System: "dbs3", Urn: "lineage4file_dataset", Required: []string{"file", "dataset"}, Description: "files of given dataset which descend from given file", Function: "Lineage4FileDataset", Call: LocalAPIs{}.Lineage4FileDataset})
+}
+
+// LineageNode represents node of lineage graph, level is a distance from the
+// root node, negative for ancestors and positive for descendants
+type LineageNode struct {
+	Name  string `json:"name"`
+	Level int    `json:"level"`
+}
+
+// LineageEdge represents parent-child relation of lineage graph
+type LineageEdge struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+}
+
+// LineageGraph represents lineage graph of given root node
+type LineageGraph struct {
+	Kind  string        `json:"kind"`  // kind of nodes, e.g. dataset
+	Root  string        `json:"root"`  // root node of the graph
+	Depth int           `json:"depth"` // maximum depth of the walk
+	Nodes []LineageNode `json:"nodes"` // graph nodes sorted by level
+	Edges []LineageEdge `json:"edges"` // graph edges
+}
+
+// LineageTree represents lineage graph as a tree, used by web UI
+type LineageTree struct {
+	Name     string
+	Children []LineageTree
+}
+
+// RelativesFunc returns relatives, either parents or children, of given nodes.
+// It is called once per generation and should fetch all nodes in parallel.
+type RelativesFunc func(names []string) map[string][]string
+
+// LineageDepth returns depth of lineage walk for given value, it is limited
+// by lineageDepth configuration parameter
+func LineageDepth(val interface{}) int {
+	maxDepth := config.Current().LineageDepth
+	if maxDepth <= 0 {
+		maxDepth = 10
+	}
+	sval, _ := val.(string)
+	depth, err := strconv.Atoi(sval)
+	if err != nil || depth <= 0 || depth > maxDepth {
+		return maxDepth
+	}
+	return depth
+}
+
+// BuildLineage walks relatives of given root node up to given depth in both
+// directions. Nodes which were already visited are not walked again, which
+// protects the walk from cycles in lineage information.
+func BuildLineage(kind, root string, depth int, parents, children RelativesFunc) LineageGraph {
+	graph := LineageGraph{Kind: kind, Root: root, Depth: depth}
+	levels := map[string]int{root: 0}
+	edges := make(map[LineageEdge]bool)
+	walk := func(relatives RelativesFunc, sign int) {
+		visited := map[string]bool{root: true}
+		generation := []string{root}
+		for level := 1; level <= depth && len(generation) > 0 && relatives != nil; level++ {
+			var next []string
+			rmap := relatives(generation)
+			for _, name := range generation {
+				for _, rel := range rmap[name] {
+					edge := LineageEdge{Parent: rel, Child: name}
+					if sign > 0 {
+						edge = LineageEdge{Parent: name, Child: rel}
+					}
+					edges[edge] = true
+					if visited[rel] {
+						continue
+					}
+					visited[rel] = true
+					if _, ok := levels[rel]; !ok {
+						levels[rel] = sign * level
+					}
+					next = append(next, rel)
+				}
+			}
+			sort.Strings(next)
+			generation = next
+		}
+	}
+	walk(parents, -1)
+	walk(children, 1)
+	for name, level := range levels {
+		graph.Nodes = append(graph.Nodes, LineageNode{Name: name, Level: level})
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		if graph.Nodes[i].Level == graph.Nodes[j].Level {
+			return graph.Nodes[i].Name < graph.Nodes[j].Name
+		}
+		return graph.Nodes[i].Level < graph.Nodes[j].Level
+	})
+	for edge := range edges {
+		graph.Edges = append(graph.Edges, edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Parent == graph.Edges[j].Parent {
+			return graph.Edges[i].Child < graph.Edges[j].Child
+		}
+		return graph.Edges[i].Parent < graph.Edges[j].Parent
+	})
+	return graph
+}
+
+// helper function to get parents and children of every node
+func (g *LineageGraph) relatives() (map[string][]string, map[string][]string) {
+	parents := make(map[string][]string)
+	children := make(map[string][]string)
+	for _, edge := range g.Edges {
+		parents[edge.Child] = append(parents[edge.Child], edge.Parent)
+		children[edge.Parent] = append(children[edge.Parent], edge.Child)
+	}
+	return parents, children
+}
+
+// Records returns lineage graph as DAS records, one record per node
+func (g *LineageGraph) Records() []mongo.DASRecord {
+	var out []mongo.DASRecord
+	parents, children := g.relatives()
+	for _, node := range g.Nodes {
+		rec := mongo.DASRecord{
+			"name":     node.Name,
+			"level":    node.Level,
+			"kind":     g.Kind,
+			"root":     g.Root,
+			"parents":  parents[node.Name],
+			"children": children[node.Name],
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+// Dot returns lineage graph in graphviz DOT format
+func (g *LineageGraph) Dot() string {
+	var out []string
+	out = append(out, "digraph lineage {")
+	out = append(out, "  rankdir=LR;")
+	out = append(out, fmt.Sprintf("  %q [style=filled];", g.Root))
+	for _, edge := range g.Edges {
+		out = append(out, fmt.Sprintf("  %q -> %q;", edge.Parent, edge.Child))
+	}
+	out = append(out, "}")
+	return strings.Join(out, "\n") + "\n"
+}
+
+// Trees returns ancestors and descendants trees of the root node, nodes
+// reachable via different paths are expanded only once
+func (g *LineageGraph) Trees() (LineageTree, LineageTree) {
+	parents, children := g.relatives()
+	var build func(name string, relatives map[string][]string, visited map[string]bool) LineageTree
+	build = func(name string, relatives map[string][]string, visited map[string]bool) LineageTree {
+		tree := LineageTree{Name: name}
+		visited[name] = true
+		for _, rel := range relatives[name] {
+			if visited[rel] {
+				tree.Children = append(tree.Children, LineageTree{Name: rel})
+				continue
+			}
+			tree.Children = append(tree.Children, build(rel, relatives, visited))
+		}
+		return tree
+	}
+	return build(g.Root, parents, make(map[string]bool)), build(g.Root, children, make(map[string]bool))
+}
+
+// helper function to fetch relatives of datasets from given DBS API, the key
+// is the name of relative attribute in DBS records, e.g. parent_dataset
+func datasetRelatives(dasquery dasql.DASQuery, api, key string) RelativesFunc {
+	return func(names []string) map[string][]string {
+		out := make(map[string][]string)
+		var urls []string
+		for _, name := range names {
+			urls = append(urls, fmt.Sprintf("%s/%s?dataset=%s", DBSUrl(dasquery.Instance), api, url.QueryEscape(name)))
+		}
+		// we use lineage api name to keep DBS records as is
+		for _, rec := range processUrls(dasquery, "dbs3", "lineage", urls) {
+			name, _ := rec["this_dataset"].(string)
+			rel, _ := rec[key].(string)
+			if name != "" && rel != "" {
+				out[name] = append(out[name], rel)
+			}
+		}
+		return out
+	}
+}
+
+// DatasetLineage returns lineage graph of dataset from given DAS query
+func DatasetLineage(dasquery dasql.DASQuery) LineageGraph {
+	dataset, _ := dasquery.Spec["dataset"].(string)
+	depth := LineageDepth(dasquery.Spec["depth"])
+	parents := datasetRelatives(dasquery, "datasetparents", "parent_dataset")
+	children := datasetRelatives(dasquery, "datasetchildren", "child_dataset")
+	return BuildLineage("dataset", dataset, depth, parents, children)
+}
+
+// Lineage4Dataset returns recursive parents and children of given dataset
+func (LocalAPIs) Lineage4Dataset(dasquery dasql.DASQuery) []mongo.DASRecord {
+	graph := DatasetLineage(dasquery)
+	return graph.Records()
+}
+
+// number of files looked-up in single DBS call
+var lineageBatch = 20
+
+// helper function to get list of names from DBS attribute which can be
+// either single value or list of values
+func lineageNames(val interface{}) []string {
+	var out []string
+	switch v := val.(type) {
+	case string:
+		out = append(out, v)
+	case []interface{}:
+		for _, item := range v {
+			if name, ok := item.(string); ok {
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// helper function to fetch relatives of files from given DBS API, the key
+// is the name of relative attribute in DBS records, e.g. parent_logical_file_name.
+// Files of one generation are looked-up in batches of lineageBatch files.
+func fileRelatives(dasquery dasql.DASQuery, api, key string) RelativesFunc {
+	return func(names []string) map[string][]string {
+		out := make(map[string][]string)
+		var urls []string
+		for idx := 0; idx < len(names); idx += lineageBatch {
+			end := idx + lineageBatch
+			if end > len(names) {
+				end = len(names)
+			}
+			vals := url.Values{}
+			for _, name := range names[idx:end] {
+				vals.Add("logical_file_name", name)
+			}
+			urls = append(urls, fmt.Sprintf("%s/%s?%s", DBSUrl(dasquery.Instance), api, vals.Encode()))
+		}
+		// we use lineage api name to keep DBS records as is
+		for _, rec := range processUrls(dasquery, "dbs3", "lineage", urls) {
+			name, _ := rec["logical_file_name"].(string)
+			if name == "" {
+				continue
+			}
+			out[name] = append(out[name], lineageNames(rec[key])...)
+		}
+		return out
+	}
+}
+
+// FileLineage returns lineage graph of file from given DAS query
+func FileLineage(dasquery dasql.DASQuery) LineageGraph {
+	lfn, _ := dasquery.Spec["file"].(string)
+	depth := LineageDepth(dasquery.Spec["depth"])
+	parents := fileRelatives(dasquery, "fileparents", "parent_logical_file_name")
+	children := fileRelatives(dasquery, "filechildren", "child_logical_file_name")
+	return BuildLineage("file", lfn, depth, parents, children)
+}
+
+// Descendants returns graph nodes which descend from the root and belong to
+// given set of names
+func (g *LineageGraph) Descendants(names map[string]bool) []LineageNode {
+	var out []LineageNode
+	for _, node := range g.Nodes {
+		if node.Level > 0 && names[node.Name] {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// Lineage4File returns recursive parents and children of given file
+func (LocalAPIs) Lineage4File(dasquery dasql.DASQuery) []mongo.DASRecord {
+	graph := FileLineage(dasquery)
+	return graph.Records()
+}
+
+// Lineage4FileDataset returns files of given dataset which descend from given file
+func (LocalAPIs) Lineage4FileDataset(dasquery dasql.DASQuery) []mongo.DASRecord {
+	var out []mongo.DASRecord
+	dataset, _ := dasquery.Spec["dataset"].(string)
+	lfn, _ := dasquery.Spec["file"].(string)
+	depth := LineageDepth(dasquery.Spec["depth"])
+	children := fileRelatives(dasquery, "filechildren", "child_logical_file_name")
+	graph := BuildLineage("file", lfn, depth, nil, children)
+	furl := fmt.Sprintf("%s/files?dataset=%s", DBSUrl(dasquery.Instance), url.QueryEscape(dataset))
+	files := make(map[string]bool)
+	for _, rec := range processUrls(dasquery, "dbs3", "lineage", []string{furl}) {
+		if name, ok := rec["logical_file_name"].(string); ok {
+			files[name] = true
+		}
+	}
+	if utils.VERBOSE > 0 {
+		log.Printf("lineage4file_dataset, file %s, %d descendants, %d dataset files\n", lfn, len(graph.Nodes)-1, len(files))
+	}
+	parents, _ := graph.relatives()
+	for _, node := range graph.Descendants(files) {
+		rec := mongo.DASRecord{
+			"name":    node.Name,
+			"level":   node.Level,
+			"kind":    graph.Kind,
+			"root":    graph.Root,
+			"dataset": dataset,
+			"parents": parents[node.Name],
+		}
+		out = append(out, rec)
+	}
+	return out
+}
@@ -1,56 +1,128 @@
 package services
 
+// DAS service module
+// local APIs registry
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
 // LocalAPIs structure to hold information about local APIs
 type LocalAPIs struct{}
 
+// LocalAPIFunc represents signature of local API function
+type LocalAPIFunc func(dasquery dasql.DASQuery) []mongo.DASRecord
+
+// LocalAPI represents local API registered in DAS along with its metadata
+type LocalAPI struct {
+	System      string       `json:"system"`      // DAS system name, e.g. dbs3
+	Urn         string       `json:"urn"`         // urn of DAS map served by local API
+	Required    []string     `json:"required"`    // DAS keys required by local API
+	Description string       `json:"description"` // description of local API
+	Function    string       `json:"function"`    // name of local API function
+	Call        LocalAPIFunc `json:"-"`           // local API function
+}
+
+// Name returns name of local API in system_urn form
+func (a LocalAPI) Name() string {
+	return fmt.Sprintf("%s_%s", a.System, a.Urn)
+}
+
+// registry of local APIs
+var localAPIRegistry = make(map[string]LocalAPI)
+var localAPIRegistryLock sync.RWMutex
+
+// RegisterLocalAPI registers given local API, it panics if local API does not
+// provide system, urn, function and its name or it is already registered
+func RegisterLocalAPI(api LocalAPI) {
+	if api.System == "" || api.Urn == "" || api.Function == "" || api.Call == nil {
+		panic(fmt.Sprintf("invalid local API registration %+v", api))
+	}
+	localAPIRegistryLock.Lock()
+	defer localAPIRegistryLock.Unlock()
+	if _, ok := localAPIRegistry[api.Name()]; ok {
+		panic(fmt.Sprintf("local API %s is already registered", api.Name()))
+	}
+	localAPIRegistry[api.Name()] = api
+}
+
+// GetLocalAPI returns local API registered for given system and urn
+func GetLocalAPI(system, urn string) (LocalAPI, bool) {
+	localAPIRegistryLock.RLock()
+	defer localAPIRegistryLock.RUnlock()
+	api, ok := localAPIRegistry[fmt.Sprintf("%s_%s", system, urn)]
+	return api, ok
+}
+
+// LocalAPIList returns list of registered local APIs sorted by their names
+func LocalAPIList() []LocalAPI {
+	localAPIRegistryLock.RLock()
+	defer localAPIRegistryLock.RUnlock()
+	var out []LocalAPI
+	for _, api := range localAPIRegistry {
+		out = append(out, api)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
+
 // LocalAPIMap contains a map of local APIs and their associative functions
 func LocalAPIMap() map[string]string {
 	localAPIMap := make(map[string]string)
-	localAPIMap["combined_dataset4site_release"] = "Dataset4SiteRelease"
-	localAPIMap["combined_dataset4site_release_parent"] = "Dataset4SiteReleaseParent"
-	localAPIMap["combined_child4site_release_dataset"] = "Child4SiteReleaseDataset"
-	localAPIMap["combined_site4block"] = "Site4Block"
-	localAPIMap["combined_site4dataset"] = "Site4Dataset"
-	localAPIMap["combined_site4dataset_pct"] = "Site4DatasetPct"
-	localAPIMap["combined_lumi4dataset"] = "Lumi4Dataset"
-	localAPIMap["combined_files4dataset_runs_site"] = "Files4DatasetRunsSite"
-	localAPIMap["combined_files4block_runs_site"] = "Files4BlockRunsSite"
-	localAPIMap["dbs3_dataset4block"] = "Dataset4Block"
-	localAPIMap["dbs3_lumi4dataset"] = "Lumi4Dataset"
-	localAPIMap["dbs3_lumi4block"] = "Lumi4Block"
-	localAPIMap["dbs3_run_lumi4dataset"] = "RunLumi4Dataset"
-	localAPIMap["dbs3_run_lumi_evts4dataset"] = "RunLumiEvents4Dataset"
-	localAPIMap["dbs3_run_lumi4block"] = "RunLumi4Block"
-	localAPIMap["dbs3_run_lumi_evts4block"] = "RunLumiEvents4Block"
-	localAPIMap["dbs3_file_lumi4dataset"] = "FileLumi4Dataset"
-	localAPIMap["dbs3_file_lumi_evts4dataset"] = "FileLumiEvents4Dataset"
-	localAPIMap["dbs3_file_lumi4block"] = "FileLumi4Block"
-	localAPIMap["dbs3_file_lumi_evts4block"] = "FileLumiEvents4Block"
-	localAPIMap["dbs3_file_run_lumi4dataset"] = "FileRunLumi4Dataset"
-	localAPIMap["dbs3_file_run_lumi_evts4dataset"] = "FileRunLumiEvents4Dataset"
-	localAPIMap["dbs3_file_run_lumi4block"] = "FileRunLumi4Block"
-	localAPIMap["dbs3_file_run_lumi_evts4block"] = "FileRunLumiEvents4Block"
-	localAPIMap["dbs3_block_run_lumi4dataset"] = "BlockRunLumi4Dataset"
-	localAPIMap["dbs3_file4dataset_run_lumi"] = "File4DatasetRunLumi"
-	localAPIMap["dbs3_blocks4tier_dates"] = "Blocks4TierDates"
-	localAPIMap["dbs3_lumi4block_run"] = "Lumi4BlockRun"
-	localAPIMap["dbs3_datasetlist"] = "DatasetList"
-	localAPIMap["reqmgr2_configs"] = "Configs"
-	localAPIMap["sitedb2_site_names"] = "SiteNames"
-	localAPIMap["sitedb2_groups"] = "Groups"
-	localAPIMap["sitedb2_group_responsibilities"] = "GroupResponsibilities"
-	localAPIMap["sitedb2_people_via_email"] = "PeopleEmail"
-	localAPIMap["sitedb2_people_via_name"] = "PeopleName"
-	localAPIMap["sitedb2_roles"] = "Roles"
-	localAPIMap["cric_site_names"] = "CricSiteNames"
-	localAPIMap["cric_groups"] = "CricGroups"
-	localAPIMap["cric_group_responsibilities"] = "CricGroupResponsibilities"
-	localAPIMap["cric_people_via_email"] = "CricPeopleEmail"
-	localAPIMap["cric_people_via_name"] = "CricPeopleName"
-	localAPIMap["cric_roles"] = "CricRoles"
+	for _, api := range LocalAPIList() {
+		localAPIMap[api.Name()] = api.Function
+	}
 	return localAPIMap
 }
 
+// ValidateLocalAPIs validates registered local APIs against given DAS maps, it
+// checks that every DAS map served by local API has registered function and
+// that registered local APIs match their DAS maps
+func ValidateLocalAPIs(dmaps dasmaps.DASMaps) []string {
+	var out []string
+	matched := make(map[string]bool)
+	for _, rec := range dmaps.Maps() {
+		if rec["type"] != "service" {
+			continue
+		}
+		system, _ := rec["system"].(string)
+		urn, _ := rec["urn"].(string)
+		furl, _ := rec["url"].(string)
+		if !dasmaps.IsLocalAPI(system, urn, furl, DASLocalAPIs()) {
+			continue
+		}
+		if !utils.InList(system, dmaps.Services()) {
+			continue
+		}
+		api, ok := GetLocalAPI(system, urn)
+		if !ok {
+			out = append(out, fmt.Sprintf("DAS map %s:%s has no registered local API", system, urn))
+			continue
+		}
+		matched[api.Name()] = true
+		rkeys := dasmaps.RequiredKeys(rec)
+		if !utils.EqualLists(rkeys, api.Required) {
+			out = append(out, fmt.Sprintf("local API %s requires %v while its DAS map requires %v", api.Name(), api.Required, rkeys))
+		}
+	}
+	for _, api := range LocalAPIList() {
+		if !matched[api.Name()] && utils.InList(api.System, dmaps.Services()) {
+			out = append(out, fmt.Sprintf("local API %s has no DAS map", api.Name()))
+		}
+	}
+	return out
+}
+
 // DASLocalAPIs contains list of __ONLY__ exceptional apis due to mistake in DAS maps
 func DASLocalAPIs() []string {
 	out := []string{
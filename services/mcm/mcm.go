@@ -0,0 +1,44 @@
+package mcm
+
+// DAS service module
+// McM service plugin
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"net/http"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Service represents McM data-service
+type Service struct {
+	services.Base
+}
+
+func init() {
+	srv := &Service{services.Base{Name: "mcm", Pattern: "mcm", ErrorCode: utils.McMError, ErrorName: utils.McMErrorName}}
+	services.RegisterService(srv)
+}
+
+// Request forms McM REST URL for given DAS query and DAS map
+func (s *Service) Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string) {
+	return services.FormRESTUrl(dasquery, dasmap), ""
+}
+
+// Authenticate asks McM to return JSON
+func (s *Service) Authenticate(req *http.Request) error {
+	if req.Method == "GET" {
+		req.Header.Add("Accept", "application/json")
+	}
+	return nil
+}
+
+// Decode converts McM response into DAS records
+func (s *Service) Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord {
+	return services.McMUnmarshal(api, data)
+}
@@ -0,0 +1,225 @@
+package services
+
+// DAS service module
+// merge module, it merges DAS records of the same entity provided by
+// different data-services
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MergeKeys returns keys used to merge DAS records of query with given
+// fields, i.e. primary key of every field, e.g. file.name, run.run_number
+// and lumi.number for file,run,lumi query
+func MergeKeys(fields, pkeys []string) []string {
+	var out []string
+	for _, field := range fields {
+		for _, pkey := range pkeys {
+			if strings.HasPrefix(pkey, field+".") {
+				out = append(out, pkey)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// helper function to get sub-records of DAS record for given DAS key
+func subRecords(rec mongo.DASRecord, key string) []mongo.DASRecord {
+	if r, ok := rec[key].(mongo.DASRecord); ok {
+		return []mongo.DASRecord{r}
+	}
+	return getRecords(rec, key)
+}
+
+// helper function to return content of DAS record, i.e. record without its
+// das part, query hash and id
+func recordContent(rec mongo.DASRecord) mongo.DASRecord {
+	out := make(mongo.DASRecord)
+	for key, val := range rec {
+		if key == "das" || key == "qhash" || key == "_id" {
+			continue
+		}
+		out[key] = val
+	}
+	return out
+}
+
+// helper function to return fingerprint of given value, values of the same
+// content have the same fingerprint
+func fingerprint(val interface{}) string {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+	return string(data)
+}
+
+// helper function to build merge key of DAS record, it consists of values of
+// primary keys of query fields. Field which sub-records lack primary key
+// value is represented by its sub-records, therefore such records are only
+// merged with identical ones.
+func mergeKey(rec mongo.DASRecord, fields, pkeys []string) string {
+	if len(fields) == 0 {
+		return fingerprint(recordContent(rec))
+	}
+	var parts []string
+	for _, field := range fields {
+		var attr string
+		if mkeys := MergeKeys([]string{field}, pkeys); len(mkeys) > 0 {
+			attr = strings.TrimPrefix(mkeys[0], field+".")
+		}
+		subs := subRecords(rec, field)
+		var values []string
+		for _, sub := range subs {
+			if attr == "" {
+				break
+			}
+			val := mongo.GetValue(sub, attr)
+			if val == nil || val == "" {
+				values = nil
+				break
+			}
+			values = append(values, diffValue(val))
+		}
+		if len(values) == 0 {
+			parts = append(parts, fingerprint(rec[field]))
+		} else {
+			parts = append(parts, strings.Join(values, ","))
+		}
+	}
+	return fingerprint(parts)
+}
+
+// helper function to return services which provided duplicates of DAS record
+func duplicates(das mongo.DASRecord) []string {
+	var out []string
+	switch srvs := das["duplicates"].(type) {
+	case []string:
+		out = append(out, srvs...)
+	case []interface{}:
+		for _, srv := range srvs {
+			out = append(out, fmt.Sprintf("%v", srv))
+		}
+	}
+	return out
+}
+
+// function to merge DAS data records, sub-records of every DAS key are
+// concatenated in order of services of merged das part
+func mergeRecords(oldrec, newrec mongo.DASRecord, qhash string) mongo.DASRecord {
+	rec := mongo.DASRecord{"qhash": qhash}
+	for _, r := range []mongo.DASRecord{oldrec, newrec} {
+		for key, val := range recordContent(r) {
+			subs := subRecords(r, key)
+			if len(subs) == 0 {
+				if _, ok := rec[key]; !ok {
+					rec[key] = val
+				}
+				continue
+			}
+			rec[key] = append(subRecords(rec, key), subs...)
+		}
+	}
+	das1 := oldrec["das"].(mongo.DASRecord)
+	das2 := newrec["das"].(mongo.DASRecord)
+	das := mergeDASparts(das1, das2)
+	if srvs := append(duplicates(das1), duplicates(das2)...); len(srvs) > 0 {
+		das["duplicates"] = srvs
+	}
+	if srcs := append(Provenance(das1), Provenance(das2)...); len(srcs) > 0 {
+		das["provenance"] = srcs
+	}
+	rec["das"] = das
+	return rec
+}
+
+// MergeRecords merges DAS data records which describe the same entity, i.e.
+// records with the same values of primary keys of query fields, e.g. file,
+// run and lumi for file,run,lumi query. Identical records provided by
+// different services are merged once and services which provided duplicates
+// are listed in das part of merged record. Sources of all sub-records are kept
+// in provenance of das part of merged record, see Source. Values of diffKeys are compared
+// among services and conflicts are attached to das part of merged records.
+// Records keep order of their first appearance. It returns merged records
+// and their smallest expire timestamp.
+func MergeRecords(records []mongo.DASRecord, fields, pkeys, diffKeys []string, qhash string) ([]mongo.DASRecord, int64) {
+	expire := time.Now().Unix() * 2
+	var out, merged []mongo.DASRecord
+	var originals [][]mongo.DASRecord // records merged into every merged record
+	groups := make(map[string]int)
+	contents := make(map[string]map[string]int) // offsets of sub-records of merged records
+	for _, rec := range records {
+		das, ok := rec["das"].(mongo.DASRecord)
+		if !ok { // e.g. error record of DAS cache look-up
+			out = append(out, rec)
+			continue
+		}
+		if dasexpire, err := mongo.GetInt64Value(das, "expire"); err == nil && dasexpire < expire {
+			expire = dasexpire
+		}
+		key := mergeKey(rec, fields, pkeys)
+		content := fingerprint(recordContent(rec))
+		idx, ok := groups[key]
+		if !ok {
+			groups[key] = len(merged)
+			contents[content] = map[string]int{}
+			das["provenance"] = recordSources(rec, nil, false)
+			merged = append(merged, rec)
+			originals = append(originals, []mongo.DASRecord{rec})
+			continue
+		}
+		originals[idx] = append(originals[idx], rec)
+		if offsets, ok := contents[content]; ok {
+			// identical record provided by another service, its sub-records
+			// are referred by sources at position of the merged ones
+			das := merged[idx]["das"].(mongo.DASRecord)
+			das["duplicates"] = append(duplicates(das), services(rec["das"].(mongo.DASRecord))...)
+			das["provenance"] = append(Provenance(das), recordSources(rec, offsets, true)...)
+			continue
+		}
+		// sub-records of the record follow sub-records of merged record
+		offsets := make(map[string]int)
+		for key := range recordContent(rec) {
+			offsets[key] = len(subRecords(merged[idx], key))
+		}
+		contents[content] = offsets
+		das["provenance"] = recordSources(rec, offsets, false)
+		merged[idx] = mergeRecords(merged[idx], rec, qhash)
+	}
+	var mkey string
+	if len(fields) > 0 {
+		mkey = fields[0]
+	}
+	for idx, rec := range merged {
+		if conflicts := DiffRecord(originals[idx], mkey, diffKeys); len(conflicts) > 0 {
+			das := rec["das"].(mongo.DASRecord)
+			das["conflicts"] = conflicts
+		}
+		out = append(out, rec)
+	}
+	return out, expire
+}
+
+// MergeDASRecords merges DAS data records of given query found in DAS cache,
+// see MergeRecords
+func MergeDASRecords(dasquery dasql.DASQuery, pkeys, diffKeys []string) ([]mongo.DASRecord, int64) {
+	spec := bson.M{"qhash": dasquery.Qhash, "das.record": 1}
+	var records []mongo.DASRecord
+	if mkeys := MergeKeys(dasquery.Fields, pkeys); len(mkeys) > 0 {
+		records = mongo.GetSorted("das", "cache", spec, mkeys[:1])
+	} else {
+		records = mongo.Get("das", "cache", spec, 0, -1)
+	}
+	return MergeRecords(records, dasquery.Fields, pkeys, diffKeys, dasquery.Qhash)
+}
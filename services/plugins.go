@@ -0,0 +1,202 @@
+package services
+
+// DAS service module
+// Plugins module, it defines interface every CMS data-service implements
+// and registry of services keyed by system name used in DAS maps
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Service represents CMS data-service DAS talks to
+type Service interface {
+	// System returns system name used in DAS maps, e.g. dbs3
+	System() string
+	// Owns reports if given URL belongs to the service
+	Owns(rurl string) bool
+	// BaseURL returns base URL of DAS map adjusted for given DAS query
+	BaseURL(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string
+	// Request forms URL and POST arguments for given DAS query and DAS map,
+	// it returns local_api URL for DAS maps served by local APIs
+	Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string)
+	// Authenticate adds authentication and service headers to HTTP request
+	Authenticate(req *http.Request) error
+	// Decode converts data-service response into DAS records
+	Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord
+	// Error converts data-service error into DAS error record
+	Error(err error) mongo.DASRecord
+	// Health checks data-service availability using given DAS map URL
+	Health(client *http.Client, base string) error
+}
+
+// Base provides default implementation of Service methods, service plugins
+// embed it and override methods they need
+type Base struct {
+	Name      string // system name used in DAS maps
+	Pattern   string // URL pattern which identifies the service
+	ErrorCode int    // DAS error code of the service
+	ErrorName string // DAS error name of the service
+}
+
+// System returns system name of the service
+func (b *Base) System() string {
+	return b.Name
+}
+
+// Owns reports if given URL contains service pattern
+func (b *Base) Owns(rurl string) bool {
+	return b.Pattern != "" && strings.Contains(rurl, b.Pattern)
+}
+
+// BaseURL returns url of DAS map
+func (b *Base) BaseURL(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string {
+	base, _ := dasmap["url"].(string)
+	return base
+}
+
+// Request forms URL with parameters from DAS map
+func (b *Base) Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string) {
+	return FormUrlCall(dasquery, dasmap, nil), ""
+}
+
+// Authenticate does not add anything to HTTP request
+func (b *Base) Authenticate(req *http.Request) error {
+	return nil
+}
+
+// Error converts error into DAS error record with service error code
+func (b *Base) Error(err error) mongo.DASRecord {
+	return mongo.DASErrorRecord(fmt.Sprintf("%v", err), b.ErrorName, b.ErrorCode)
+}
+
+// Health fetches given URL and checks that service responds without server error
+func (b *Base) Health(client *http.Client, base string) error {
+	if client == nil {
+		client = utils.HttpClient()
+	}
+	req, err := http.NewRequest("GET", base, nil)
+	if err != nil {
+		return err
+	}
+	if srv, ok := GetService(b.Name); ok {
+		srv.Authenticate(req)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s responds with %s", base, resp.Status)
+	}
+	return nil
+}
+
+// servicesRegistry keeps registered services
+var servicesRegistry = struct {
+	sync.RWMutex
+	services map[string]Service
+}{services: make(map[string]Service)}
+
+// RegisterService registers given service under provided system names,
+// it panics on duplicate registration since it indicates programming error
+func RegisterService(srv Service, systems ...string) {
+	if srv == nil {
+		panic("services: RegisterService with nil service")
+	}
+	if len(systems) == 0 {
+		systems = []string{srv.System()}
+	}
+	servicesRegistry.Lock()
+	defer servicesRegistry.Unlock()
+	for _, system := range systems {
+		if _, dup := servicesRegistry.services[system]; dup {
+			panic(fmt.Sprintf("services: RegisterService called twice for %s", system))
+		}
+		servicesRegistry.services[system] = srv
+	}
+}
+
+// GetService returns service registered for given system
+func GetService(system string) (Service, bool) {
+	servicesRegistry.RLock()
+	defer servicesRegistry.RUnlock()
+	srv, ok := servicesRegistry.services[system]
+	return srv, ok
+}
+
+// ServiceNames returns sorted list of registered system names
+func ServiceNames() []string {
+	servicesRegistry.RLock()
+	defer servicesRegistry.RUnlock()
+	var out []string
+	for system := range servicesRegistry.services {
+		out = append(out, system)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ServiceForURL returns service which owns given URL
+func ServiceForURL(rurl string) (Service, bool) {
+	for _, system := range ServiceNames() {
+		srv, _ := GetService(system)
+		if srv.System() == system && srv.Owns(rurl) {
+			return srv, true
+		}
+	}
+	return nil, false
+}
+
+// Request forms URL and POST arguments for given DAS query and DAS map using
+// service registered for DAS map system. Long lists of values are sent as POST
+// request if DAS map declares its POST API.
+func Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string) {
+	system, _ := dasmap["system"].(string)
+	if srv, ok := GetService(system); ok {
+		furl, args := srv.Request(dasquery, dasmap)
+		return postRequest(dasquery, dasmap, furl, args)
+	}
+	return postRequest(dasquery, dasmap, FormUrlCall(dasquery, dasmap, nil), "")
+}
+
+// BaseURL returns base URL of DAS map adjusted for given DAS query
+func BaseURL(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string {
+	system, _ := dasmap["system"].(string)
+	if srv, ok := GetService(system); ok {
+		return srv.BaseURL(dasquery, dasmap)
+	}
+	base, _ := dasmap["url"].(string)
+	return base
+}
+
+// helper function to find system name of given URL
+func systemName(rurl string) string {
+	if srv, ok := ServiceForURL(rurl); ok {
+		return srv.System()
+	}
+	return "combined"
+}
+
+// helper function to authenticate HTTP request to given URL
+func authenticate(rurl string, req *http.Request) {
+	if srv, ok := ServiceForURL(rurl); ok {
+		srv.Authenticate(req)
+	}
+}
+
+func init() {
+	utils.SystemName = systemName
+	utils.RequestHook = authenticate
+}
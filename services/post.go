@@ -0,0 +1,157 @@
+package services
+
+// DAS service module
+// POST module, it sends long lists of values to data-service APIs which
+// accept them in POST body, lists are split into chunks which are fetched in
+// parallel and their responses are merged together
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
+// helper function to return POST declaration of DAS map
+func getPost(dasmap mongo.DASRecord) *dasmaps.Post {
+	post, err := dasmaps.GetPost(dasmap)
+	if err != nil {
+		log.Printf("ERROR: DAS map %v:%v, %v\n", dasmap["system"], dasmap["urn"], err)
+		return nil
+	}
+	return post
+}
+
+// PostURL returns POST url of DAS map adjusted for given DAS query, it
+// returns empty string for DAS maps without POST declaration
+func PostURL(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string {
+	post := getPost(dasmap)
+	if post == nil {
+		return ""
+	}
+	return BaseURL(dasquery, mongo.DASRecord{"system": dasmap["system"], "url": post.Url})
+}
+
+// FindPost returns POST declaration of DAS map whose POST url is given one
+func FindPost(dasquery dasql.DASQuery, maps []mongo.DASRecord, furl string) *dasmaps.Post {
+	for _, dmap := range maps {
+		if post := getPost(dmap); post != nil && PostURL(dasquery, dmap) == furl {
+			return post
+		}
+	}
+	return nil
+}
+
+// helper function to convert GET request of DAS map into POST one when list
+// of values of its POST argument exceeds POST threshold. All URL parameters
+// are moved into JSON body and values of POST argument are kept as a list.
+func postRequest(dasquery dasql.DASQuery, dasmap mongo.DASRecord, furl, args string) (string, string) {
+	if args != "" || furl == "" || furl == "local_api" {
+		return furl, args
+	}
+	post := getPost(dasmap)
+	if post == nil {
+		return furl, args
+	}
+	u, err := url.Parse(furl)
+	if err != nil {
+		return furl, args
+	}
+	vals := u.Query()
+	if len(vals[post.Arg]) <= post.Threshold {
+		return furl, args
+	}
+	body := make(map[string]interface{})
+	for key, values := range vals {
+		if key == post.Arg || len(values) > 1 {
+			body[key] = values
+		} else {
+			body[key] = values[0]
+		}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("ERROR: unable to form POST request for %s, error %v\n", furl, err)
+		return furl, args
+	}
+	return PostURL(dasquery, dasmap), string(data)
+}
+
+// FetchChunks fetches given POST request in chunks of POST argument values
+// and sends merged response to given channel
+func FetchChunks(client *http.Client, furl, args string, post *dasmaps.Post, out chan<- utils.ResponseType) {
+	out <- fetchChunks(client, furl, args, post)
+}
+
+// helper function to fetch POST request in chunks in parallel and merge their
+// responses, data-service should return JSON list of records. The first
+// failed chunk response is returned as is.
+func fetchChunks(client *http.Client, furl, args string, post *dasmaps.Post) utils.ResponseType {
+	startTime := time.Now()
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &body); err != nil {
+		return utils.ResponseType{Url: furl, Params: args, Method: "POST", Error: err}
+	}
+	var values []string
+	if items, ok := body[post.Arg].([]interface{}); ok {
+		for _, v := range items {
+			values = append(values, fmt.Sprintf("%v", v))
+		}
+	}
+	chunks := post.Chunks(values)
+	if len(chunks) < 2 {
+		return utils.FetchResponse(client, furl, args)
+	}
+	responses := make([]utils.ResponseType, len(chunks))
+	var wg sync.WaitGroup
+	for idx, chunk := range chunks {
+		cbody := make(map[string]interface{})
+		for key, val := range body {
+			cbody[key] = val
+		}
+		cbody[post.Arg] = chunk
+		cargs, err := json.Marshal(cbody)
+		if err != nil {
+			return utils.ResponseType{Url: furl, Params: args, Method: "POST", Error: err}
+		}
+		wg.Add(1)
+		go func(idx int, cargs string) {
+			defer wg.Done()
+			responses[idx] = utils.FetchResponse(client, furl, cargs)
+		}(idx, string(cargs))
+	}
+	wg.Wait()
+	response := utils.ResponseType{Url: furl, Params: args, Method: "POST"}
+	records := []json.RawMessage{}
+	for _, r := range responses {
+		var recs []json.RawMessage
+		if r.Error != nil || json.Unmarshal(r.Data, &recs) != nil {
+			r.Url = furl
+			return r
+		}
+		records = append(records, recs...)
+		response.SendBytes += r.SendBytes
+		response.RecvBytes += r.RecvBytes
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		response.Error = err
+	}
+	response.Data = data
+	response.Time = time.Since(startTime)
+	if utils.VERBOSE > 0 {
+		log.Printf("DAS POST url=\"%s\" values=%d chunks=%d time=%v\n", furl, len(values), len(chunks), response.Time)
+	}
+	return response
+}
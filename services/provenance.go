@@ -0,0 +1,144 @@
+package services
+
+// DAS service module
+// provenance module, it keeps track of data-services which provided
+// sub-records and fields of merged DAS records
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Source represents data-service which provided sub-record of DAS record
+type Source struct {
+	Key       string   `json:"key" bson:"key"`                                 // DAS key of sub-record, e.g. dataset
+	Index     int      `json:"index" bson:"index"`                             // index of sub-record among sub-records of DAS key
+	Service   string   `json:"service" bson:"service"`                         // data-service, i.e. system:api
+	System    string   `json:"system" bson:"system"`                           // data-service system, e.g. dbs3
+	Api       string   `json:"api" bson:"api"`                                 // data-service API, e.g. datasets
+	Url       string   `json:"url" bson:"url"`                                 // URL of data-service API
+	Ts        int64    `json:"ts" bson:"ts"`                                   // time when sub-record was fetched
+	Fields    []string `json:"fields" bson:"fields"`                           // fields of sub-record
+	Duplicate bool     `json:"duplicate,omitempty" bson:"duplicate,omitempty"` // sub-record is identical to one provided by another service
+}
+
+// helper function to return list of strings from given value
+func stringList(val interface{}) []string {
+	var out []string
+	switch v := val.(type) {
+	case []string:
+		out = append(out, v...)
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, fmt.Sprintf("%v", item))
+		}
+	}
+	return out
+}
+
+// helper function to convert DAS record into source
+func recordSource(rec mongo.DASRecord) Source {
+	src := Source{Fields: stringList(rec["fields"])}
+	src.Key, _ = rec["key"].(string)
+	src.Service, _ = rec["service"].(string)
+	src.System, _ = rec["system"].(string)
+	src.Api, _ = rec["api"].(string)
+	src.Url, _ = rec["url"].(string)
+	src.Duplicate, _ = rec["duplicate"].(bool)
+	switch v := rec["index"].(type) {
+	case int:
+		src.Index = v
+	case int64:
+		src.Index = int(v)
+	case float64:
+		src.Index = int(v)
+	}
+	switch v := rec["ts"].(type) {
+	case int64:
+		src.Ts = v
+	case int:
+		src.Ts = int64(v)
+	case float64:
+		src.Ts = int64(v)
+	}
+	return src
+}
+
+// Provenance returns sources of sub-records of DAS record with given das part
+func Provenance(das mongo.DASRecord) []Source {
+	var out []Source
+	switch v := das["provenance"].(type) {
+	case []Source:
+		out = append(out, v...)
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, recordSource(mongo.Convert2DASRecord(item)))
+		}
+	}
+	return out
+}
+
+// FieldSources returns data-services which provided every field of DAS
+// record with given das part, e.g. {"dataset.nevents": ["dbs3:datasets"]}
+func FieldSources(das mongo.DASRecord) map[string][]string {
+	out := make(map[string][]string)
+	for _, src := range Provenance(das) {
+		for _, field := range src.Fields {
+			key := fmt.Sprintf("%s.%s", src.Key, field)
+			if !utils.InList(src.Service, out[key]) {
+				out[key] = append(out[key], src.Service)
+			}
+		}
+	}
+	return out
+}
+
+// helper function to create sources of sub-records of DAS data record, index
+// of sub-record is counted from given offset of its DAS key
+func recordSources(rec mongo.DASRecord, offsets map[string]int, duplicate bool) []Source {
+	var out []Source
+	das, ok := rec["das"].(mongo.DASRecord)
+	if !ok {
+		return out
+	}
+	var srv string
+	if srvs := services(das); len(srvs) > 0 {
+		srv = srvs[0]
+	}
+	url, _ := das["url"].(string)
+	ts, _ := mongo.GetInt64Value(das, "ts")
+	arr := strings.SplitN(srv, ":", 2)
+	system, api := arr[0], ""
+	if len(arr) > 1 {
+		api = arr[1]
+	}
+	content := recordContent(rec)
+	keys := utils.MapKeys(content)
+	sort.Strings(keys)
+	for _, key := range keys {
+		for idx, sub := range subRecords(rec, key) {
+			fields := utils.MapKeys(sub)
+			sort.Strings(fields)
+			src := Source{
+				Key:       key,
+				Index:     offsets[key] + idx,
+				Service:   srv,
+				System:    system,
+				Api:       api,
+				Url:       url,
+				Ts:        ts,
+				Fields:    fields,
+				Duplicate: duplicate,
+			}
+			out = append(out, src)
+		}
+	}
+	return out
+}
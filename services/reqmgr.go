@@ -20,6 +20,11 @@ import (
 	"github.com/dmwm/das2go/utils"
 )
 
+// register local APIs of this module
+func init() {
+	RegisterLocalAPI(LocalAPI{System: "reqmgr2", Urn: "configs", Required: []string{"dataset"}, Description: "configuration files for given dataset", Function: "Configs", Call: LocalAPIs{}.Configs})
+}
+
 // helper function to load ReqMgr data stream
 func loadReqMgrData(api string, data []byte) []mongo.DASRecord {
 	var out []mongo.DASRecord
@@ -0,0 +1,39 @@
+package reqmgr
+
+// DAS service module
+// ReqMgr2 service plugin
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"net/http"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Service represents ReqMgr2 data-service
+type Service struct {
+	services.Base
+}
+
+func init() {
+	srv := &Service{services.Base{Name: "reqmgr2", Pattern: "reqmgr", ErrorCode: utils.ReqMgrError, ErrorName: utils.ReqMgrErrorName}}
+	services.RegisterService(srv)
+}
+
+// Authenticate asks ReqMgr2 to return JSON
+func (s *Service) Authenticate(req *http.Request) error {
+	if req.Method == "GET" {
+		req.Header.Add("Accept", "application/json")
+	}
+	return nil
+}
+
+// Decode converts ReqMgr2 response into DAS records
+func (s *Service) Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord {
+	return services.ReqMgrUnmarshal(api, data)
+}
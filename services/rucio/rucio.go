@@ -0,0 +1,94 @@
+package rucio
+
+// DAS service module
+// Rucio service plugin
+//
+// Copyright (c) 2018 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// Service represents Rucio data-service
+type Service struct {
+	services.Base
+}
+
+func init() {
+	srv := &Service{services.Base{Name: "rucio", Pattern: "rucio", ErrorCode: utils.RucioError, ErrorName: utils.RucioErrorName}}
+	services.RegisterService(srv)
+}
+
+// Request forms Rucio REST URL for given DAS query and DAS map
+func (s *Service) Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string) {
+	urn, _ := dasmap["urn"].(string)
+	site, ok := dasquery.Spec["site"]
+	if ok && urn == "file4dataset_site" {
+		// remove site from site since it should not go to REST URL
+		delete(dasquery.Spec, "site")
+	}
+	furl := services.FormRESTUrl(dasquery, dasmap)
+	if ok && urn == "file4dataset_site" { // put back site condition into dasquery spec
+		dasquery.Spec["site"] = site
+	}
+	if furl == "" || furl == "local_api" {
+		return furl, ""
+	}
+	if ok && urn == "file4dataset_site" {
+		furl += "?deep=True"
+	}
+	switch urn {
+	case "block4dataset_size":
+		// add datasets after url which will return CMS blocks (Rucio datasets)
+		furl = fmt.Sprintf("%s/datasets/", furl)
+	case "rses":
+		// cut off site parameter from REST URL since no site condition is supported yet
+		arr := strings.Split(furl, "/rses/")
+		furl = fmt.Sprintf("%s/rses/", arr[0])
+	case "block4dataset":
+		furl = fmt.Sprintf("%s/dids", furl)
+	case "rules4dataset", "rules4block", "rules4file":
+		// adjust rest URL
+		furl = fmt.Sprintf("%s/rules", furl)
+	}
+	return furl, ""
+}
+
+// Authenticate adds Rucio authentication token and account to HTTP request
+func (s *Service) Authenticate(req *http.Request) error {
+	token, err := utils.RucioAuth.Token()
+	if err == nil {
+		req.Header.Add("X-Rucio-Auth-Token", token)
+	}
+	req.Header.Add("Accept", "application/x-json-stream")
+	req.Header.Add("Connection", "Keep-Alive")
+	if utils.WEBSERVER > 0 {
+		req.Header.Add("X-Rucio-Account", utils.RucioAuth.Account())
+	}
+	return err
+}
+
+// Decode converts Rucio response into DAS records
+func (s *Service) Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord {
+	return services.RucioUnmarshal(dasquery, api, data)
+}
+
+// Health checks Rucio ping API
+func (s *Service) Health(client *http.Client, base string) error {
+	if services.RucioURL != "" {
+		base = services.RucioURL
+	}
+	if u, err := url.Parse(base); err == nil && u.Host != "" {
+		base = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	}
+	return s.Base.Health(client, base+"/ping")
+}
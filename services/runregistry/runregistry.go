@@ -0,0 +1,69 @@
+package runregistry
+
+// DAS service module
+// RunRegistry service plugin
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// list of RunRegistry columns we ask for
+var columns = "number%2CstartTime%2CstopTime%2Ctriggers%2CrunClassName%2CrunStopReason%2Cbfield%2CgtKey%2Cl1Menu%2ChltKeyDescription%2ClhcFill%2ClhcEnergy%2CrunCreated%2Cmodified%2ClsCount%2ClsRanges"
+
+// Service represents RunRegistry data-service
+type Service struct {
+	services.Base
+}
+
+func init() {
+	srv := &Service{services.Base{Name: "runregistry", Pattern: "runregistry", ErrorCode: utils.RunRegistryError, ErrorName: utils.RunRegistryErrorName}}
+	services.RegisterService(srv)
+}
+
+// BaseURL returns RunRegistry run summary URL with custom columns
+func (s *Service) BaseURL(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string {
+	furl, _ := dasmap["url"].(string)
+	furl = strings.TrimSuffix(furl, "/")
+	return fmt.Sprintf("%s/api/GLOBAL/runsummary/json/%s/none/data", furl, columns)
+}
+
+// Request forms RunRegistry URL and POST filter for given DAS query
+func (s *Service) Request(dasquery dasql.DASQuery, dasmap mongo.DASRecord) (string, string) {
+	var args string
+	switch v := dasquery.Spec["run"].(type) {
+	case string:
+		args = fmt.Sprintf("{\"filter\": {\"number\": \">= %s and <= %s\"}}", v, v)
+	case []string:
+		cond := fmt.Sprintf("= %s", v[0])
+		for i, vvv := range v {
+			if i > 0 {
+				cond = fmt.Sprintf("%s or = %s", cond, vvv)
+			}
+		}
+		args = fmt.Sprintf("{\"filter\": {\"number\": \"%s\"}}", cond)
+	}
+	switch v := dasquery.Spec["date"].(type) {
+	case string:
+		t := utils.RunRegistryTime(v)
+		n := utils.RunRegistryTime(utils.Unix2DASTime(utils.UnixTime(v) + 25*60*60))
+		args = fmt.Sprintf("{\"filter\": {\"startTime\": \">= %s and < %s\"}}", t, n)
+	case []string:
+		cond := fmt.Sprintf(">= %s and <= %s", utils.RunRegistryTime(v[0]), utils.RunRegistryTime(v[len(v)-1]))
+		args = fmt.Sprintf("{\"filter\": {\"startTime\": \"%s\"}}", cond)
+	}
+	return s.BaseURL(dasquery, dasmap), args
+}
+
+// Decode converts RunRegistry response into DAS records
+func (s *Service) Decode(dasquery dasql.DASQuery, api string, data []byte) []mongo.DASRecord {
+	return services.RunRegistryUnmarshal(api, data)
+}
@@ -7,6 +7,8 @@ package services
 //
 
 import (
+	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -56,36 +58,39 @@ func remap(api string, records []mongo.DASRecord, notations []mongo.DASRecord) [
 func Unmarshal(dasquery dasql.DASQuery, system, api string, r utils.ResponseType, notations []mongo.DASRecord, pkeys []string) []mongo.DASRecord {
 	var out []mongo.DASRecord
 	if r.Error != nil {
-		rec := CreateDASErrorRecord(dasquery, pkeys)
-		out = append(out, rec)
+		out = append(out, ServiceErrorRecord(dasquery, system, r.Error, pkeys))
 		return out
 	}
-	data := r.Data
-	switch {
-	case system == "rucio":
-		out = RucioUnmarshal(dasquery, api, data)
-	case system == "phedex":
-		out = PhedexUnmarshal(api, data)
-	case system == "dbs3" || system == "dbs":
-		out = DBSUnmarshal(api, data)
-	case system == "reqmgr" || system == "reqmgr2":
-		out = ReqMgrUnmarshal(api, data)
-	case system == "mcm":
-		out = McMUnmarshal(api, data)
-	case system == "dashboard":
-		out = DashboardUnmarshal(api, data)
-	case system == "conddb":
-		out = CondDBUnmarshal(api, data)
-	case system == "runregistry":
-		out = RunRegistryUnmarshal(api, data)
-	case system == "sitedb2":
-		out = SiteDBUnmarshal(api, data)
-	case system == "cric":
-		out = CRICUnmarshal(api, data)
+	srv, ok := GetService(system)
+	if !ok {
+		err := fmt.Errorf("no service is registered for system %s, api %s", system, api)
+		log.Printf("ERROR: %v\n", err)
+		out = append(out, ServiceErrorRecord(dasquery, system, err, pkeys))
+		return out
 	}
+	out = srv.Decode(dasquery, api, r.Data)
 	return remap(api, out, notations)
 }
 
+// ServiceErrorRecord creates DAS error record for error of given system, the
+// record is created by CreateDASErrorRecord while service plugin provides
+// error details, i.e. error message, type and code
+func ServiceErrorRecord(dasquery dasql.DASQuery, system string, err error, pkeys []string) mongo.DASRecord {
+	rec := CreateDASErrorRecord(dasquery, pkeys)
+	var erec mongo.DASRecord
+	if srv, ok := GetService(system); ok {
+		erec = srv.Error(err)
+	} else {
+		erec = mongo.DASErrorRecord(fmt.Sprintf("%v", err), utils.DASServerErrorName, utils.DASServerError)
+	}
+	for key, val := range erec {
+		if key != "das" && key != "qhash" {
+			rec[key] = val
+		}
+	}
+	return rec
+}
+
 // DASHeader represents DAS Header
 func DASHeader() mongo.DASRecord {
 	das := make(mongo.DASRecord)
@@ -98,13 +103,15 @@ func DASHeader() mongo.DASRecord {
 
 }
 
-// AdjustRecords adjusts DAS record and add (if necessary) leading key from DAS query
-func AdjustRecords(dasquery dasql.DASQuery, system, api string, records []mongo.DASRecord, expire int, pkeys []string) []mongo.DASRecord {
+// AdjustRecords adjusts DAS record and add (if necessary) leading key from DAS query,
+// DAS header of records keeps URL of data-service API and time when records were fetched
+func AdjustRecords(dasquery dasql.DASQuery, system, api, url string, records []mongo.DASRecord, expire int, pkeys []string) []mongo.DASRecord {
 	var out []mongo.DASRecord
 	fields := dasquery.Fields
 	qhash := dasquery.Qhash
 	spec := dasquery.Spec
 	skey := fields[0]
+	ts := time.Now().Unix()
 	for _, rec := range records {
 		if rec == nil {
 			rec = make(mongo.DASRecord)
@@ -125,6 +132,8 @@ func AdjustRecords(dasquery dasql.DASQuery, system, api string, records []mongo.
 		dasheader["expire"] = utils.Expire(expire)
 		dasheader["primary_key"] = pkeys[0]
 		dasheader["instance"] = dasquery.Instance
+		dasheader["url"] = url
+		dasheader["ts"] = ts
 
 		keys := utils.MapKeys(rec)
 		if utils.InList(skey, keys) {
@@ -222,72 +231,6 @@ func GetExpire(rec mongo.DASRecord) int64 {
 	return expire
 }
 
-// MergeDASRecords merges DAS data records
-func MergeDASRecords(dasquery dasql.DASQuery) ([]mongo.DASRecord, int64) {
-	// get DAS record and extract primary key
-	spec := bson.M{"qhash": dasquery.Qhash, "das.record": 0}
-	records := mongo.Get("das", "cache", spec, 0, 1)
-	if len(records) == 0 {
-		return records, time.Now().Unix() + 1
-	}
-	dasrecord := records[0]
-	das := dasrecord["das"].(mongo.DASRecord)
-	lkeys := dasquery.Fields
-	pkey := das["primary_key"].(string)
-	mkey := strings.Split(pkey, ".")[0]
-	// get DAS data record sorted by primary key
-	spec = bson.M{"qhash": dasquery.Qhash, "das.record": 1}
-	var skeys []string
-	skeys = append(skeys, pkey)
-	if len(lkeys) > 1 {
-		records = mongo.Get("das", "cache", spec, 0, -1) // get all unsorted records
-		status := das["status"].(string)
-		expire := das["expire"].(int64)
-		for _, rec := range records {
-			das := rec["das"].(mongo.DASRecord)
-			das["status"] = status
-			rec["das"] = das
-		}
-		return records, expire
-	}
-
-	// loop over data records and merge them, extract smallest expire timestamp
-	var expire int64
-	expire = time.Now().Unix() * 2
-	var out []mongo.DASRecord
-	var oldrec, rec mongo.DASRecord
-	if len(skeys) > 0 {
-		records = mongo.GetSorted("das", "cache", spec, skeys)
-	} else {
-		records = mongo.Get("das", "cache", spec, 0, -1) // get all unsorted records
-		return records, time.Now().Unix() + 300
-	}
-	for idx, rec := range records {
-		if idx == 0 { // we need to advance to new record because of init conditions above
-			oldrec = rec
-			continue
-		}
-		das := rec["das"].(mongo.DASRecord)
-		dasexpire := das["expire"].(int64)
-		if expire > dasexpire {
-			expire = dasexpire
-		}
-		data1, err1 := mongo.GetSingleStringValue(oldrec, pkey)
-		data2, err2 := mongo.GetSingleStringValue(rec, pkey)
-		if err1 == nil && err2 == nil && data1 != data2 {
-			out = append(out, oldrec)
-		} else {
-			rec = mergeRecords(rec, oldrec, mkey, dasquery.Qhash)
-		}
-		oldrec = rec
-	}
-	// we still left with last oldrec which should be merged with last record from the loop
-	if rec[mkey] == nil {
-		out = append(out, oldrec)
-	}
-	return out, expire
-}
-
 // helper function to get DAS records from different interfaces
 func getRecords(rec mongo.DASRecord, pkey string) []mongo.DASRecord {
 	var out []mongo.DASRecord
@@ -306,22 +249,6 @@ func getRecords(rec mongo.DASRecord, pkey string) []mongo.DASRecord {
 	return out
 }
 
-// function to merge DAS data records on given key
-func mergeRecords(oldrec, newrec mongo.DASRecord, pkey, qhash string) mongo.DASRecord {
-	var rec, records []mongo.DASRecord
-	// when we look-up via primary key we always should get list of DAS records
-	records = getRecords(oldrec, pkey)
-	for _, r := range records {
-		rec = append(rec, r)
-	}
-	records = getRecords(newrec, pkey)
-	for _, r := range records {
-		rec = append(rec, r)
-	}
-	das := mergeDASparts(oldrec["das"].(mongo.DASRecord), newrec["das"].(mongo.DASRecord))
-	return mongo.DASRecord{pkey: rec, "qhash": qhash, "das": das}
-}
-
 // helper function to extract services from das record
 func services(das mongo.DASRecord) []string {
 	var srvs []string
@@ -365,11 +292,26 @@ func mergeDASparts(das1, das2 mongo.DASRecord) mongo.DASRecord {
 	das["expire"] = expire
 	das["status"] = "ok" // merged step should return ok status
 	das["primary_key"] = das1["primary_key"]
-	das["instance"] = das1["instance"]
+	das["instance"] = mergeInstances(das1["instance"], das2["instance"])
 	das["record"] = 1
 	return das
 }
 
+// helper function to merge DBS instances of two DAS headers, records of
+// fan-out queries may come from different instances, e.g. prod/global,prod/phys03
+func mergeInstances(inst1, inst2 interface{}) string {
+	var out []string
+	for _, inst := range []interface{}{inst1, inst2} {
+		val, _ := inst.(string)
+		for _, v := range strings.Split(val, ",") {
+			if v != "" && !utils.InList(v, out) {
+				out = append(out, v)
+			}
+		}
+	}
+	return strings.Join(out, ",")
+}
+
 // UpdateExpire helper function to fix all DAS cache record expire timestamps
 func UpdateExpire(qhash string, records []mongo.DASRecord, dasexpire int64) []mongo.DASRecord {
 	var out []mongo.DASRecord
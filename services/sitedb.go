@@ -19,6 +19,16 @@ import (
 	"github.com/dmwm/das2go/utils"
 )
 
+// register local APIs of this module
+func init() {
+	RegisterLocalAPI(LocalAPI{System: "sitedb2", Urn: "site_names", Required: nil, Description: "SiteDB site names", Function: "SiteNames", Call: LocalAPIs{}.SiteNames})
+	RegisterLocalAPI(LocalAPI{System: "sitedb2", Urn: "groups", Required: nil, Description: "SiteDB groups", Function: "Groups", Call: LocalAPIs{}.Groups})
+	RegisterLocalAPI(LocalAPI{System: "sitedb2", Urn: "group_responsibilities", Required: nil, Description: "SiteDB group responsibilities", Function: "GroupResponsibilities", Call: LocalAPIs{}.GroupResponsibilities})
+	RegisterLocalAPI(LocalAPI{System: "sitedb2", Urn: "people_via_email", Required: nil, Description: "SiteDB people for given email", Function: "PeopleEmail", Call: LocalAPIs{}.PeopleEmail})
+	RegisterLocalAPI(LocalAPI{System: "sitedb2", Urn: "people_via_name", Required: nil, Description: "SiteDB people for given name", Function: "PeopleName", Call: LocalAPIs{}.PeopleName})
+	RegisterLocalAPI(LocalAPI{System: "sitedb2", Urn: "roles", Required: nil, Description: "SiteDB roles", Function: "Roles", Call: LocalAPIs{}.Roles})
+}
+
 // helper function to load SiteDB data stream
 func loadSiteDBData(api string, data []byte) []mongo.DASRecord {
 	var out []mongo.DASRecord
@@ -0,0 +1,281 @@
+package services
+
+// DAS service module
+// URL module, it forms data-service URLs from DAS query and DAS map
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
+// ArgFunc converts value of DAS key into URL parameters in a service specific
+// way. The val is either string or list of strings. It returns true if value
+// was handled by the function and true if arg should be counted as used one.
+type ArgFunc func(dasquery dasql.DASQuery, dkey, arg string, val interface{}, vals url.Values) (bool, bool)
+
+// URLHooks holds service adjustments applied by FormUrlCall
+type URLHooks struct {
+	Base   string     // base URL to use instead of DAS map url
+	Values url.Values // initial set of URL parameters
+	Arg    ArgFunc    // service specific conversion of DAS key values
+}
+
+// Extract API call parameters from das map entry
+func getApiParams(dasmap mongo.DASRecord) (string, string, string, string) {
+	dasKey, ok := dasmap["das_key"].(string)
+	if !ok {
+		dasKey = ""
+	}
+	recKey, ok := dasmap["rec_key"].(string)
+	if !ok {
+		recKey = ""
+	}
+	apiArg, ok := dasmap["api_arg"].(string)
+	if !ok {
+		apiArg = ""
+	}
+	pattern, ok := dasmap["pattern"].(string)
+	if !ok {
+		pattern = ""
+	}
+	return dasKey, recKey, apiArg, pattern
+}
+
+// helper function to apply transformation rules to values matching given pattern,
+// it replaces existing values of API arguments and returns their names
+func transformArgs(transform *dasmaps.Transform, arg, pat string, val interface{}, vals url.Values) []string {
+	var values []string
+	switch v := val.(type) {
+	case string:
+		values = []string{v}
+	case []string:
+		values = v
+	}
+	var matched []string
+	for _, v := range values {
+		if ok, _ := regexp.MatchString(pat, v); ok || pat == "" {
+			matched = append(matched, v)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	var args []string
+	for key, items := range transform.Apply(arg, matched) {
+		vals[key] = items
+		args = append(args, key)
+	}
+	return args
+}
+
+// FormUrlCall forms appropriate URL from given dasquery and dasmap, the final URL
+// contains all parameters. Service specific adjustments are provided via hooks
+// which can be nil.
+func FormUrlCall(dasquery dasql.DASQuery, dasmap mongo.DASRecord, hooks *URLHooks) string {
+
+	// defer function profiler
+	defer utils.MeasureTime("services/FormUrlCall")()
+
+	if hooks == nil {
+		hooks = &URLHooks{}
+	}
+	vals := hooks.Values
+	if vals == nil {
+		vals = url.Values{}
+	}
+	spec := dasquery.Spec
+	skeys := utils.MapKeys(spec)
+	base, ok := dasmap["url"].(string)
+	if hooks.Base != "" {
+		base = hooks.Base
+	}
+	if !strings.HasPrefix(base, "http") {
+		return "local_api"
+	}
+	// Exception block, current DAS maps contains APIs which should be treated
+	// as local apis, e.g. file_run_lumi4dataset in DBS3 maps. In a future
+	// I'll need to fix DBS3 maps to make it local_api
+	// For time being I'll list those exceptional APIs in DASLocalAPIs list
+	urn, _ := dasmap["urn"].(string)
+	if utils.InList(urn, DASLocalAPIs()) {
+		return "local_api"
+	}
+	if !ok {
+		log.Println("Unable to extract url from DAS map", dasmap)
+	}
+	var useArgs []string
+	for _, dmap := range dasmaps.GetDASMaps(dasmap["das_map"]) {
+		dkey, rkey, arg, pat := getApiParams(dmap)
+		if utils.InList(dkey, skeys) {
+			transform, err := dasmaps.GetTransform(dmap)
+			if err != nil {
+				log.Printf("ERROR: DAS map %v, %v\n", dmap, err)
+			}
+			if transform != nil {
+				if args := transformArgs(transform, arg, pat, spec[dkey], vals); len(args) > 0 {
+					useArgs = append(useArgs, arg)
+					useArgs = append(useArgs, args...)
+				}
+				continue
+			}
+			val, ok := spec[dkey].(string)
+			if ok {
+				matched, _ := regexp.MatchString(pat, val)
+				if matched || pat == "" {
+					if hooks.Arg != nil {
+						if handled, used := hooks.Arg(dasquery, dkey, arg, val, vals); handled {
+							if used {
+								useArgs = append(useArgs, arg)
+							}
+							continue
+						}
+					}
+					if vvv, ok := vals[arg]; ok {
+						if !utils.InList(val, vvv) {
+							vals.Add(arg, val)
+						}
+					} else {
+						vals.Add(arg, val)
+					}
+					useArgs = append(useArgs, arg)
+				}
+			} else { // let's try array of strings
+				arr, ok := spec[dkey].([]string)
+				if !ok {
+					fmt.Println("WARNING, unable to get value(s) for daskey=", dkey,
+						", reckey=", rkey, " from spec=", spec, " das map=", dmap)
+				}
+				if hooks.Arg != nil {
+					if handled, used := hooks.Arg(dasquery, dkey, arg, arr, vals); handled {
+						if used {
+							useArgs = append(useArgs, arg)
+						}
+						continue
+					}
+				}
+				for _, val := range arr {
+					matched, _ := regexp.MatchString(pat, val)
+					if matched || pat == "" {
+						vals.Add(arg, val)
+						useArgs = append(useArgs, arg)
+					}
+				}
+			}
+		}
+	}
+	// loop over params in DAS maps and add additional arguments which have
+	// non empty, non optional and non required values
+	skipList := []string{"optional", "required"}
+	params := mongo.Convert2DASRecord(dasmap["params"])
+	for key, val := range params {
+		switch v := val.(type) {
+		case string:
+			vvv := v
+			if !utils.InList(key, useArgs) && !utils.InList(vvv, skipList) && vvv != "*" {
+				if _, ok := vals[key]; !ok {
+					vals.Add(key, vvv)
+				}
+			}
+		case []interface{}:
+			for _, value := range v {
+				vvv := fmt.Sprintf("%s", value)
+				if !utils.InList(key, useArgs) && !utils.InList(vvv, skipList) && vvv != "*" {
+					if _, ok := vals[key]; !ok {
+						vals.Add(key, vvv)
+					}
+				}
+			}
+		}
+	}
+
+	// Encode all arguments for url
+	args := vals.Encode()
+	if len(vals) < len(skeys) {
+		return "" // number of arguments should be equal or more number of spec key values
+	}
+	// replace details=True argument in DBS calls
+	if dasquery.Detail == false {
+		args = strings.Replace(args, "detail=True", "detail=False", -1)
+	}
+	// replace details=True argument in DBS calls
+	if strings.Contains(args, "detail") {
+		if v, ok := vals["detail"]; ok {
+			sv := fmt.Sprintf("%v", v)
+			if sv == "0" || sv == "false" || sv == "False" {
+				args = strings.Replace(args, "detail=True", "detail=False", -1)
+			}
+		}
+	}
+	if len(args) > 0 {
+		return base + "?" + args
+	}
+	return base
+}
+
+// FormRESTUrl forms appropriate URL from given dasquery and dasmap, the final URL
+// contains all parameters
+func FormRESTUrl(dasquery dasql.DASQuery, dasmap mongo.DASRecord) string {
+
+	// defer function profiler
+	defer utils.MeasureTime("services/FormRESTUrl")()
+
+	spec := dasquery.Spec
+	skeys := utils.MapKeys(spec)
+	base, ok := dasmap["url"].(string)
+	if !ok {
+		log.Println("Unable to extract url from DAS map", dasmap)
+	}
+	if !strings.HasPrefix(base, "http") {
+		return "local_api"
+	}
+	// Exception block, current DAS maps contains APIs which should be treated
+	// as local apis, e.g. reqmgr_config_cache
+	urn, _ := dasmap["urn"].(string)
+	if utils.InList(urn, DASLocalAPIs()) {
+		return "local_api"
+	}
+	dasmaps := dasmaps.GetDASMaps(dasmap["das_map"])
+	for _, dmap := range dasmaps {
+		dkey, _, _, pat := getApiParams(dmap)
+		if utils.InList(dkey, skeys) {
+			switch spec[dkey].(type) {
+			case string:
+				val, _ := spec[dkey].(string)
+				matched, _ := regexp.MatchString(pat, val)
+				if matched || pat == "" {
+					if strings.HasPrefix(val, "/") {
+						if strings.HasSuffix(base, "/") {
+							return base[0:len(base)-1] + val
+						}
+						return base + val
+					}
+					if strings.HasSuffix(base, "/") {
+						return base + val
+					}
+					return base + "/" + val
+				}
+			case []string:
+				val, _ := spec[dkey].([]string)
+				matched, _ := regexp.MatchString(pat, val[0])
+				if matched || pat == "" {
+					return base
+				}
+			default:
+				log.Printf("ERROR: invalid type for DAS key, type %T, key %v, map %v\n", spec[dkey], dkey, dmap)
+				return ""
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/web"
+)
+
+// TestBulkRequest tests expansion of bulk request queries
+func TestBulkRequest(t *testing.T) {
+	req := web.BulkRequest{Queries: []string{"dataset=/a/b/RAW"}, Template: "site dataset=%s", Values: []string{"/c/d/RAW", "/e/f/RAW"}}
+	queries, err := req.Expand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"dataset=/a/b/RAW", "site dataset=/c/d/RAW", "site dataset=/e/f/RAW"}
+	if len(queries) != len(expect) {
+		t.Fatalf("wrong number of queries %v", queries)
+	}
+	for i, q := range queries {
+		if q != expect[i] {
+			t.Errorf("query %d, expect %s, got %s", i, expect[i], q)
+		}
+	}
+	req = web.BulkRequest{Template: "site dataset=X", Values: []string{"/c/d/RAW"}}
+	if _, err := req.Expand(); err == nil {
+		t.Error("expect error for template without placeholder")
+	}
+	req = web.BulkRequest{}
+	if _, err := req.Expand(); err == nil {
+		t.Error("expect error for empty bulk request")
+	}
+}
+
+// helper function to wait until given condition is true
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met within 5 seconds")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// helper function to count bulk queries with given status
+func bulkStatusCount(job *web.BulkJob, status string) int {
+	var n int
+	for _, q := range job.Queries {
+		if s, _ := q.State(); s == status {
+			n++
+		}
+	}
+	return n
+}
+
+// helper function to create bulk job used by tests
+func testBulkJob(t *testing.T) *web.BulkJob {
+	req := web.BulkRequest{Queries: []string{"foo=bar"}, Template: "dataset dataset=%s", Values: []string{"/a/b/RAW", "/c/d/RAW", "/e/f/RAW", "/g/h/RAW", "/i/j/RAW"}}
+	job, err := web.NewBulkJob(req, "prod/global", []string{"dataset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.Queries) != 6 {
+		t.Fatalf("wrong number of bulk queries %d", len(job.Queries))
+	}
+	return job
+}
+
+// helper function to create process function of bulk runner, it tracks number
+// of queries processed in parallel and fails query of /c/d/RAW dataset
+func testBulkProcess(release chan struct{}, active, maxActive *int32) func(dasql.DASQuery) error {
+	return func(dasquery dasql.DASQuery) error {
+		n := atomic.AddInt32(active, 1)
+		defer atomic.AddInt32(active, -1)
+		for {
+			m := atomic.LoadInt32(maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(maxActive, m, n) {
+				break
+			}
+		}
+		<-release
+		if dasquery.Spec["dataset"] == "/c/d/RAW" {
+			return errors.New("upstream error")
+		}
+		return nil
+	}
+}
+
+// TestBulkRunner tests bounded parallelism and status changes of bulk queries
+func TestBulkRunner(t *testing.T) {
+	job := testBulkJob(t)
+	if status, qerr := job.Queries[0].State(); status != "fail" || qerr == "" {
+		t.Errorf("query with parse error should fail, status %s error %s", status, qerr)
+	}
+	var active, maxActive int32
+	release := make(chan struct{})
+	runner := web.BulkRunner{Parallel: 2, Process: testBulkProcess(release, &active, &maxActive)}
+	done := make(chan struct{})
+	go func() {
+		runner.Run(job)
+		close(done)
+	}()
+	waitFor(t, func() bool { return bulkStatusCount(job, "processing") == 2 })
+	time.Sleep(10 * time.Millisecond) // give other queries a chance to exceed the limit
+	if n := bulkStatusCount(job, "processing"); n != 2 {
+		t.Errorf("expect 2 processing queries, got %d", n)
+	}
+	if n := bulkStatusCount(job, "requested"); n != 3 {
+		t.Errorf("expect 3 requested queries, got %d", n)
+	}
+	close(release)
+	<-done
+	if maxActive != 2 {
+		t.Errorf("expect at most 2 queries processed in parallel, got %d", maxActive)
+	}
+	for _, q := range job.Queries[1:] {
+		status, qerr := q.State()
+		expect := "ok"
+		if strings.Contains(q.Query, "/c/d/RAW") {
+			expect = "fail"
+		}
+		if status != expect || (expect == "fail" && qerr != "upstream error") {
+			t.Errorf("query %s, status %s error %s, expect %s", q.Query, status, qerr, expect)
+		}
+	}
+	if job.Finished == 0 {
+		t.Error("finished time of bulk job is not set")
+	}
+}
+
+// TestBulkStream tests NDJSON output of bulk job
+func TestBulkStream(t *testing.T) {
+	job := testBulkJob(t)
+	var active, maxActive int32
+	release := make(chan struct{})
+	close(release)
+	var fetches int32
+	fetch := func(dasquery dasql.DASQuery, cursor string, limit int) (string, []mongo.DASRecord, string) {
+		atomic.AddInt32(&fetches, 1)
+		if dasquery.Spec["dataset"] == "/e/f/RAW" {
+			return "ok", nil, ""
+		}
+		// every query has 3 records fetched in pages
+		idx, _ := strconv.Atoi(cursor)
+		var data []mongo.DASRecord
+		for i := idx; i < 3 && len(data) < limit; i++ {
+			data = append(data, mongo.DASRecord{"dataset": dasquery.Spec["dataset"], "idx": i})
+		}
+		var next string
+		if idx+len(data) < 3 {
+			next = strconv.Itoa(idx + len(data))
+		}
+		return "ok", data, next
+	}
+	runner := web.BulkRunner{Parallel: 3, PageSize: 2, Process: testBulkProcess(release, &active, &maxActive), Fetch: fetch}
+	runner.Run(job)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/das/bulk?job="+job.Id, nil)
+	runner.Stream(w, r, job)
+	if ctype := w.Header().Get("Content-Type"); ctype != "application/x-ndjson" {
+		t.Errorf("wrong content type %s", ctype)
+	}
+	var nrec, nfail, nempty int
+	var queries []string
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid NDJSON line %s, error %v", line, err)
+		}
+		query, _ := rec["query"].(string)
+		if query == "" {
+			t.Errorf("NDJSON line without query %s", line)
+		}
+		if pid, _ := rec["pid"].(string); pid == "" && query != "foo=bar" {
+			t.Errorf("NDJSON line without pid %s", line)
+		}
+		if len(queries) == 0 || queries[len(queries)-1] != query {
+			queries = append(queries, query)
+		}
+		switch {
+		case rec["status"] == "fail":
+			nfail++
+		case rec["nresults"] != nil:
+			nempty++
+		case rec["record"] != nil:
+			record := rec["record"].(map[string]interface{})
+			if !strings.Contains(query, record["dataset"].(string)) {
+				t.Errorf("record %v is tagged with wrong query %s", record, query)
+			}
+			nrec++
+		}
+	}
+	if nrec != 9 || nfail != 2 || nempty != 1 {
+		t.Errorf("records %d, failed queries %d, empty queries %d", nrec, nfail, nempty)
+	}
+	if len(queries) != len(job.Queries) {
+		t.Fatalf("queries are not streamed in submission order %v", queries)
+	}
+	for i, q := range job.Queries {
+		if queries[i] != q.Query {
+			t.Errorf("query %d, expect %s, got %s", i, q.Query, queries[i])
+		}
+	}
+	// 3 queries with records are fetched in 2 pages and empty query in 1 page
+	if fetches != 7 {
+		t.Errorf("expect 7 fetches, got %d", fetches)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmwm/das2go/config"
+	"github.com/dmwm/das2go/utils"
+)
+
+// TestConfigReload
+func TestConfigReload(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "dasconfig.json")
+	data := `{"port": 8212, "frontend": "https://cmsweb.cern.ch", "verbose": 1, "dbsInstances": ["prod/global", "prod/phys03"]}`
+	if err := os.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig, err := config.ReadConfig(fname)
+	if err != nil {
+		t.Fatalf("Fail TestConfigReload, error %v\n", err)
+	}
+	if oldConfig.RucioUrl == "" || oldConfig.TLSCertsRenewInterval != 600 {
+		t.Errorf("Fail TestConfigReload, defaults are not set %+v\n", oldConfig)
+	}
+	data = `{"port": 9212, "frontend": "https://cmsweb.cern.ch", "verbose": 2, "dbsInstances": ["prod/global", "prod/phys03", "int/global"]}`
+	if err := os.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newConfig, err := config.ReadConfig(fname)
+	if err != nil {
+		t.Fatalf("Fail TestConfigReload, error %v\n", err)
+	}
+	cfg := config.Reload(oldConfig, newConfig)
+	if cfg.Port != 8212 || cfg.Verbose != 2 || len(cfg.DbsInstances) != 3 {
+		t.Errorf("Fail TestConfigReload, reloaded config %+v\n", cfg)
+	}
+	if keys := config.RestartKeys(oldConfig, newConfig); !utils.EqualLists(keys, []string{"port"}) {
+		t.Errorf("Fail TestConfigReload, restart keys %v\n", keys)
+	}
+	if err := os.WriteFile(fname, []byte(`{"port": 8212}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.ReadConfig(fname); err == nil {
+		t.Errorf("Fail TestConfigReload, config without frontend is accepted\n")
+	}
+}
+
+// TestConfigPublish tests that configuration can be replaced while it is read
+func TestConfigPublish(t *testing.T) {
+	old := *config.Current()
+	defer config.Publish(old)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			if cfg := config.Current(); cfg.Verbose < 0 {
+				t.Errorf("Fail TestConfigPublish, config %+v\n", cfg)
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		cfg := old
+		cfg.Verbose = i
+		config.Publish(cfg)
+	}
+	<-done
+	if config.Current().Verbose != 999 {
+		t.Errorf("Fail TestConfigPublish, verbose %d\n", config.Current().Verbose)
+	}
+}
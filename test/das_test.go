@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dmwm/das2go/das"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// helper function to create file record with given name and size
+func fileRecord(name string, size interface{}) mongo.DASRecord {
+	return mongo.DASRecord{"file": []interface{}{mongo.DASRecord{"name": name, "size": size}}}
+}
+
+// TestSortRecords
+func TestSortRecords(t *testing.T) {
+	var records []mongo.DASRecord
+	records = append(records, fileRecord("b", json.Number("100")))
+	records = append(records, fileRecord("a", json.Number("20")))
+	records = append(records, fileRecord("c", json.Number("100")))
+	records = append(records, fileRecord("d", "3"))
+
+	skeys := das.ParseSortKeys([]string{"-file.size", "file.name"})
+	if len(skeys) != 2 || !skeys[0].Descending || skeys[1].Descending {
+		t.Fatalf("Fail TestSortRecords, sort keys %+v\n", skeys)
+	}
+	results := das.SortRecords(records, skeys)
+	var names []string
+	for _, r := range results {
+		names = append(names, mongo.GetValue(r, "file.name").(string))
+	}
+	expect := []string{"b", "c", "a", "d"}
+	for i, n := range expect {
+		if names[i] != n {
+			t.Fatalf("Fail TestSortRecords, order %v, expect %v\n", names, expect)
+		}
+	}
+	msort := das.MongoSortKeys(skeys)
+	if strings.Join(msort, ",") != "-file.size,file.name,_id" {
+		t.Errorf("Fail TestSortRecords, MongoDB sort keys %v\n", msort)
+	}
+}
+
+// TestConditionSpec
+func TestConditionSpec(t *testing.T) {
+	spec := das.ConditionSpec([]string{"file.size>2GB", "file.size<=3.5GB", "file.name=*RAW*", "file.nevents in [1,2]", "block.name~^/a"})
+	size, ok := spec["file.size"].(bson.M)
+	if !ok || size["$gt"] != 2e9 || size["$lte"] != 3.5e9 {
+		t.Errorf("Fail TestConditionSpec, file.size condition %v\n", spec["file.size"])
+	}
+	name, ok := spec["file.name"].(bson.M)
+	if !ok || name["$regex"] != "^.*RAW.*$" {
+		t.Errorf("Fail TestConditionSpec, file.name condition %v\n", spec["file.name"])
+	}
+	nevts, ok := spec["file.nevents"].(bson.M)
+	if vals, _ := nevts["$in"].([]interface{}); !ok || len(vals) != 4 {
+		t.Errorf("Fail TestConditionSpec, file.nevents condition %v\n", spec["file.nevents"])
+	}
+	if block, ok := spec["block.name"].(bson.M); !ok || block["$regex"] != "^/a" {
+		t.Errorf("Fail TestConditionSpec, block.name condition %v\n", spec["block.name"])
+	}
+	spec = das.ConditionSpec([]string{"file.size>1", "file.size>2"})
+	if and, ok := spec["$and"].([]bson.M); !ok || len(and) != 1 {
+		t.Errorf("Fail TestConditionSpec, combined conditions %v\n", spec)
+	}
+}
+
+// TestCursorPage
+func TestCursorPage(t *testing.T) {
+	var records []mongo.DASRecord
+	for i, size := range []int{10, 30, 20, 30, 10, 30, 20} {
+		rec := fileRecord(string(rune('a'+i)), size)
+		rec["_id"] = bson.NewObjectId()
+		records = append(records, rec)
+	}
+	pid := "0123456789abcdef0123456789abcdef"
+	dasquery := dasql.DASQuery{Qhash: pid, Filters: map[string][]string{"sort": {"-file.size"}}}
+	skeys := das.ParseSortKeys([]string{"-file.size"})
+	sorted := das.SortRecords(records, skeys)
+
+	// walk forward through all pages
+	var names []string
+	var next string
+	page, more := das.CursorPage(sorted, skeys, &das.Cursor{Pid: pid}, 3)
+	for idx := 0; ; idx += len(page) {
+		for _, r := range page {
+			names = append(names, mongo.GetValue(r, "file.name").(string))
+		}
+		if !more {
+			break
+		}
+		next = das.PageCursors(dasquery, page, idx, 3).Next
+		c, err := das.DecodeCursor(dasquery, next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Index != idx+3 {
+			t.Errorf("Fail TestCursorPage, cursor index %d, expect %d\n", c.Index, idx+3)
+		}
+		page, more = das.CursorPage(sorted, skeys, c, 3)
+	}
+	expect := "bdfcgae"
+	if strings.Join(names, "") != expect {
+		t.Fatalf("Fail TestCursorPage, order %v, expect %s\n", names, expect)
+	}
+
+	// cursor remains valid when its boundary record is removed
+	first, _ := das.CursorPage(sorted, skeys, &das.Cursor{Pid: pid}, 3)
+	next = das.PageCursors(dasquery, first, 0, 3).Next
+	c, _ := das.DecodeCursor(dasquery, next)
+	var rest []mongo.DASRecord
+	for _, r := range sorted {
+		if mongo.GetValue(r, "file.name") != "f" {
+			rest = append(rest, r)
+		}
+	}
+	page, _ = das.CursorPage(rest, skeys, c, 2)
+	if len(page) != 2 || mongo.GetValue(page[0], "file.name") != "c" {
+		t.Errorf("Fail TestCursorPage, page after removed record %v\n", page)
+	}
+
+	// previous page precedes first record of the page
+	prev := das.PageCursors(dasquery, page, 3, 3).Prev
+	c, _ = das.DecodeCursor(dasquery, prev)
+	page, more = das.CursorPage(sorted, skeys, c, 3)
+	if len(page) != 3 || mongo.GetValue(page[0], "file.name") != "b" || more || !c.Back {
+		t.Errorf("Fail TestCursorPage, previous page %v\n", page)
+	}
+
+	// cursor of another query is rejected
+	other := dasql.DASQuery{Qhash: "fedcba9876543210fedcba9876543210", Filters: dasquery.Filters}
+	if _, err := das.DecodeCursor(other, next); err == nil {
+		t.Error("Fail TestCursorPage, cursor of another query is accepted")
+	}
+
+	// cursor of the same query with another sort is rejected
+	other = dasql.DASQuery{Qhash: pid, Filters: map[string][]string{"sort": {"file.size"}}}
+	if _, err := das.DecodeCursor(other, next); err == nil {
+		t.Error("Fail TestCursorPage, cursor of another sort is accepted")
+	}
+}
+
+// TestCursorSpec
+func TestCursorSpec(t *testing.T) {
+	skeys := das.ParseSortKeys([]string{"-file.size", "file.name"})
+	id := bson.NewObjectId()
+	c := &das.Cursor{Id: id.Hex(), Values: []interface{}{30, "b"}}
+	spec := das.CursorSpec(skeys, c)
+	conds, ok := spec["$or"].([]bson.M)
+	if !ok || len(conds) != 3 {
+		t.Fatalf("Fail TestCursorSpec, spec %v\n", spec)
+	}
+	if fmt.Sprintf("%v", conds[0]) != "map[file.size:map[$lt:30]]" {
+		t.Errorf("Fail TestCursorSpec, first condition %v\n", conds[0])
+	}
+	if fmt.Sprintf("%v", conds[1]) != "map[file.name:map[$gt:b] file.size:30]" {
+		t.Errorf("Fail TestCursorSpec, second condition %v\n", conds[1])
+	}
+	if conds[2]["_id"].(bson.M)["$gt"] != id || conds[2]["file.name"] != "b" {
+		t.Errorf("Fail TestCursorSpec, last condition %v\n", conds[2])
+	}
+
+	// previous page reverses comparisons
+	c.Back = true
+	conds = das.CursorSpec(skeys, c)["$or"].([]bson.M)
+	if fmt.Sprintf("%v", conds[0]) != "map[file.size:map[$gt:30]]" || conds[2]["_id"].(bson.M)["$lt"] != id {
+		t.Errorf("Fail TestCursorSpec, backward spec %v\n", conds)
+	}
+}
+
+// TestFilterCacheEntries
+func TestFilterCacheEntries(t *testing.T) {
+	entries := []das.CacheEntry{
+		{Qhash: "1", Query: "dataset dataset=/a/b/c", Instance: "prod/global", Services: []string{"dbs3:datasets"}},
+		{Qhash: "2", Query: "site dataset=/a/b/c", Instance: "prod/global", Services: []string{"dbs3:blocks", "rucio:replicas"}},
+		{Qhash: "3", Query: "dataset dataset=/x/y/z", Instance: "prod/phys03", Services: []string{"dbs3:datasets"}},
+	}
+	tests := []struct {
+		filter das.CacheFilter
+		pids   string
+	}{
+		{das.CacheFilter{Qhash: "2"}, "2"},
+		{das.CacheFilter{Pattern: "^dataset"}, "13"},
+		{das.CacheFilter{Service: "rucio"}, "2"},
+		{das.CacheFilter{Service: "dbs3:datasets"}, "13"},
+		{das.CacheFilter{Service: "dbs"}, ""},
+		{das.CacheFilter{Instance: "prod/global", Pattern: "dataset="}, "12"},
+		{das.CacheFilter{}, "123"},
+	}
+	for _, test := range tests {
+		res, err := das.FilterCacheEntries(entries, test.filter)
+		if err != nil {
+			t.Errorf("Fail TestFilterCacheEntries, filter %+v, error %v\n", test.filter, err)
+		}
+		var pids string
+		for _, e := range res {
+			pids += e.Qhash
+		}
+		if pids != test.pids {
+			t.Errorf("Fail TestFilterCacheEntries, filter %+v, got %s expect %s\n", test.filter, pids, test.pids)
+		}
+	}
+	if _, err := das.FilterCacheEntries(entries, das.CacheFilter{Pattern: "("}); err == nil {
+		t.Error("Fail TestFilterCacheEntries, invalid pattern is accepted")
+	}
+	if _, err := das.InvalidateCache(das.CacheFilter{}); err == nil {
+		t.Error("Fail TestFilterCacheEntries, empty filter is accepted by InvalidateCache")
+	}
+}
+
+// TestLRUQueries
+func TestLRUQueries(t *testing.T) {
+	var recs []mongo.DASRecord
+	for _, pid := range []string{"a", "b", "c", "d"} {
+		recs = append(recs, mongo.DASRecord{"qhash": pid})
+	}
+	active := map[string]bool{"b": true}
+	pids := das.LRUQueries(recs, active, 2)
+	if strings.Join(pids, ",") != "a,c" {
+		t.Errorf("Fail TestLRUQueries, got %v expect [a c]\n", pids)
+	}
+	pids = das.LRUQueries(recs, active, 10)
+	if strings.Join(pids, ",") != "a,c,d" {
+		t.Errorf("Fail TestLRUQueries, got %v expect [a c d]\n", pids)
+	}
+}
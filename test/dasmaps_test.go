@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dmwm/das2go/das"
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+)
+
+// synthetic DAS maps used by tests
+var testMaps = []string{
+	`{"hash": "1", "type": "service", "system": "dbs3", "urn": "datasets", "url": "https://cmsweb.cern.ch/dbs/prod/global/DBSReader/datasets", "expire": 3600, "lookup": "dataset", "params": {"dataset": "required", "status": "optional"}, "das_map": [{"das_key": "dataset", "rec_key": "dataset.name", "api_arg": "dataset", "pattern": "/.*"}, {"das_key": "status", "rec_key": "status.name", "api_arg": "status"}]}`,
+	`{"hash": "2", "type": "service", "system": "dbs3", "urn": "dataset_info", "url": "https://cmsweb.cern.ch/dbs/prod/global/DBSReader/datasets", "expire": 3600, "lookup": "dataset", "params": {"dataset": "required", "run_num": "required"}, "das_map": [{"das_key": "dataset", "rec_key": "dataset.name", "api_arg": "dataset", "pattern": "/.*"}, {"das_key": "run", "rec_key": "run.run_number", "api_arg": "run_num"}]}`,
+	`{"hash": "3", "type": "service", "system": "phedex", "urn": "dataset4site", "url": "https://cmsweb.cern.ch/phedex/datasvc/json/prod/blockReplicas", "expire": 3600, "lookup": "dataset", "params": {"dataset": "required"}, "das_map": [{"das_key": "dataset", "rec_key": "dataset.name", "api_arg": "dataset", "pattern": "/[a-z]+/.*"}]}`,
+}
+
+// helper function to load synthetic DAS maps
+func loadTestMaps(t *testing.T) dasmaps.DASMaps {
+	fname := filepath.Join(t.TempDir(), "dasmaps.js")
+	if err := os.WriteFile(fname, []byte(strings.Join(testMaps, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var dmaps dasmaps.DASMaps
+	dmaps.ReadMapFile(fname)
+	return dmaps
+}
+
+// TestExplainServices
+func TestExplainServices(t *testing.T) {
+	dmaps := loadTestMaps(t)
+	dasquery, err, _ := dasql.Parse("dataset dataset=/A/B/C", "prod/global", dmaps.DASKeys())
+	if err != "" {
+		t.Fatalf("Fail TestExplainServices, error %v\n", err)
+	}
+	decisions := dmaps.ExplainServices(dasquery)
+	if len(decisions) != 3 {
+		t.Fatalf("Fail TestExplainServices, decisions %+v\n", decisions)
+	}
+	for _, d := range decisions {
+		switch d.Urn {
+		case "datasets":
+			if !d.Selected {
+				t.Errorf("Fail TestExplainServices, map %s should be selected, reasons %v\n", d.Urn, d.Reasons)
+			}
+		case "dataset_info":
+			if d.Selected || !strings.HasPrefix(d.Reasons[0], "required args mismatch") {
+				t.Errorf("Fail TestExplainServices, map %s decision %+v\n", d.Urn, d)
+			}
+		case "dataset4site":
+			if d.Selected || !strings.HasPrefix(d.Reasons[0], "pattern mismatch") {
+				t.Errorf("Fail TestExplainServices, map %s decision %+v\n", d.Urn, d)
+			}
+		}
+	}
+	// explain and look-up of services should agree on selected maps
+	selected := dmaps.FindServices(dasquery)
+	var nselected int
+	for _, d := range decisions {
+		if d.Selected {
+			nselected += 1
+		}
+	}
+	if nselected != len(selected) {
+		t.Errorf("Fail TestExplainServices, selected %d maps, found services %d\n", nselected, len(selected))
+	}
+	explain := das.Explain(dasquery, dmaps)
+	if len(explain.Urls) != 1 || !strings.Contains(explain.Urls[0].Url, "dataset=%2FA%2FB%2FC") {
+		t.Errorf("Fail TestExplainServices, urls %+v\n", explain.Urls)
+	}
+	if len(explain.Pkeys) != 1 || explain.Pkeys[0] != "dataset.name" {
+		t.Errorf("Fail TestExplainServices, pkeys %v\n", explain.Pkeys)
+	}
+}
+
+// TestSuggest
+func TestSuggest(t *testing.T) {
+	dmaps := loadTestMaps(t)
+	dasquery, err, _ := dasql.Parse("dataset datset=/A/B/C", "prod/global", []string{"dataset", "file", "run", "status"})
+	if err == "" || !strings.Contains(err, "did you mean: dataset") {
+		t.Fatalf("Fail TestSuggest, error %v\n", err)
+	}
+	suggestions := dmaps.Suggest(dasquery)
+	if len(suggestions.Keys) == 0 || suggestions.Keys[0] != "dataset" {
+		t.Errorf("Fail TestSuggest, keys %v\n", suggestions.Keys)
+	}
+	expect := []string{"dataset dataset=<dataset>", "dataset dataset=<dataset> run=<run>"}
+	if len(suggestions.Conditions) != len(expect) {
+		t.Fatalf("Fail TestSuggest, conditions %v\n", suggestions.Conditions)
+	}
+	for i, cond := range expect {
+		if suggestions.Conditions[i] != cond {
+			t.Errorf("Fail TestSuggest, condition %v, expect %v\n", suggestions.Conditions[i], cond)
+		}
+	}
+}
+
+// TestTransform
+func TestTransform(t *testing.T) {
+	dmap := mongo.DASRecord{"das_key": "date", "api_arg": "cdate", "transform": map[string]interface{}{"range": []interface{}{"min_cdate", "max_cdate"}, "offset": 86400, "format": "unix"}}
+	transform, err := dasmaps.GetTransform(dmap)
+	if err != nil || transform == nil {
+		t.Fatalf("Fail TestTransform, error %v\n", err)
+	}
+	vals := transform.Apply("cdate", "20230101")
+	if vals.Get("min_cdate") != "1672531200" || vals.Get("max_cdate") != "1672617600" || vals.Has("cdate") {
+		t.Errorf("Fail TestTransform, range values %v\n", vals)
+	}
+	vals = transform.Apply("cdate", []string{"20230101", "20230105"})
+	if vals.Get("max_cdate") != "1672876800" {
+		t.Errorf("Fail TestTransform, range of list values %v\n", vals)
+	}
+	// range without offset keeps single value as is
+	dmap = mongo.DASRecord{"das_key": "date", "api_arg": "date", "transform": map[string]interface{}{"range": []interface{}{"date1", "date2"}, "format": "dashboard"}}
+	transform, err = dasmaps.GetTransform(dmap)
+	if err != nil {
+		t.Fatalf("Fail TestTransform, error %v\n", err)
+	}
+	vals = transform.Apply("date", "20230101")
+	if vals.Get("date") != "20230101" || vals.Has("date1") {
+		t.Errorf("Fail TestTransform, single value of range without offset %v\n", vals)
+	}
+	vals = transform.Apply("date", []string{"20230101", "20230105"})
+	if !vals.Has("date1") || !vals.Has("date2") || vals.Has("date") {
+		t.Errorf("Fail TestTransform, list values of range without offset %v\n", vals)
+	}
+	tests := []struct {
+		transform map[string]interface{}
+		val       interface{}
+		arg       string
+		expect    []string
+	}{
+		{map[string]interface{}{"wrap": "[%s]"}, "1,2", "lumi_list", []string{"[1,2]"}},
+		{map[string]interface{}{"arg": "validFileOnly", "values": map[string]interface{}{"valid": "1"}, "default": "0"}, "VALID*", "validFileOnly", []string{"1"}},
+		{map[string]interface{}{"arg": "validFileOnly", "values": map[string]interface{}{"valid": "1"}, "default": "0"}, "invalid", "validFileOnly", []string{"0"}},
+		{map[string]interface{}{"join": ","}, []string{"1", "2"}, "Runs", []string{"1,2"}},
+		{map[string]interface{}{"format": "upper"}, []string{"a", "b"}, "tier", []string{"A", "B"}},
+	}
+	for _, test := range tests {
+		transform, err := dasmaps.GetTransform(mongo.DASRecord{"transform": test.transform})
+		if err != nil {
+			t.Fatalf("Fail TestTransform, %v error %v\n", test.transform, err)
+		}
+		vals := transform.Apply(test.arg, test.val)
+		if strings.Join(vals[test.arg], " ") != strings.Join(test.expect, " ") {
+			t.Errorf("Fail TestTransform, %v of %v gives %v\n", test.transform, test.val, vals)
+		}
+	}
+	for _, bad := range []map[string]interface{}{{"format": "hex"}, {"wrap": "[]"}, {"range": []interface{}{"a"}}, {"offset": 10}, {"unknown": 1}} {
+		if _, err := dasmaps.GetTransform(mongo.DASRecord{"transform": bad}); err == nil {
+			t.Errorf("Fail TestTransform, invalid transform %v is accepted\n", bad)
+		}
+	}
+}
+
+// TestDiffKeys
+func TestDiffKeys(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "dasmaps.js")
+	pmap := `{"hash": "4", "type": "presentation", "presentation": {"block": [{"das": "block.name", "ui": "Block name", "diff": ["block.size", "block.nfiles"]}, {"das": "block.size", "ui": "Block size"}]}}`
+	if err := os.WriteFile(fname, []byte(pmap), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var dmaps dasmaps.DASMaps
+	dmaps.ReadMapFile(fname)
+	keys := dmaps.DiffKeys("block.name")
+	if len(keys) != 2 || keys[0] != "block.size" || keys[1] != "block.nfiles" {
+		t.Errorf("Fail TestDiffKeys, keys %v\n", keys)
+	}
+	if keys := dmaps.DiffKeys("file.name"); len(keys) != 0 {
+		t.Errorf("Fail TestDiffKeys, file keys %v\n", keys)
+	}
+}
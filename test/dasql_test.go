@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dmwm/das2go/config"
+	"github.com/dmwm/das2go/dasql"
+)
+
+// TestParsePipeAggregators
+func TestParsePipeAggregators(t *testing.T) {
+	daskeys := []string{"file", "dataset"}
+	query := "file dataset=/a/b/c | mean(file.size), histogram(file.size, 20)"
+	dasquery, err, _ := dasql.Parse(query, "prod/global", daskeys)
+	if err != "" {
+		t.Fatalf("Fail TestParsePipeAggregators, error %v\n", err)
+	}
+	aggrs := dasquery.Aggregators
+	if len(aggrs) != 2 {
+		t.Fatalf("Fail TestParsePipeAggregators, aggregators %v\n", aggrs)
+	}
+	if aggrs[0][0] != "mean" || aggrs[0][1] != "file.size" {
+		t.Errorf("Fail TestParsePipeAggregators, mean aggregator %v\n", aggrs[0])
+	}
+	if len(aggrs[1]) != 3 || aggrs[1][0] != "histogram" || aggrs[1][2] != "20" {
+		t.Errorf("Fail TestParsePipeAggregators, histogram aggregator %v\n", aggrs[1])
+	}
+}
+
+// TestParsePipeSort
+func TestParsePipeSort(t *testing.T) {
+	daskeys := []string{"file", "dataset"}
+	query := "file dataset=/a/b/c | sort -file.size, file.name"
+	dasquery, err, _ := dasql.Parse(query, "prod/global", daskeys)
+	if err != "" {
+		t.Fatalf("Fail TestParsePipeSort, error %v\n", err)
+	}
+	skeys := dasquery.Filters["sort"]
+	if len(skeys) != 2 || skeys[0] != "-file.size" || skeys[1] != "file.name" {
+		t.Errorf("Fail TestParsePipeSort, sort keys %v\n", skeys)
+	}
+}
+
+// TestParsePipeGrep
+func TestParsePipeGrep(t *testing.T) {
+	daskeys := []string{"file", "dataset"}
+	query := "file dataset=/a/b/c | grep file.name, file.size > 2GB, file.size<=3.5GB, file.name ~ RAW, file.nevents in [1, 2]"
+	dasquery, err, _ := dasql.Parse(query, "prod/global", daskeys)
+	if err != "" {
+		t.Fatalf("Fail TestParsePipeGrep, error %v\n", err)
+	}
+	expect := []string{"file.name", "file.size>2GB", "file.size<=3.5GB", "file.name~RAW", "file.nevents in [1,2]"}
+	grep := dasquery.Filters["grep"]
+	if len(grep) != len(expect) {
+		t.Fatalf("Fail TestParsePipeGrep, grep filters %v\n", grep)
+	}
+	for i, val := range expect {
+		if grep[i] != val {
+			t.Errorf("Fail TestParsePipeGrep, filter %v, expect %v\n", grep[i], val)
+		}
+	}
+}
+
+// TestParseInstances
+func TestParseInstances(t *testing.T) {
+	daskeys := []string{"dataset"}
+	cfg := *config.Current()
+	defer config.Publish(cfg)
+	newcfg := cfg
+	newcfg.DbsInstances = []string{"prod/global", "prod/phys03", "int/global"}
+	config.Publish(newcfg)
+
+	query := "dataset=/a/b/c instance=*"
+	dasquery, err, _ := dasql.Parse(query, "prod/global", daskeys)
+	if err != "" {
+		t.Fatalf("Fail TestParseInstances, error %v\n", err)
+	}
+	if len(dasquery.Instances) != 3 || dasquery.Instance != "prod/global" {
+		t.Errorf("Fail TestParseInstances, instance=* gives %v, %v\n", dasquery.Instance, dasquery.Instances)
+	}
+	if _, ok := dasquery.Spec["instance"]; ok {
+		t.Errorf("Fail TestParseInstances, instance left in spec %v\n", dasquery.Spec)
+	}
+
+	query = "dataset=/a/b/c instance in [prod/phys03, int/global]"
+	dasquery, err, _ = dasql.Parse(query, "prod/global", daskeys)
+	if err != "" {
+		t.Fatalf("Fail TestParseInstances, error %v\n", err)
+	}
+	if len(dasquery.Instances) != 2 || dasquery.Instance != "prod/phys03" || dasquery.Instances[1] != "int/global" {
+		t.Errorf("Fail TestParseInstances, instance in [..] gives %v, %v\n", dasquery.Instance, dasquery.Instances)
+	}
+	single, _, _ := dasql.Parse("dataset=/a/b/c instance=prod/phys03", "prod/global", daskeys)
+	if single.Qhash == dasquery.Qhash {
+		t.Errorf("Fail TestParseInstances, fan-out query has same hash as single instance one\n")
+	}
+
+	query = "dataset=/a/b/c instance in [prod/phys03, prod/unknown]"
+	_, err, _ = dasql.Parse(query, "prod/global", daskeys)
+	if err == "" {
+		t.Errorf("Fail TestParseInstances, unknown instance is accepted\n")
+	}
+}
+
+// TestParseArraySize
+func TestParseArraySize(t *testing.T) {
+	cfg := *config.Current()
+	defer config.Publish(cfg)
+	newcfg := cfg
+	newcfg.MaxArraySize = 3
+	config.Publish(newcfg)
+	daskeys := []string{"run", "file"}
+	if _, qlerr, _ := dasql.Parse("file run in [1,2,3]", "", daskeys); qlerr != "" {
+		t.Errorf("Fail TestParseArraySize, unexpected error %s\n", qlerr)
+	}
+	if _, qlerr, _ := dasql.Parse("file run in [1,2,3,4]", "", daskeys); qlerr == "" {
+		t.Error("Fail TestParseArraySize, expect error for too long array")
+	}
+	if _, qlerr, _ := dasql.Parse("file run between [1,100]", "", daskeys); qlerr == "" {
+		t.Error("Fail TestParseArraySize, expect error for too long range")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dmwm/das2go/services"
+)
+
+// helper function to create relatives function from given relations
+func relativesOf(relations map[string][]string) services.RelativesFunc {
+	return func(names []string) map[string][]string {
+		out := make(map[string][]string)
+		for _, name := range names {
+			out[name] = relations[name]
+		}
+		return out
+	}
+}
+
+// TestBuildLineage
+func TestBuildLineage(t *testing.T) {
+	// RAW -> RECO -> AOD -> MINIAOD -> NANOAOD, and cycle NANOAOD -> AOD
+	parents := relativesOf(map[string][]string{
+		"MINIAOD": {"AOD"},
+		"AOD":     {"RECO", "NANOAOD"},
+		"RECO":    {"RAW"},
+	})
+	children := relativesOf(map[string][]string{
+		"MINIAOD": {"NANOAOD"},
+		"NANOAOD": {"AOD"},
+	})
+	graph := services.BuildLineage("dataset", "MINIAOD", 5, parents, children)
+	levels := make(map[string]int)
+	for _, node := range graph.Nodes {
+		levels[node.Name] = node.Level
+	}
+	expect := map[string]int{"RAW": -3, "RECO": -2, "AOD": -1, "MINIAOD": 0, "NANOAOD": -2}
+	for name, level := range expect {
+		if l, ok := levels[name]; !ok || l != level {
+			t.Errorf("Fail TestBuildLineage, node %s level %v, expect %v\n", name, levels[name], level)
+		}
+	}
+	if len(graph.Nodes) != len(expect) {
+		t.Errorf("Fail TestBuildLineage, nodes %+v\n", graph.Nodes)
+	}
+	graph = services.BuildLineage("dataset", "MINIAOD", 1, parents, children)
+	if len(graph.Nodes) != 3 {
+		t.Errorf("Fail TestBuildLineage, depth 1 nodes %+v\n", graph.Nodes)
+	}
+	records := graph.Records()
+	if records[0]["name"] != "AOD" || records[0]["level"] != -1 {
+		t.Errorf("Fail TestBuildLineage, records %v\n", records)
+	}
+	dot := graph.Dot()
+	if !strings.Contains(dot, `"AOD" -> "MINIAOD";`) || !strings.Contains(dot, `"MINIAOD" -> "NANOAOD";`) {
+		t.Errorf("Fail TestBuildLineage, dot %s\n", dot)
+	}
+	ancestors, descendants := graph.Trees()
+	if len(ancestors.Children) != 1 || ancestors.Children[0].Name != "AOD" || len(descendants.Children) != 1 {
+		t.Errorf("Fail TestBuildLineage, trees %+v %+v\n", ancestors, descendants)
+	}
+}
+
+// TestLineageDescendants
+func TestLineageDescendants(t *testing.T) {
+	// bad RAW file and files derived from it in RECO and AOD
+	children := relativesOf(map[string][]string{
+		"raw.root":  {"reco.root"},
+		"reco.root": {"aod1.root", "aod2.root"},
+		"aod1.root": {"mini.root"},
+	})
+	graph := services.BuildLineage("file", "raw.root", 5, nil, children)
+	if len(graph.Nodes) != 5 {
+		t.Fatalf("Fail TestLineageDescendants, nodes %+v\n", graph.Nodes)
+	}
+	// files of AOD dataset, raw.root is not its descendant
+	aod := map[string]bool{"aod1.root": true, "aod2.root": true, "aod3.root": true, "raw.root": true}
+	nodes := graph.Descendants(aod)
+	if len(nodes) != 2 || nodes[0].Name != "aod1.root" || nodes[1].Name != "aod2.root" || nodes[0].Level != 2 {
+		t.Errorf("Fail TestLineageDescendants, descendants %+v\n", nodes)
+	}
+	graph = services.BuildLineage("file", "raw.root", 1, nil, children)
+	if nodes := graph.Descendants(aod); len(nodes) != 0 {
+		t.Errorf("Fail TestLineageDescendants, depth 1 descendants %+v\n", nodes)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/services"
+)
+
+// TestLocalAPIRegistry
+func TestLocalAPIRegistry(t *testing.T) {
+	apis := services.LocalAPIList()
+	if len(apis) == 0 {
+		t.Fatal("Fail TestLocalAPIRegistry, no local APIs are registered")
+	}
+	for _, api := range apis {
+		if api.Function == "" || api.Call == nil {
+			t.Errorf("Fail TestLocalAPIRegistry, local API %s has no function\n", api.Name())
+		}
+	}
+	api, ok := services.GetLocalAPI("dbs3", "dataset4block")
+	if !ok || api.Function != "Dataset4Block" {
+		t.Fatalf("Fail TestLocalAPIRegistry, dbs3 dataset4block api %+v\n", api)
+	}
+	if services.LocalAPIMap()["dbs3_dataset4block"] != "Dataset4Block" {
+		t.Errorf("Fail TestLocalAPIRegistry, local API map %v\n", services.LocalAPIMap())
+	}
+}
+
+// TestValidateLocalAPIs
+func TestValidateLocalAPIs(t *testing.T) {
+	maps := []string{
+		`{"hash": "1", "type": "service", "system": "reqmgr2", "urn": "configs", "url": "local_api", "expire": 900, "lookup": "config", "params": {"dataset": "required"}, "das_map": [{"das_key": "config", "rec_key": "config.name"}, {"das_key": "dataset", "rec_key": "dataset.name", "api_arg": "dataset"}]}`,
+		`{"hash": "2", "type": "service", "system": "reqmgr2", "urn": "unknown", "url": "local_api", "expire": 900, "lookup": "config", "params": {}, "das_map": [{"das_key": "config", "rec_key": "config.name"}]}`,
+	}
+	fname := filepath.Join(t.TempDir(), "dasmaps.js")
+	if err := os.WriteFile(fname, []byte(strings.Join(maps, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var dmaps dasmaps.DASMaps
+	dmaps.ReadMapFile(fname)
+	msgs := services.ValidateLocalAPIs(dmaps)
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "reqmgr2:unknown") {
+		t.Errorf("Fail TestValidateLocalAPIs, messages %v\n", msgs)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/services"
+)
+
+// helper function to lint DAS maps and examples from given areas
+func lintMaps(t *testing.T, mapsDir, examplesDir string) []dasmaps.LintIssue {
+	issues := dasmaps.LintMaps(mapsDir, examplesDir, services.LocalAPIMap(), services.DASLocalAPIs())
+	for _, issue := range issues {
+		t.Log(issue)
+	}
+	return issues
+}
+
+// TestMapsLint
+func TestMapsLint(t *testing.T) {
+	issues := lintMaps(t, "data/maps", "data/examples")
+	expect := []string{
+		"data/maps/test.yml:18: lookup key file of test:files is missing in presentation map",
+		"data/maps/test.yml:21: das_map entry without das_key",
+		"data/maps/test.yml:22: invalid pattern /[a-z",
+		"data/maps/test.yml:26: local api test_blocks has no entry in LocalAPIMap",
+		"data/maps/test.yml:32: unknown transform format hex",
+		"data/maps/test.yml:37: warning: notation api filelist does not match any test API",
+		"data/examples/test_queries.txt:4:",
+	}
+	for _, msg := range expect {
+		found := false
+		for _, issue := range issues {
+			if strings.HasPrefix(issue.String(), msg) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Fail TestMapsLint, issue \"%s\" is not reported\n", msg)
+		}
+	}
+	if len(issues) != len(expect) {
+		t.Errorf("Fail TestMapsLint, expect %d issues, found %d\n", len(expect), len(issues))
+	}
+}
+
+// TestMapsRead
+func TestMapsRead(t *testing.T) {
+	var dmaps dasmaps.DASMaps
+	if issues := dmaps.ReadYamlFile("../maps/dbs3.yml"); len(issues) != 0 {
+		t.Errorf("Fail TestMapsRead, issues %v\n", issues)
+	}
+	var nsrv int
+	for _, rec := range dmaps.Maps() {
+		switch rec["type"] {
+		case "service":
+			nsrv += 1
+			if rec["system"] != "dbs3" || rec["format"] != "JSON" {
+				t.Errorf("Fail TestMapsRead, %s system %v format %v\n", rec["urn"], rec["system"], rec["format"])
+			}
+			if _, ok := rec["das_map"].([]interface{}); !ok {
+				t.Errorf("Fail TestMapsRead, %s das_map %v\n", rec["urn"], rec["das_map"])
+			}
+		case "notation":
+			if rec["system"] != "dbs3" {
+				t.Errorf("Fail TestMapsRead, notation system %v\n", rec["system"])
+			}
+		}
+	}
+	if nsrv == 0 || len(dmaps.FindNotations("dbs3")) == 0 || dmaps.FindApiRecord("dbs3", "datasets") == nil {
+		t.Fatalf("Fail TestMapsRead, services %d, notations %d\n", nsrv, len(dmaps.FindNotations("dbs3")))
+	}
+
+	// shipped maps and examples are consistent
+	for _, issue := range lintMaps(t, "../maps", "../examples") {
+		if !issue.Warning {
+			t.Errorf("Fail TestMapsRead, %s\n", issue)
+		}
+	}
+}
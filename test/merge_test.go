@@ -0,0 +1,162 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// helper function to create DAS data record provided by given service
+func serviceRecord(srv string, expire int64, rec mongo.DASRecord) mongo.DASRecord {
+	rec["qhash"] = "123"
+	rec["das"] = mongo.DASRecord{"services": []string{srv}, "expire": expire, "primary_key": "file.name", "record": 1}
+	return rec
+}
+
+// TestMergeKeys
+func TestMergeKeys(t *testing.T) {
+	pkeys := []string{"file.name", "run.run_number", "file.name", "lumi.number"}
+	keys := services.MergeKeys([]string{"file", "run", "lumi"}, pkeys)
+	if len(keys) != 3 || keys[0] != "file.name" || keys[1] != "run.run_number" || keys[2] != "lumi.number" {
+		t.Errorf("Fail TestMergeKeys, keys %v\n", keys)
+	}
+	if keys := services.MergeKeys([]string{"config"}, pkeys); len(keys) != 0 {
+		t.Errorf("Fail TestMergeKeys, keys %v\n", keys)
+	}
+}
+
+// TestMergeRecords
+func TestMergeRecords(t *testing.T) {
+	pkeys := []string{"file.name"}
+	records := []mongo.DASRecord{
+		serviceRecord("dbs3:files", 30, mongo.DASRecord{"file": []mongo.DASRecord{{"name": "a", "size": 1}}}),
+		serviceRecord("dbs3:files", 10, mongo.DASRecord{"file": []mongo.DASRecord{{"name": "b", "size": 2}}}),
+		serviceRecord("rucio:files", 20, mongo.DASRecord{"file": []mongo.DASRecord{{"name": "a", "size": 1}}}),
+		serviceRecord("rucio:files", 20, mongo.DASRecord{"file": []mongo.DASRecord{{"name": "b", "size": 3}}}),
+		serviceRecord("rucio:files", 20, mongo.DASRecord{"file": []mongo.DASRecord{{"name": "c", "size": 4}}}),
+	}
+	out, expire := services.MergeRecords(records, []string{"file"}, pkeys, []string{"file.size"}, "123")
+	if len(out) != 3 || expire != 10 {
+		t.Fatalf("Fail TestMergeRecords, records %v, expire %d\n", out, expire)
+	}
+	// identical records of different services are merged once
+	das := out[0]["das"].(mongo.DASRecord)
+	if subs := out[0]["file"].([]mongo.DASRecord); len(subs) != 1 || das["duplicates"].([]string)[0] != "rucio:files" {
+		t.Errorf("Fail TestMergeRecords, duplicate record %v\n", out[0])
+	}
+	// different records of the same file are merged and compared
+	das = out[1]["das"].(mongo.DASRecord)
+	if subs := out[1]["file"].([]mongo.DASRecord); len(subs) != 2 || das["conflicts"] == nil {
+		t.Errorf("Fail TestMergeRecords, merged record %v\n", out[1])
+	}
+	if srvs := das["services"].([]string); len(srvs) != 2 || srvs[1] != "rucio:files" {
+		t.Errorf("Fail TestMergeRecords, merged services %v\n", srvs)
+	}
+	// last record is not lost
+	if mongo.GetValue(out[2], "file.name") != "c" {
+		t.Errorf("Fail TestMergeRecords, last record %v\n", out[2])
+	}
+}
+
+// TestMergeMultiKeyRecords
+func TestMergeMultiKeyRecords(t *testing.T) {
+	pkeys := []string{"file.name", "run.run_number", "lumi.number"}
+	fields := []string{"file", "run", "lumi"}
+	record := func(srv, file string, run int, lumis []int) mongo.DASRecord {
+		return serviceRecord(srv, 10, mongo.DASRecord{
+			"file": []mongo.DASRecord{{"name": file}},
+			"run":  []mongo.DASRecord{{"run_number": run}},
+			"lumi": []mongo.DASRecord{{"number": lumis}},
+		})
+	}
+	records := []mongo.DASRecord{
+		record("dbs3:file_run_lumi4dataset", "a", 1, []int{1, 2}),
+		record("dbs3:file_run_lumi4dataset", "a", 2, []int{1}),
+		record("dbs3:file_run_lumi4block", "a", 1, []int{1, 2}),
+		record("dbs3:file_run_lumi4block", "b", 1, []int{1, 2}),
+	}
+	out, _ := services.MergeRecords(records, fields, pkeys, nil, "123")
+	if len(out) != 3 {
+		t.Fatalf("Fail TestMergeMultiKeyRecords, records %v\n", out)
+	}
+	if mongo.GetValue(out[1], "run.run_number") != 2 || mongo.GetValue(out[2], "file.name") != "b" {
+		t.Errorf("Fail TestMergeMultiKeyRecords, records %v\n", out)
+	}
+	das := out[0]["das"].(mongo.DASRecord)
+	if srvs := das["duplicates"].([]string); len(srvs) != 1 || srvs[0] != "dbs3:file_run_lumi4block" {
+		t.Errorf("Fail TestMergeMultiKeyRecords, duplicates %v\n", das)
+	}
+}
+
+// TestMergeRecordsWithoutPrimaryKey
+func TestMergeRecordsWithoutPrimaryKey(t *testing.T) {
+	records := []mongo.DASRecord{
+		serviceRecord("dbs3:files", 10, mongo.DASRecord{"file": []mongo.DASRecord{{"error": "timeout", "type": "DBS"}}}),
+		serviceRecord("rucio:files", 10, mongo.DASRecord{"file": []mongo.DASRecord{{"error": "timeout", "type": "Rucio"}}}),
+		serviceRecord("rucio:files", 10, mongo.DASRecord{"file": []mongo.DASRecord{{"name": "a"}}}),
+		serviceRecord("dbs3:files", 10, mongo.DASRecord{"file": []mongo.DASRecord{{"error": "timeout", "type": "DBS"}}}),
+	}
+	// records without primary key value are only merged with identical ones
+	out, _ := services.MergeRecords(records, []string{"file"}, []string{"file.name"}, nil, "123")
+	if len(out) != 3 {
+		t.Errorf("Fail TestMergeRecordsWithoutPrimaryKey, records %v\n", out)
+	}
+	// without primary keys records are merged by their content
+	out, _ = services.MergeRecords(records, []string{"file"}, nil, nil, "123")
+	if len(out) != 3 {
+		t.Errorf("Fail TestMergeRecordsWithoutPrimaryKey, records without keys %v\n", out)
+	}
+}
+
+// TestMergeProvenance
+func TestMergeProvenance(t *testing.T) {
+	record := func(srv, url string, rec mongo.DASRecord) mongo.DASRecord {
+		rec = serviceRecord(srv, 10, rec)
+		das := rec["das"].(mongo.DASRecord)
+		das["url"] = url
+		das["ts"] = int64(100)
+		return rec
+	}
+	records := []mongo.DASRecord{
+		record("dbs3:datasets", "https://dbs/datasets", mongo.DASRecord{"dataset": []mongo.DASRecord{{"name": "/a/b/c", "nevents": 10}}}),
+		record("mcm:dataset", "https://mcm/dataset", mongo.DASRecord{"dataset": []mongo.DASRecord{{"name": "/a/b/c", "prepid": "x"}}}),
+		record("rucio:datasets", "https://rucio/datasets", mongo.DASRecord{"dataset": []mongo.DASRecord{{"name": "/a/b/c", "nevents": 10}}}),
+	}
+	out, _ := services.MergeRecords(records, []string{"dataset"}, []string{"dataset.name"}, nil, "123")
+	if len(out) != 1 {
+		t.Fatalf("Fail TestMergeProvenance, records %v\n", out)
+	}
+	// provenance should survive storage of merged record in DAS cache
+	data, err := bson.Marshal(out[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec mongo.DASRecord
+	if err := bson.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	das := rec["das"].(mongo.DASRecord)
+	sources := services.Provenance(das)
+	if len(sources) != 3 {
+		t.Fatalf("Fail TestMergeProvenance, sources %+v\n", sources)
+	}
+	src := sources[1]
+	if src.Service != "mcm:dataset" || src.Api != "dataset" || src.Url != "https://mcm/dataset" || src.Ts != 100 || src.Index != 1 {
+		t.Errorf("Fail TestMergeProvenance, source %+v\n", src)
+	}
+	if src := sources[2]; !src.Duplicate || src.Index != 0 || src.System != "rucio" {
+		t.Errorf("Fail TestMergeProvenance, duplicate source %+v\n", src)
+	}
+	fields := services.FieldSources(das)
+	if srvs := fields["dataset.nevents"]; len(srvs) != 2 || srvs[0] != "dbs3:datasets" || srvs[1] != "rucio:datasets" {
+		t.Errorf("Fail TestMergeProvenance, nevents sources %v\n", srvs)
+	}
+	if srvs := fields["dataset.prepid"]; len(srvs) != 1 || srvs[0] != "mcm:dataset" {
+		t.Errorf("Fail TestMergeProvenance, prepid sources %v\n", srvs)
+	}
+	if srvs := fields["dataset.name"]; len(srvs) != 3 {
+		t.Errorf("Fail TestMergeProvenance, name sources %v\n", srvs)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	_ "github.com/dmwm/das2go/das"
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// helper function to create DAS map record from given attributes
+func serviceMap(system, urn, url, arg string) mongo.DASRecord {
+	dmap := mongo.DASRecord{"das_key": arg, "rec_key": arg + ".name", "api_arg": arg}
+	return mongo.DASRecord{"system": system, "urn": urn, "url": url, "das_map": []interface{}{dmap}}
+}
+
+// TestServiceRegistry
+func TestServiceRegistry(t *testing.T) {
+	systems := []string{"conddb", "cric", "dashboard", "dbs3", "mcm", "reqmgr2", "rucio", "runregistry"}
+	for _, system := range systems {
+		srv, ok := services.GetService(system)
+		if !ok || srv.System() != system {
+			t.Errorf("Fail TestServiceRegistry, service %s is not registered\n", system)
+		}
+	}
+	if srv, ok := services.GetService("dbs"); !ok || srv.System() != "dbs3" {
+		t.Errorf("Fail TestServiceRegistry, dbs alias %v\n", srv)
+	}
+	rurl := "https://cmsweb.cern.ch/dbs/prod/global/DBSReader/datasets"
+	if system := utils.SystemName(rurl); system != "dbs3" {
+		t.Errorf("Fail TestServiceRegistry, system of %s is %s\n", rurl, system)
+	}
+	if system := utils.SystemName("https://cms-rucio.cern.ch/dids"); system != "rucio" {
+		t.Errorf("Fail TestServiceRegistry, rucio url system %s\n", system)
+	}
+	if system := utils.SystemName("https://example.com"); system != "combined" {
+		t.Errorf("Fail TestServiceRegistry, unknown url system %s\n", system)
+	}
+	srv, _ := services.GetService("dbs3")
+	req, _ := http.NewRequest("GET", rurl, nil)
+	srv.Authenticate(req)
+	if req.Header.Get("Accept-Encoding") != "gzip" {
+		t.Errorf("Fail TestServiceRegistry, DBS request headers %v\n", req.Header)
+	}
+	erec := srv.Error(http.ErrHandlerTimeout)
+	if erec["code"] != utils.DBSError || erec["type"] != utils.DBSErrorName {
+		t.Errorf("Fail TestServiceRegistry, DBS error record %v\n", erec)
+	}
+}
+
+// TestServiceRequest
+func TestServiceRequest(t *testing.T) {
+	// DBS request uses instance from DAS query
+	dasquery := dasql.DASQuery{Query: "block dataset=/a/b/c", Fields: []string{"block"}, Spec: map[string]interface{}{"dataset": "/a/b/c"}, Instance: "prod/phys03"}
+	dmap := serviceMap("dbs3", "blocks", "https://cmsweb.cern.ch/dbs/prod/global/DBSReader/blocks", "dataset")
+	furl, args := services.Request(dasquery, dmap)
+	if furl != "https://cmsweb.cern.ch/dbs/prod/phys03/DBSReader/blocks?dataset=%2Fa%2Fb%2Fc" || args != "" {
+		t.Errorf("Fail TestServiceRequest, DBS url %s args %s\n", furl, args)
+	}
+	// Rucio REST URL rewrites
+	dasquery = dasql.DASQuery{Query: "rules dataset=/a/b/c", Fields: []string{"rules"}, Spec: map[string]interface{}{"dataset": "/a/b/c"}}
+	dmap = serviceMap("rucio", "rules4dataset", "http://cms-rucio.cern.ch/dids/cms/", "dataset")
+	if furl, _ = services.Request(dasquery, dmap); furl != "http://cms-rucio.cern.ch/dids/cms/a/b/c/rules" {
+		t.Errorf("Fail TestServiceRequest, Rucio url %s\n", furl)
+	}
+	// CondDB does not use empty Runs parameter
+	dasquery = dasql.DASQuery{Query: "run date=20230101", Fields: []string{"run"}, Spec: map[string]interface{}{"date": "20230101"}}
+	dmap = serviceMap("conddb", "get_run_info", "https://cms-conddb.cern.ch/getLumi/", "date")
+	dmap["das_map"].([]interface{})[0].(mongo.DASRecord)["transform"] = map[string]interface{}{"range": []interface{}{"startTime", "endTime"}, "offset": 135420, "format": "conddb"}
+	dmap["params"] = map[string]interface{}{"Runs": ""}
+	if furl, _ = services.Request(dasquery, dmap); strings.Contains(furl, "Runs=") || !strings.Contains(furl, "startTime=") {
+		t.Errorf("Fail TestServiceRequest, CondDB url %s\n", furl)
+	}
+	// RunRegistry uses POST filter
+	dasquery = dasql.DASQuery{Query: "run run=1", Fields: []string{"run"}, Spec: map[string]interface{}{"run": "1"}}
+	dmap = serviceMap("runregistry", "rr_xmlrpc", "http://runregistry.web.cern.ch/runregistry/", "run")
+	furl, args = services.Request(dasquery, dmap)
+	if !strings.HasPrefix(furl, "http://runregistry.web.cern.ch/runregistry/api/GLOBAL/runsummary/json/") {
+		t.Errorf("Fail TestServiceRequest, RunRegistry url %s\n", furl)
+	}
+	if args != "{\"filter\": {\"number\": \">= 1 and <= 1\"}}" {
+		t.Errorf("Fail TestServiceRequest, RunRegistry args %s\n", args)
+	}
+	// CRIC is served by local APIs
+	dmap = serviceMap("cric", "site_names", "https://cms-cric.cern.ch/api/cms/site/query", "site")
+	if furl, _ = services.Request(dasquery, dmap); furl != "local_api" {
+		t.Errorf("Fail TestServiceRequest, CRIC url %s\n", furl)
+	}
+}
+
+// TestPostRequest
+func TestPostRequest(t *testing.T) {
+	var files []string
+	for i := 0; i < 5; i++ {
+		files = append(files, fmt.Sprintf("/store/file%d.root", i))
+	}
+	dmap := serviceMap("dbs3", "files", "https://cmsweb.cern.ch/dbs/prod/global/DBSReader/files", "file")
+	dmap["das_map"].([]interface{})[0].(mongo.DASRecord)["api_arg"] = "logical_file_name"
+	dmap["post"] = map[string]interface{}{"url": "https://cmsweb.cern.ch/dbs/prod/global/DBSReader/fileArray", "arg": "logical_file_name", "chunk": 2, "threshold": 2}
+	// short list of values uses GET request
+	dasquery := dasql.DASQuery{Query: "file file in [...]", Fields: []string{"file"}, Spec: map[string]interface{}{"file": files[:2]}, Instance: "prod/phys03"}
+	furl, args := services.Request(dasquery, dmap)
+	if !strings.HasPrefix(furl, "https://cmsweb.cern.ch/dbs/prod/phys03/DBSReader/files?") || args != "" {
+		t.Errorf("Fail TestPostRequest, GET url %s args %s\n", furl, args)
+	}
+	// long list of values uses POST request to instance specific POST url
+	dasquery.Spec = map[string]interface{}{"file": files}
+	furl, args = services.Request(dasquery, dmap)
+	if furl != "https://cmsweb.cern.ch/dbs/prod/phys03/DBSReader/fileArray" {
+		t.Errorf("Fail TestPostRequest, POST url %s\n", furl)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &body); err != nil {
+		t.Fatal(err)
+	}
+	if vals, ok := body["logical_file_name"].([]interface{}); !ok || len(vals) != len(files) {
+		t.Errorf("Fail TestPostRequest, POST args %s\n", args)
+	}
+	post := services.FindPost(dasquery, []mongo.DASRecord{dmap}, furl)
+	if post == nil || post.Chunk != 2 {
+		t.Fatalf("Fail TestPostRequest, POST declaration %+v\n", post)
+	}
+
+	// POST request is sent in chunks and responses are merged
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var body map[string][]string
+		json.NewDecoder(r.Body).Decode(&body)
+		var records []map[string]string
+		for _, lfn := range body["logical_file_name"] {
+			records = append(records, map[string]string{"logical_file_name": lfn})
+		}
+		json.NewEncoder(w).Encode(records)
+	}))
+	defer server.Close()
+	out := make(chan utils.ResponseType)
+	go services.FetchChunks(server.Client(), server.URL, args, post, out)
+	r := <-out
+	var records []map[string]string
+	if err := json.Unmarshal(r.Data, &records); err != nil || r.Error != nil {
+		t.Fatalf("Fail TestPostRequest, response %s, error %v\n", string(r.Data), r.Error)
+	}
+	if len(records) != len(files) || calls != 3 || r.Url != server.URL {
+		t.Errorf("Fail TestPostRequest, %d records in %d calls, url %s\n", len(records), calls, r.Url)
+	}
+
+	// DAS map POST declarations are validated
+	if _, err := dasmaps.GetPost(mongo.DASRecord{"post": map[string]interface{}{"url": "fileArray"}}); err == nil {
+		t.Error("Fail TestPostRequest, expect error for invalid POST declaration")
+	}
+}
+
+// TestServiceUnmarshal
+func TestServiceUnmarshal(t *testing.T) {
+	dasquery := dasql.DASQuery{Query: "dataset dataset=/a/b/c", Fields: []string{"dataset"}}
+	r := utils.ResponseType{Data: []byte(`[{"dataset": "/a/b/c"}]`)}
+	records := services.Unmarshal(dasquery, "dbs3", "datasets", r, nil, []string{"dataset.name"})
+	if len(records) != 1 || records[0]["name"] != "/a/b/c" {
+		t.Errorf("Fail TestServiceUnmarshal, records %v\n", records)
+	}
+	r = utils.ResponseType{Error: http.ErrHandlerTimeout}
+	records = services.Unmarshal(dasquery, "rucio", "datasets", r, nil, []string{"dataset.name"})
+	if len(records) != 1 || records[0]["code"] != utils.RucioError {
+		t.Errorf("Fail TestServiceUnmarshal, error records %v\n", records)
+	}
+}
+
+// helper function to create DAS record of blocks provided by given service
+func blockRecord(srv string, blocks ...mongo.DASRecord) mongo.DASRecord {
+	return mongo.DASRecord{"block": blocks, "das": mongo.DASRecord{"services": []string{srv}}}
+}
+
+// TestDiffRecord
+func TestDiffRecord(t *testing.T) {
+	records := []mongo.DASRecord{
+		blockRecord("dbs3:blocks", mongo.DASRecord{"name": "/a/b/c#1", "size": float64(10), "nfiles": float64(2)}),
+		blockRecord("rucio:block4dataset", mongo.DASRecord{"name": "/a/b/c#1", "size": int64(12), "nfiles": int64(2)}),
+	}
+	conflicts := services.DiffRecord(records, "block", []string{"block.size", "block.nfiles", "block.nevents"})
+	if len(conflicts) != 1 || conflicts[0]["key"] != "block.size" {
+		t.Fatalf("Fail TestDiffRecord, conflicts %v\n", conflicts)
+	}
+	values := conflicts[0]["values"].([]mongo.DASRecord)
+	if len(values) != 2 || values[1]["service"] != "rucio:block4dataset" {
+		t.Errorf("Fail TestDiffRecord, values %v\n", values)
+	}
+	// services which provide no or several sub-records keep their values
+	records = []mongo.DASRecord{
+		blockRecord("dbs3:blocks"),
+		blockRecord("rucio:block4dataset", mongo.DASRecord{"name": "/a/b/c#1", "size": int64(12)}, mongo.DASRecord{"name": "/a/b/c#1", "size": int64(12)}),
+		blockRecord("phedex:blockReplicas", mongo.DASRecord{"name": "/a/b/c#1", "size": int64(10)}),
+	}
+	conflicts = services.DiffRecord(records, "block", []string{"block.size"})
+	if len(conflicts) != 1 {
+		t.Fatalf("Fail TestDiffRecord, conflicts of uneven records %v\n", conflicts)
+	}
+	values = conflicts[0]["values"].([]mongo.DASRecord)
+	if len(values) != 3 || values[0]["service"] != "rucio:block4dataset" || values[2]["service"] != "phedex:blockReplicas" || values[2]["value"] != int64(10) {
+		t.Errorf("Fail TestDiffRecord, values of uneven records %v\n", values)
+	}
+	// different values from the same service are not conflicts
+	records = []mongo.DASRecord{
+		blockRecord("rucio:block4dataset", mongo.DASRecord{"name": "/a/b/c#1", "size": int64(10)}),
+		blockRecord("rucio:block4dataset", mongo.DASRecord{"name": "/a/b/c#1", "size": int64(12)}),
+	}
+	if conflicts := services.DiffRecord(records, "block", []string{"block.size"}); len(conflicts) != 0 {
+		t.Errorf("Fail TestDiffRecord, same service conflicts %v\n", conflicts)
+	}
+}
+
+// TestConsistencyRecord
+func TestConsistencyRecord(t *testing.T) {
+	dbsFiles := []mongo.DASRecord{
+		{"logical_file_name": "/store/a.root", "file_size": float64(10), "adler32": "0abc", "is_file_valid": float64(1)},
+		{"logical_file_name": "/store/b.root", "file_size": float64(20), "adler32": "def", "is_file_valid": float64(0)},
+		{"logical_file_name": "/store/c.root", "file_size": float64(30), "adler32": "123", "is_file_valid": float64(1)},
+	}
+	rucioFiles := []mongo.DASRecord{
+		{"name": "/store/a.root", "bytes": float64(10), "adler32": "abc"},
+		{"name": "/store/b.root", "bytes": float64(21), "adler32": "dee"},
+		{"name": "/store/d.root", "bytes": float64(40), "adler32": "456"},
+	}
+	rec := services.ConsistencyRecord("/a/b/c#1", dbsFiles, rucioFiles)
+	if rec["status"] != "inconsistent" || rec["nissues"] != 5 || rec["dataset"] != "/a/b/c" {
+		t.Fatalf("Fail TestConsistencyRecord, record %v\n", rec)
+	}
+	check := func(key, fname string) {
+		files := rec[key].([]string)
+		if len(files) != 1 || files[0] != fname {
+			t.Errorf("Fail TestConsistencyRecord, %s %v\n", key, files)
+		}
+	}
+	check("missing_in_rucio", "/store/c.root")
+	check("missing_in_dbs", "/store/d.root")
+	check("invalid_in_dbs", "/store/b.root")
+	for _, key := range []string{"size_mismatch", "checksum_mismatch"} {
+		items := rec[key].([]mongo.DASRecord)
+		if len(items) != 1 || items[0]["file"] != "/store/b.root" {
+			t.Errorf("Fail TestConsistencyRecord, %s %v\n", key, items)
+		}
+	}
+	rec = services.ConsistencyRecord("/a/b/c#1", dbsFiles[:1], rucioFiles[:1])
+	if rec["status"] != "consistent" {
+		t.Errorf("Fail TestConsistencyRecord, record %v\n", rec)
+	}
+}
+
+// TestServiceErrorRecord
+func TestServiceErrorRecord(t *testing.T) {
+	dasquery, _, _ := dasql.Parse("dataset dataset=/a/b/c", "prod/global", []string{"dataset"})
+	pkeys := []string{"dataset.name"}
+	r := utils.ResponseType{Error: http.ErrHandlerTimeout}
+	for _, system := range []string{"dbs3", "unknown"} {
+		recs := services.Unmarshal(dasquery, system, "datasets", r, nil, pkeys)
+		if len(recs) != 1 {
+			t.Fatalf("Fail TestServiceErrorRecord, system %s, records %v\n", system, recs)
+		}
+		rec := recs[0]
+		das, ok := rec["das"].(mongo.DASRecord)
+		if !ok || rec["qhash"] != dasquery.Qhash || das["primary_key"] != "dataset.name" || rec["error"] == nil {
+			t.Errorf("Fail TestServiceErrorRecord, system %s, record %v\n", system, rec)
+		}
+	}
+	recs := services.Unmarshal(dasquery, "dbs3", "datasets", r, nil, pkeys)
+	if recs[0]["code"] != utils.DBSError {
+		t.Errorf("Fail TestServiceErrorRecord, DBS error code %v\n", recs[0]["code"])
+	}
+	// data of unregistered system should not look like empty result
+	recs = services.Unmarshal(dasquery, "unknown", "datasets", utils.ResponseType{Data: []byte("[]")}, nil, pkeys)
+	if len(recs) != 1 || recs[0]["error"] == nil {
+		t.Errorf("Fail TestServiceErrorRecord, unregistered system records %v\n", recs)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dmwm/das2go/das"
+	"github.com/dmwm/das2go/mongo"
+)
+
+// TestCallStatus
+func TestCallStatus(t *testing.T) {
+	recs := []mongo.DASRecord{{"dataset": "/a/b/c"}, {"dataset": "/a/b/d"}}
+	errRec := mongo.DASRecord{"error": "unable to parse response", "type": "DBS", "code": 1}
+	tests := []struct {
+		records []mongo.DASRecord
+		err     error
+		status  string
+		nrec    int
+	}{
+		{recs, nil, "ok", 2},
+		{nil, nil, "empty", 0},
+		{[]mongo.DASRecord{errRec}, nil, "error", 0},
+		{append(recs, errRec), nil, "ok", 2},
+		{[]mongo.DASRecord{errRec}, errors.New("connection refused"), "error", 0},
+		{nil, http.ErrHandlerTimeout, "timeout", 0},
+		{nil, errors.New("Client.Timeout exceeded while awaiting headers"), "timeout", 0},
+	}
+	for _, test := range tests {
+		status := das.CallStatus("dbs3:datasets", test.records, test.err, 2*time.Second)
+		if status.Status != test.status || status.Records != test.nrec || status.Latency != 2 {
+			t.Errorf("Fail TestCallStatus, status %+v expect %s %d\n", status, test.status, test.nrec)
+		}
+		if test.status == "error" && status.Error == "" {
+			t.Errorf("Fail TestCallStatus, no error message %+v\n", status)
+		}
+	}
+}
+
+// TestQueryReport
+func TestQueryReport(t *testing.T) {
+	srvs := []string{"dbs3:datasets", "rucio:datasets", "mcm:dataset", "dbs3:datasets"}
+	ok := das.ServiceStatus{Service: "dbs3:datasets", Status: "ok", Records: 1}
+	empty := das.ServiceStatus{Service: "mcm:dataset", Status: "empty"}
+	fail := das.ServiceStatus{Service: "rucio:datasets", Status: "timeout", Error: "timeout"}
+
+	report := das.NewQueryReport(srvs, []das.ServiceStatus{ok, empty, fail})
+	if report.State != "partial" || len(report.Services) != 3 {
+		t.Errorf("Fail TestQueryReport, report %+v\n", report)
+	}
+	// services which were not called are skipped
+	report = das.NewQueryReport(srvs, []das.ServiceStatus{ok, empty})
+	if report.State != "complete" || len(report.Services) != 3 || report.Services[2].Status != "skipped" {
+		t.Errorf("Fail TestQueryReport, report %+v\n", report)
+	}
+	report = das.NewQueryReport(srvs[1:2], []das.ServiceStatus{fail})
+	if report.State != "failed" {
+		t.Errorf("Fail TestQueryReport, report %+v\n", report)
+	}
+	// query is not complete when none of its services was called
+	report = das.NewQueryReport(srvs, nil)
+	if report.State != "skipped" || len(report.Services) != 3 {
+		t.Errorf("Fail TestQueryReport, report %+v\n", report)
+	}
+	report = das.NewQueryReport(nil, nil)
+	if report.State != "skipped" {
+		t.Errorf("Fail TestQueryReport, report %+v\n", report)
+	}
+}
@@ -118,6 +118,39 @@ func TestSizeFormat(t *testing.T) {
 	}
 }
 
+// TestAggregators
+func TestAggregators(t *testing.T) {
+	var values []interface{}
+	for i := 1; i <= 10; i++ {
+		values = append(values, float64(i))
+	}
+	if res := utils.Percentile(values, 50); res != 5.5 {
+		t.Errorf("Fail TestAggregators, p50=%v\n", res)
+	}
+	if res := utils.Median(values); res != 5.5 {
+		t.Errorf("Fail TestAggregators, median=%v\n", res)
+	}
+	if res := utils.Percentile(values, 90); res != 9.1 {
+		t.Errorf("Fail TestAggregators, p90=%v\n", res)
+	}
+	values = append(values, float64(10))
+	if res := utils.CountDistinct(values); res != 10 {
+		t.Errorf("Fail TestAggregators, count_distinct=%v\n", res)
+	}
+	bins := utils.Histogram(values, 3)
+	if len(bins) != 3 || bins[0].Count+bins[1].Count+bins[2].Count != len(values) {
+		t.Errorf("Fail TestAggregators, histogram=%+v\n", bins)
+	}
+	if bins[2].Count != 5 {
+		t.Errorf("Fail TestAggregators, histogram last bin=%+v\n", bins[2])
+	}
+	for _, name := range []string{"mean", "p99", "stddev", "histogram"} {
+		if _, ok := utils.GetAggregator(name); !ok {
+			t.Errorf("Fail TestAggregators, no %s aggregator\n", name)
+		}
+	}
+}
+
 // helper funcion to fethc Urls
 func fetchUrls(niterations int) {
 	rurl := "https://jsonplaceholder.typicode.com/todos"
@@ -176,3 +209,18 @@ func TestCerts(t *testing.T) {
 		t.Errorf("Fail TestCerts: current certificate expired in 600 seconds\n")
 	}
 }
+
+// TestClosestMatches
+func TestClosestMatches(t *testing.T) {
+	if d := utils.EditDistance("kitten", "sitting"); d != 3 {
+		t.Errorf("Fail TestClosestMatches, edit distance %v\n", d)
+	}
+	keys := []string{"block", "dataset", "file", "lumi", "run", "site"}
+	res := utils.ClosestMatches("fiel", keys, 3)
+	if len(res) == 0 || res[0] != "file" {
+		t.Errorf("Fail TestClosestMatches, matches %v\n", res)
+	}
+	if res := utils.ClosestMatches("xyzxyz", keys, 3); len(res) != 0 {
+		t.Errorf("Fail TestClosestMatches, unexpected matches %v\n", res)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dmwm/das2go/web"
+)
+
+// TestPopularQueries tests selection of popular queries for cache warming
+func TestPopularQueries(t *testing.T) {
+	stats := []web.QueryStats{
+		{Query: "dataset=/a/b/RAW", Hits: 3, LastHit: 10},
+		{Query: "site dataset=/a/b/RAW", Hits: 10, LastHit: 5},
+		{Query: "block dataset=/a/b/RAW", Hits: 1, LastHit: 20},
+		{Query: "file dataset=/a/b/RAW", Hits: 3, LastHit: 30},
+	}
+	popular := web.PopularQueries(stats, 2, 2)
+	if len(popular) != 2 {
+		t.Fatalf("wrong number of popular queries %v", popular)
+	}
+	if popular[0].Query != "site dataset=/a/b/RAW" || popular[1].Query != "file dataset=/a/b/RAW" {
+		t.Errorf("wrong order of popular queries %v", popular)
+	}
+	if popular := web.PopularQueries(stats, 0, 3); len(popular) != 3 {
+		t.Errorf("wrong number of popular queries without limit %v", popular)
+	}
+}
@@ -0,0 +1,197 @@
+package utils
+
+// DAS aggregators module
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Aggregator represents aggregation function applied to list of values,
+// extra arguments of aggregator, e.g. number of histogram bins, are passed as args
+type Aggregator func(values []interface{}, args []string) interface{}
+
+// HistogramBin represents single bucket of histogram aggregator
+type HistogramBin struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Count int     `json:"count"`
+}
+
+// HistogramBins defines default number of bins used by histogram aggregator
+var HistogramBins = 10
+
+// registry of known aggregators
+var aggregators = make(map[string]Aggregator)
+var aggregatorsLock sync.RWMutex
+
+func init() {
+	RegisterAggregator("sum", func(values []interface{}, args []string) interface{} { return Sum(values) })
+	RegisterAggregator("min", func(values []interface{}, args []string) interface{} { return Min(values) })
+	RegisterAggregator("max", func(values []interface{}, args []string) interface{} { return Max(values) })
+	RegisterAggregator("mean", func(values []interface{}, args []string) interface{} { return Mean(values) })
+	RegisterAggregator("avg", func(values []interface{}, args []string) interface{} { return Avg(values) })
+	RegisterAggregator("median", func(values []interface{}, args []string) interface{} { return Median(values) })
+	RegisterAggregator("count", func(values []interface{}, args []string) interface{} { return len(values) })
+	RegisterAggregator("count_distinct", func(values []interface{}, args []string) interface{} { return CountDistinct(values) })
+	RegisterAggregator("stddev", func(values []interface{}, args []string) interface{} { return StdDev(values) })
+	RegisterAggregator("p50", func(values []interface{}, args []string) interface{} { return Percentile(values, 50) })
+	RegisterAggregator("p90", func(values []interface{}, args []string) interface{} { return Percentile(values, 90) })
+	RegisterAggregator("p99", func(values []interface{}, args []string) interface{} { return Percentile(values, 99) })
+	RegisterAggregator("histogram", func(values []interface{}, args []string) interface{} {
+		nbins := HistogramBins
+		if len(args) > 0 {
+			if v, err := strconv.Atoi(args[0]); err == nil && v > 0 {
+				nbins = v
+			}
+		}
+		return Histogram(values, nbins)
+	})
+}
+
+// RegisterAggregator registers aggregator function under given name
+func RegisterAggregator(name string, f Aggregator) {
+	aggregatorsLock.Lock()
+	defer aggregatorsLock.Unlock()
+	aggregators[name] = f
+}
+
+// GetAggregator returns aggregator function for given name
+func GetAggregator(name string) (Aggregator, bool) {
+	aggregatorsLock.RLock()
+	defer aggregatorsLock.RUnlock()
+	f, ok := aggregators[name]
+	return f, ok
+}
+
+// AggregatorNames returns sorted list of registered aggregators
+func AggregatorNames() []string {
+	aggregatorsLock.RLock()
+	defer aggregatorsLock.RUnlock()
+	var out []string
+	for name := range aggregators {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ToFloat helper function to convert numeric value (or its string representation) into float64
+func ToFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		vv, e := v.Float64()
+		return vv, e == nil
+	case string:
+		vv, e := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return vv, e == nil
+	}
+	return 0, false
+}
+
+// helper function to return sorted numeric values out of provided array of values
+func floats(data []interface{}) []float64 {
+	var out []float64
+	for _, val := range data {
+		if v, ok := ToFloat(val); ok {
+			out = append(out, v)
+		}
+	}
+	sort.Float64s(out)
+	return out
+}
+
+// Percentile helper function to calculate given percentile over provided array of values,
+// we use linear interpolation between closest ranks
+func Percentile(data []interface{}, pct float64) float64 {
+	input := floats(data)
+	l := len(input)
+	if l == 0 {
+		return 0
+	}
+	if l == 1 {
+		return input[0]
+	}
+	rank := pct / 100 * float64(l-1)
+	low := int(math.Floor(rank))
+	high := int(math.Ceil(rank))
+	if high >= l {
+		high = l - 1
+	}
+	return input[low] + (input[high]-input[low])*(rank-float64(low))
+}
+
+// StdDev helper function to calculate (population) standard deviation over provided array of values
+func StdDev(data []interface{}) float64 {
+	input := floats(data)
+	if len(input) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range input {
+		sum += v
+	}
+	mean := sum / float64(len(input))
+	var dev float64
+	for _, v := range input {
+		dev += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(dev / float64(len(input)))
+}
+
+// CountDistinct helper function to count distinct values in provided array of values
+func CountDistinct(data []interface{}) int {
+	seen := make(map[string]bool)
+	for _, val := range data {
+		if val == nil {
+			continue
+		}
+		seen[fmt.Sprintf("%v", val)] = true
+	}
+	return len(seen)
+}
+
+// Histogram helper function to bucket provided array of values into nbins equal bins
+func Histogram(data []interface{}, nbins int) []HistogramBin {
+	var out []HistogramBin
+	input := floats(data)
+	if len(input) == 0 || nbins <= 0 {
+		return out
+	}
+	low := input[0]
+	high := input[len(input)-1]
+	width := (high - low) / float64(nbins)
+	if width == 0 {
+		return []HistogramBin{{Low: low, High: high, Count: len(input)}}
+	}
+	for i := 0; i < nbins; i++ {
+		bin := HistogramBin{Low: low + float64(i)*width, High: low + float64(i+1)*width}
+		out = append(out, bin)
+	}
+	for _, v := range input {
+		idx := int((v - low) / width)
+		if idx >= nbins { // last bin includes its upper edge
+			idx = nbins - 1
+		}
+		out[idx].Count += 1
+	}
+	return out
+}
@@ -1,6 +1,8 @@
 package utils
 
-// DASServerError and others are represent different types of errors in DAS
+// DASServerError and others are represent different types of errors in DAS.
+// Codes of data-services are kept for compatibility with existing clients,
+// new data-services define their codes in their service plugins.
 const (
 	_ = iota
 	DASServerError
@@ -228,7 +228,7 @@ func (r *ResponseType) String() string {
 
 // Details returns ResponseType details
 func (r *ResponseType) Details() string {
-	s := fmt.Sprintf("system=%s method=%s url=\"%s\" params=\"%v\" time=%v sendBytes=%v recvBytes=%v error=%v", system(r.Url), r.Method, r.Url, r.Params, r.Time, r.SendBytes, r.RecvBytes, r.Error)
+	s := fmt.Sprintf("system=%s method=%s url=\"%s\" params=\"%v\" time=%v sendBytes=%v recvBytes=%v error=%v", SystemName(r.Url), r.Method, r.Url, r.Params, r.Time, r.SendBytes, r.RecvBytes, r.Error)
 	return s
 }
 
@@ -277,6 +277,12 @@ var (
 	UrlRetry int
 	// UrlRequestChannel is a UrlRequest channel
 	UrlRequestChannel = make(chan UrlRequest)
+	// SystemName returns name of data-service given URL belongs to,
+	// it is set by services package from registered data-services
+	SystemName = func(rurl string) string { return "combined" }
+	// RequestHook adjusts HTTP request to given URL for its data-service,
+	// e.g. adds authentication headers, it is set by services package
+	RequestHook func(rurl string, req *http.Request)
 )
 
 func Init() {
@@ -358,9 +364,6 @@ func FetchResponse(httpClient *http.Client, rurl, args string) ResponseType {
 	} else {
 		req, _ = http.NewRequest("GET", rurl, nil)
 		req.Header.Add("Accept-Encoding", "identity")
-		if strings.Contains(rurl, "sitedb") || strings.Contains(rurl, "reqmgr") || strings.Contains(rurl, "mcm") {
-			req.Header.Add("Accept", "application/json")
-		}
 		atomic.AddUint64(&TotalGetCalls, 1)
 		response.Method = "GET"
 	}
@@ -368,23 +371,12 @@ func FetchResponse(httpClient *http.Client, rurl, args string) ResponseType {
 		req.Header.Add("Connection", "Keep-Alive")
 		req.Header.Add("Keep-Alive", "timeout=5, max=1000")
 	}
-	// use gzip encoding if our rurl is going to DBS
-	if strings.Contains(rurl, "dbs") {
-		req.Header.Add("Accept-Encoding", "gzip")
-	}
 	if Token != "" {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", readToken(Token)))
 	}
-	if strings.Contains(rurl, "rucio") { // we need to fetch auth token
-		token, err := RucioAuth.Token()
-		if err == nil {
-			req.Header.Add("X-Rucio-Auth-Token", token)
-		}
-		req.Header.Add("Accept", "application/x-json-stream")
-		req.Header.Add("Connection", "Keep-Alive")
-		if WEBSERVER > 0 {
-			req.Header.Add("X-Rucio-Account", RucioAuth.Account())
-		}
+	// let data-service add its own headers, e.g. authentication token
+	if RequestHook != nil {
+		RequestHook(rurl, req)
 	}
 	if CLIENT_VERSION != "" {
 		req.Header.Set("User-Agent", fmt.Sprintf("dasgoclient/%s", CLIENT_VERSION))
@@ -442,7 +434,7 @@ func FetchResponse(httpClient *http.Client, rurl, args string) ResponseType {
 					fmt.Printf("DAS GET %s %v\n", rurl, time.Now().Sub(startTime))
 				}
 			} else {
-				log.Printf("DAS GET system=%s url=\"%s\" time=%v\n", system(rurl), rurl, time.Now().Sub(startTime))
+				log.Printf("DAS GET system=%s url=\"%s\" time=%v\n", SystemName(rurl), rurl, time.Now().Sub(startTime))
 			}
 		} else {
 			if WEBSERVER == 0 {
@@ -453,35 +445,13 @@ func FetchResponse(httpClient *http.Client, rurl, args string) ResponseType {
 					fmt.Printf("DAS POST %s args %v, %v\n", rurl, args, time.Now().Sub(startTime))
 				}
 			} else {
-				log.Printf("DAS POST system=%s url=\"%s\" args=\"%v\" time=%v\n", system(rurl), rurl, args, time.Now().Sub(startTime))
+				log.Printf("DAS POST system=%s url=\"%s\" args=\"%v\" time=%v\n", SystemName(rurl), rurl, args, time.Now().Sub(startTime))
 			}
 		}
 	}
 	return response
 }
 
-// helper function to extract cmsweb system
-func system(rurl string) string {
-	if strings.Contains(rurl, "dbs") {
-		return "dbs"
-	} else if strings.Contains(rurl, "rucio") {
-		return "rucio"
-	} else if strings.Contains(rurl, "reqmgr") {
-		return "reqmgr"
-	} else if strings.Contains(rurl, "mcm") {
-		return "mcm"
-	} else if strings.Contains(rurl, "conddb") {
-		return "conddb"
-	} else if strings.Contains(rurl, "phedex") {
-		return "phedex"
-	} else if strings.Contains(rurl, "runregistry") {
-		return "runregistry"
-	} else if strings.Contains(rurl, "dashboard") {
-		return "dashboard"
-	}
-	return "combined"
-}
-
 // Fetch data for provided URL and redirect results to given channel
 // This wrapper function look-up UrlQueueLimit and either redirect to
 // URULFetchWorker go-routine or pass the call to local fetch function
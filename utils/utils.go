@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"reflect"
 	"runtime"
@@ -304,6 +305,69 @@ func SizeFormat(val interface{}) string {
 	return fmt.Sprintf("%v (%3.1f%s)", val, size, xlist[len(xlist)])
 }
 
+// ParseSize helper function to convert size with optional units, e.g. 2GB or 1.5TB,
+// into a number. We follow CMS convention and use power of 10 for units.
+func ParseSize(val string) (float64, bool) {
+	v := strings.ToUpper(strings.TrimSpace(val))
+	units := []string{"KB", "MB", "GB", "TB", "PB"}
+	factor := 1.
+	for i := len(units) - 1; i >= 0; i-- {
+		if strings.HasSuffix(v, units[i]) {
+			factor = math.Pow(1000, float64(i+1))
+			v = strings.TrimSpace(strings.TrimSuffix(v, units[i]))
+			break
+		}
+	}
+	if factor == 1 && strings.HasSuffix(v, "B") {
+		v = strings.TrimSpace(strings.TrimSuffix(v, "B"))
+	}
+	size, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size * factor, true
+}
+
+// CompareValues helper function to compare two values of DAS records. Numbers
+// (including json.Number and sizes with units) are compared numerically, other
+// values by their string representation, and nil values are placed last.
+// It returns -1, 0 or 1.
+func CompareValues(a, b interface{}) int {
+	if a == nil || a == "" {
+		if b == nil || b == "" {
+			return 0
+		}
+		return 1
+	}
+	if b == nil || b == "" {
+		return -1
+	}
+	fa, oka := numericValue(a)
+	fb, okb := numericValue(b)
+	if oka && okb {
+		if fa < fb {
+			return -1
+		} else if fa > fb {
+			return 1
+		}
+		return 0
+	}
+	sa := fmt.Sprintf("%v", a)
+	sb := fmt.Sprintf("%v", b)
+	return strings.Compare(sa, sb)
+}
+
+// helper function to get numeric value out of number or its string representation
+func numericValue(val interface{}) (float64, bool) {
+	if v, ok := ToFloat(val); ok {
+		return v, true
+	}
+	if v, ok := val.(string); ok {
+		return ParseSize(v)
+	}
+	return 0, false
+}
+
 // IsInt helper function to test if given value is integer
 func IsInt(val string) bool {
 	return PatternInt.MatchString(val)
@@ -414,7 +478,7 @@ func Median(data []interface{}) float64 {
 	if l == 0 {
 		return 0
 	} else if l%2 == 0 {
-		median = (input[l/2-1] + input[l/2+1]) / 2.
+		median = (input[l/2-1] + input[l/2]) / 2.
 	} else {
 		median = float64(input[l/2])
 	}
@@ -593,3 +657,63 @@ const BOLD = "\x1b[1m"
 
 // PLAIN type
 const PLAIN = "\x1b[0m"
+
+// EditDistance helper function to calculate Levenshtein distance between two strings
+func EditDistance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j] + 1
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// ClosestMatches helper function to find entries of given list closest to given word,
+// only entries within reasonable edit distance are returned ordered by their distance
+func ClosestMatches(word string, list []string, limit int) []string {
+	maxDist := len(word)/3 + 1
+	if maxDist < 2 {
+		maxDist = 2
+	}
+	dist := make(map[string]int)
+	var out []string
+	for _, item := range list {
+		if _, ok := dist[item]; ok {
+			continue
+		}
+		d := EditDistance(strings.ToLower(word), strings.ToLower(item))
+		if d <= maxDist || (len(word) > 2 && strings.HasPrefix(item, word)) {
+			dist[item] = d
+			out = append(out, item)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if dist[out[i]] == dist[out[j]] {
+			return out[i] < out[j]
+		}
+		return dist[out[i]] < dist[out[j]]
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,415 @@
+package web
+
+// das2go - DAS bulk query submission API
+//
+// Copyright (c) 2015-2017 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmwm/das2go/config"
+	"github.com/dmwm/das2go/das"
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/utils"
+)
+
+// maximum number of queries accepted in single bulk request
+var bulkMaxQueries = 1000
+
+// time to keep finished bulk jobs in memory
+var bulkJobExpire = time.Hour
+
+// BulkRequest represents bulk request, it contains either list of queries or
+// query template with list of values, e.g.
+// {"template": "site dataset=%s", "values": ["/a/b/c", "/a/b/d"]}
+type BulkRequest struct {
+	Queries  []string `json:"queries"`  // list of DAS queries
+	Template string   `json:"template"` // DAS query template, %s is replaced by values
+	Values   []string `json:"values"`   // list of values for query template
+	Instance string   `json:"instance"` // DBS instance to use
+}
+
+// BulkQuery represents status of single query of bulk job
+type BulkQuery struct {
+	Query  string `json:"query"`           // DAS query
+	Pid    string `json:"pid,omitempty"`   // DAS query hash
+	Status string `json:"status"`          // query status: requested, processing, ok, fail
+	Error  string `json:"error,omitempty"` // query error
+
+	dasquery dasql.DASQuery
+	done     chan struct{}
+}
+
+// BulkJob represents bulk job
+type BulkJob struct {
+	Id       string       `json:"job"`      // job id
+	Time     int64        `json:"tstamp"`   // job submission time
+	Queries  []*BulkQuery `json:"queries"`  // job queries
+	Finished int64        `json:"finished"` // time when all job queries are finished
+}
+
+// global bulk jobs
+var _bulkJobs = make(map[string]*BulkJob)
+
+// lock which protects _bulkJobs and status of their queries
+var _bulkLock sync.RWMutex
+
+// helper function to generate new job id
+func bulkJobId() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Expand returns list of queries of bulk request, query template is expanded
+// with every value
+func (b *BulkRequest) Expand() ([]string, error) {
+	queries := b.Queries
+	if b.Template != "" {
+		if !strings.Contains(b.Template, "%s") {
+			return nil, fmt.Errorf("query template %s does not contain %%s", b.Template)
+		}
+		for _, val := range b.Values {
+			queries = append(queries, strings.Replace(b.Template, "%s", val, -1))
+		}
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries are provided")
+	}
+	if len(queries) > bulkMaxQueries {
+		return nil, fmt.Errorf("too many queries %d, maximum is %d", len(queries), bulkMaxQueries)
+	}
+	return queries, nil
+}
+
+// BulkRunner processes queries of bulk jobs and fetches their results
+type BulkRunner struct {
+	Parallel int // number of queries processed in parallel
+	PageSize int // number of records fetched at once when results are streamed
+
+	// Process returns when data of given query are ready in DAS cache
+	Process func(dasquery dasql.DASQuery) error
+	// Fetch returns status and page of records of given query which follows
+	// given cursor, along with cursor of the next page
+	Fetch func(dasquery dasql.DASQuery, cursor string, limit int) (string, []mongo.DASRecord, string)
+}
+
+// helper function to update status of bulk query
+func (q *BulkQuery) setStatus(status, err string) {
+	_bulkLock.Lock()
+	q.Status = status
+	q.Error = err
+	_bulkLock.Unlock()
+}
+
+// State returns status and error of bulk query
+func (q *BulkQuery) State() (string, string) {
+	_bulkLock.RLock()
+	defer _bulkLock.RUnlock()
+	return q.Status, q.Error
+}
+
+// Done returns channel which is closed when bulk query is finished
+func (q *BulkQuery) Done() <-chan struct{} {
+	return q.done
+}
+
+// helper function to process single query of bulk job, it returns when
+// query data are ready in DAS cache. If the query is processed by another
+// request we wait for it at most das.ProcessingTimeout seconds and process
+// the query ourselves if its records disappear, e.g. when other request
+// fails or its records are evicted.
+func processBulkQuery(dasquery dasql.DASQuery, dmaps dasmaps.DASMaps) error {
+	pid := dasquery.Qhash
+	das.RemoveExpired(pid)
+	deadline := time.Now().Add(time.Duration(das.ProcessingTimeout) * time.Second)
+	processed := false
+	for !das.CheckDataReadiness(pid) {
+		if !das.CheckData(pid) {
+			if processed {
+				return fmt.Errorf("no DAS records found for query %s", dasquery.Query)
+			}
+			das.Process(dasquery, dmaps)
+			processed = true
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("query is not processed within %d seconds", das.ProcessingTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+	return nil
+}
+
+// helper function to fetch page of records of processed query from DAS cache
+func fetchBulkQuery(dasquery dasql.DASQuery, cursor string, limit int) (string, []mongo.DASRecord, string) {
+	status, data, page := das.GetDataCursor(dasquery, "merge", cursor, limit)
+	return status, data, page.Next
+}
+
+// helper function to create bulk runner which uses DAS processing and DAS cache
+func dasBulkRunner(dmaps dasmaps.DASMaps) *BulkRunner {
+	parallel := config.Current().BulkParallel
+	if parallel <= 0 {
+		parallel = 5
+	}
+	process := func(dasquery dasql.DASQuery) error {
+		return processBulkQuery(dasquery, dmaps)
+	}
+	return &BulkRunner{Parallel: parallel, PageSize: 100, Process: process, Fetch: fetchBulkQuery}
+}
+
+// helper function to run single query of bulk job
+func (b *BulkRunner) run(q *BulkQuery) {
+	defer close(q.done)
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("ERROR: bulk query %s, error %v\n", q.Query, err)
+			q.setStatus("fail", fmt.Sprintf("%v", err))
+		}
+	}()
+	q.setStatus("processing", "")
+	if err := b.Process(q.dasquery); err != nil {
+		log.Printf("ERROR: bulk query %s, error %v\n", q.Query, err)
+		q.setStatus("fail", err.Error())
+		return
+	}
+	q.setStatus("ok", "")
+}
+
+// Run processes queries of given bulk job, at most Parallel queries are
+// processed at the same time. It returns when all queries are finished.
+func (b *BulkRunner) Run(job *BulkJob) {
+	parallel := b.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	for _, q := range job.Queries {
+		if q.Pid == "" {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(q *BulkQuery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			b.run(q)
+		}(q)
+	}
+	wg.Wait()
+	_bulkLock.Lock()
+	job.Finished = time.Now().Unix()
+	_bulkLock.Unlock()
+}
+
+// helper function to remove finished bulk jobs
+func cleanupBulkJobs() {
+	_bulkLock.Lock()
+	defer _bulkLock.Unlock()
+	for id, job := range _bulkJobs {
+		if job.Finished > 0 && time.Now().Unix()-job.Finished > int64(bulkJobExpire.Seconds()) {
+			delete(_bulkJobs, id)
+		}
+	}
+}
+
+// NewBulkJob creates bulk job for given request, queries are parsed with
+// given DBS instance and DAS keys. Queries which can not be parsed are
+// failed right away.
+func NewBulkJob(req BulkRequest, inst string, daskeys []string) (*BulkJob, error) {
+	queries, err := req.Expand()
+	if err != nil {
+		return nil, err
+	}
+	job := &BulkJob{Id: bulkJobId(), Time: time.Now().Unix()}
+	for _, query := range queries {
+		q := &BulkQuery{Query: query, Status: "requested", done: make(chan struct{})}
+		dasquery, qlerr, _ := dasql.Parse(query, inst, daskeys)
+		if qlerr != "" {
+			q.Status = "fail"
+			q.Error = qlerr
+			close(q.done)
+		} else {
+			q.dasquery = dasquery
+			q.Pid = dasquery.Qhash
+		}
+		job.Queries = append(job.Queries, q)
+	}
+	return job, nil
+}
+
+// SubmitBulkJob creates bulk job for given request and schedules its queries
+// through DAS processing with bounded parallelism
+func SubmitBulkJob(req BulkRequest, dmaps *dasmaps.DASMaps) (*BulkJob, error) {
+	inst := req.Instance
+	if inst == "" {
+		inst = dmaps.DBSInstance()
+		if inst == "" && len(config.Current().DbsInstances) > 0 { // case of dbs2go
+			inst = config.Current().DbsInstances[0]
+		}
+	}
+	job, err := NewBulkJob(req, inst, dmaps.DASKeys())
+	if err != nil {
+		return nil, err
+	}
+	cleanupBulkJobs()
+	_bulkLock.Lock()
+	_bulkJobs[job.Id] = job
+	_bulkLock.Unlock()
+
+	runner := dasBulkRunner(*dmaps)
+	go func() {
+		runner.Run(job)
+		log.Printf("bulk job %s finished, %d queries", job.Id, len(job.Queries))
+	}()
+	return job, nil
+}
+
+// helper function to write NDJSON records, written records are flushed to
+// the client at once
+func writeNDJSON(w http.ResponseWriter, recs ...interface{}) error {
+	for _, rec := range recs {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// helper function to stream results of single bulk query, records are
+// fetched and flushed page by page
+func (b *BulkRunner) streamQuery(w http.ResponseWriter, r *http.Request, q *BulkQuery) error {
+	status, qerr := q.State()
+	if status != "ok" {
+		return writeNDJSON(w, mongo.DASRecord{"query": q.Query, "pid": q.Pid, "status": status, "error": qerr})
+	}
+	limit := b.PageSize
+	if limit <= 0 {
+		limit = 100
+	}
+	var cursor string
+	var nres int
+	for {
+		if r.Context().Err() != nil {
+			return r.Context().Err()
+		}
+		dstatus, data, next := b.Fetch(q.dasquery, cursor, limit)
+		if strings.HasPrefix(dstatus, "ERROR") {
+			return writeNDJSON(w, mongo.DASRecord{"query": q.Query, "pid": q.Pid, "status": "fail", "error": strings.TrimSpace(dstatus)})
+		}
+		var recs []interface{}
+		for _, rec := range data {
+			recs = append(recs, mongo.DASRecord{"query": q.Query, "pid": q.Pid, "status": dstatus, "record": rec})
+		}
+		if nres == 0 && len(recs) == 0 {
+			return writeNDJSON(w, mongo.DASRecord{"query": q.Query, "pid": q.Pid, "status": dstatus, "nresults": 0})
+		}
+		nres += len(recs)
+		if err := writeNDJSON(w, recs...); err != nil {
+			return err
+		}
+		if next == "" || next == cursor {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Stream writes results of given bulk job as NDJSON, every record is tagged
+// with its originating query and pid, queries are streamed in submission
+// order as soon as they are finished
+func (b *BulkRunner) Stream(w http.ResponseWriter, r *http.Request, job *BulkJob) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	for _, q := range job.Queries {
+		select {
+		case <-q.done:
+		case <-r.Context().Done():
+			return
+		}
+		if err := b.streamQuery(w, r, q); err != nil {
+			log.Printf("ERROR: bulk job %s, unable to write records, error %v\n", job.Id, err)
+			return
+		}
+	}
+}
+
+// BulkHandler handles bulk requests. POST request submits bulk job and returns
+// its id, GET request with job parameter streams job results as NDJSON, while
+// with status parameter it returns status of job queries, e.g.
+// curl -X POST -d '{"template":"site dataset=%s", "values":["/a/b/c"]}' /das/bulk
+// curl /das/bulk?job=<id>
+func BulkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		defer r.Body.Close()
+		var req BulkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("unable to decode bulk request, error=%v", err), http.StatusBadRequest)
+			return
+		}
+		job, err := SubmitBulkJob(req, currentMaps())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("bulk job %s submitted, %d queries", job.Id, len(job.Queries))
+		data, err := json.Marshal(map[string]interface{}{"job": job.Id, "nqueries": len(job.Queries)})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	_bulkLock.RLock()
+	job, ok := _bulkJobs[r.FormValue("job")]
+	_bulkLock.RUnlock()
+	if !ok {
+		http.Error(w, "DAS bulk job is not found", http.StatusNotFound)
+		return
+	}
+	if r.FormValue("status") != "" {
+		_bulkLock.RLock()
+		data, err := json.Marshal(job)
+		_bulkLock.RUnlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+	if utils.VERBOSE > 0 {
+		log.Printf("stream bulk job %s", job.Id)
+	}
+	dasBulkRunner(*currentMaps()).Stream(w, r, job)
+}
@@ -0,0 +1,146 @@
+package web
+
+// das2go - DAS web server
+// cache module, it provides admin API and page to inspect and invalidate
+// DAS cache
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dmwm/das2go/config"
+	"github.com/dmwm/das2go/das"
+	"github.com/dmwm/das2go/utils"
+)
+
+// helper function to check if request comes from DAS admin
+func adminRequest(w http.ResponseWriter, r *http.Request, action string) (string, bool) {
+	userDN := UserDN(r)
+	if !utils.InList(userDN, config.Current().AdminDNs) {
+		log.Printf("ERROR: user DN %s is not allowed to %s\n", userDN, action)
+		http.Error(w, "You are not allowed to access this resource", http.StatusForbidden)
+		return userDN, false
+	}
+	return userDN, true
+}
+
+// helper function to check if client asks for JSON response
+func jsonRequest(r *http.Request) bool {
+	if r.FormValue("format") == "json" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(r.Header.Get("Accept")), "json")
+}
+
+// helper function to write JSON response
+func writeJSON(w http.ResponseWriter, status int, rec interface{}) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to marshal data, error=%v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// helper function to get cache filter from request, POST requests may
+// provide it as JSON
+func cacheFilter(r *http.Request) (das.CacheFilter, error) {
+	var filter das.CacheFilter
+	if r.Method == "POST" && strings.Contains(r.Header.Get("Content-Type"), "json") {
+		defer r.Body.Close()
+		err := json.NewDecoder(r.Body).Decode(&filter)
+		return filter, err
+	}
+	filter.Qhash = strings.TrimSpace(r.FormValue("qhash"))
+	filter.Pattern = strings.TrimSpace(r.FormValue("pattern"))
+	filter.Service = strings.TrimSpace(r.FormValue("service"))
+	filter.Instance = strings.TrimSpace(r.FormValue("instance"))
+	return filter, nil
+}
+
+// CacheHandler handles DAS cache admin requests. GET request lists cached
+// queries matching given filter (qhash, pattern, service, instance) or
+// returns cache statistics (stats=1), POST request invalidates matched queries
+func CacheHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userDN, ok := adminRequest(w, r, "access DAS cache")
+	if !ok {
+		return
+	}
+	filter, err := cacheFilter(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to parse cache filter, error=%v", err), http.StatusBadRequest)
+		return
+	}
+	if r.Method == "POST" {
+		nrec, err := das.InvalidateCache(filter)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to invalidate DAS cache, error=%v", err), http.StatusBadRequest)
+			return
+		}
+		log.Printf("user %s invalidated %d DAS queries, filter %+v\n", userDN, nrec, filter)
+		if jsonRequest(r) || strings.Contains(r.Header.Get("Content-Type"), "json") {
+			writeJSON(w, http.StatusOK, map[string]int{"removed": nrec})
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("%s?removed=%d", r.URL.Path, nrec), http.StatusSeeOther)
+		return
+	}
+	if r.FormValue("stats") == "1" {
+		writeJSON(w, http.StatusOK, das.CacheStats())
+		return
+	}
+	entries, err := das.CacheEntries(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to look-up DAS cache, error=%v", err), http.StatusBadRequest)
+		return
+	}
+	if jsonRequest(r) {
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+	var templates DASTemplates
+	tmplData := make(map[string]interface{})
+	tmplData["Base"] = r.URL.Path
+	tmplData["Filter"] = filter
+	tmplData["Entries"] = entries
+	tmplData["Stats"] = das.CacheStats()
+	tmplData["Removed"] = r.FormValue("removed")
+	page := templates.Cache(config.Current().Templates, tmplData)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(currentPages().top + currentPages().search + currentPages().hiddenCards + page + currentPages().bottom))
+}
+
+// helper function to run DAS cache sweeper, it evicts expired queries which
+// can no longer be served as stale ones and keeps DAS cache within its size
+// limit
+func sweepScheduler() {
+	for {
+		interval := intSetting(config.Current().SweepInterval, 600)
+		if config.Current().SweepInterval < 0 {
+			time.Sleep(time.Minute) // check again if sweeper was enabled by reload
+			continue
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					log.Printf("ERROR: DAS cache sweep, error %v\n", err)
+				}
+			}()
+			das.Sweep(int64(config.Current().StaleMaxAge), config.Current().CacheMaxSize)
+		}()
+	}
+}
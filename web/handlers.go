@@ -22,6 +22,7 @@ import (
 	"github.com/dmwm/das2go/dasmaps"
 	"github.com/dmwm/das2go/dasql"
 	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
 	"github.com/dmwm/das2go/utils"
 	"github.com/prometheus/procfs"
 	"github.com/shirou/gopsutil/cpu"
@@ -53,8 +54,8 @@ type DASKeys struct {
 // helper function to build system-apis mapping
 func apisrows() [][]string {
 	var out [][]string
-	sdict := _dasmaps.SystemApis()
-	for _, srv := range _dasmaps.Services() {
+	sdict := currentMaps().SystemApis()
+	for _, srv := range currentMaps().Services() {
 		if v, ok := sdict[srv]; ok {
 			out = append(out, v)
 		}
@@ -67,7 +68,7 @@ func keysrows() [][]string {
 	var out [][]string
 	var value string
 	var records []DASKeys
-	for _, rec := range _dasmaps.Maps() {
+	for _, rec := range currentMaps().Maps() {
 		rtype := rec["type"]
 		if val, ok := rtype.(string); ok {
 			value = val
@@ -85,10 +86,10 @@ func keysrows() [][]string {
 			}
 		}
 	}
-	for _, key := range _dasmaps.DASKeys() {
+	for _, key := range currentMaps().DASKeys() {
 		var row []string
 		row = append(row, key)
-		for _, srv := range _dasmaps.Services() {
+		for _, srv := range currentMaps().Services() {
 			var entries []string
 			for _, rec := range records {
 				if key == rec.DKey {
@@ -116,7 +117,7 @@ func examples() []string {
 		arr := strings.Split(fname, "_")
 		msg := fmt.Sprintf("%s queries:", arr[0])
 		out = append(out, strings.ToTitle(msg))
-		for _, v := range strings.Split(utils.LoadExamples(fname, config.Config.DasExamples), "\n") {
+		for _, v := range strings.Split(utils.LoadExamples(fname, config.Current().DasExamples), "\n") {
 			e := fmt.Sprintf("%s", v)
 			out = append(out, e)
 		}
@@ -125,26 +126,48 @@ func examples() []string {
 }
 
 // helper function to form DAS error used in web Handlers
-func dasError(query, msg, posLine string) string {
+func dasError(query, msg, posLine string, suggestions dasmaps.Suggestions) string {
 	tmplData := make(map[string]interface{})
 	tmplData["Error"] = msg
 	tmplData["Query"] = query
 	tmplData["PositionLine"] = posLine
+	tmplData["Suggestions"] = suggestions
+	tmplData["Base"] = config.Current().Base
 	var templates DASTemplates
-	page := templates.DASError(config.Config.Templates, tmplData)
-	return _top + _search + _hiddenCards + page + _bottom
+	page := templates.DASError(config.Current().Templates, tmplData)
+	return currentPages().top + currentPages().search + currentPages().hiddenCards + page + currentPages().bottom
 }
 
 // helper function to form no results response
-func dasZero(base string) string {
+func dasZero(base string, suggestions dasmaps.Suggestions) string {
 	tmplData := make(map[string]interface{})
 	tmplData["Base"] = base
+	tmplData["Suggestions"] = suggestions
 	var templates DASTemplates
-	page := templates.DASZeroResults(config.Config.Templates, tmplData)
+	page := templates.DASZeroResults(config.Current().Templates, tmplData)
 	return page
 }
 
-func processRequest(dasquery dasql.DASQuery, pid string, idx, limit int) map[string]interface{} {
+// helper function to re-fetch given DAS query synchronously, existing records
+// of the query are served to other clients until fresh ones are ready
+func refreshQuery(dasquery dasql.DASQuery) {
+	pid := dasquery.Qhash
+	das.RemoveExpired(pid)
+	if das.CheckDataReadiness(pid) {
+		if !das.Refresh(dasquery, *currentMaps()) {
+			// query is refreshing by another request, wait for it
+			for das.Refreshing(pid) {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	} else if !das.CheckData(pid) && !das.Refreshing(pid) {
+		das.Process(dasquery, *currentMaps())
+	}
+}
+
+// helper function to process DAS query request, stale records of given age
+// (in seconds) are served while the query is refreshed
+func processRequest(dasquery dasql.DASQuery, pid, cursor string, idx, limit int, stale bool, age int64) map[string]interface{} {
 	// defer function will propagate error message to higher level
 	defer utils.ErrPropagate("processRequest")
 
@@ -152,30 +175,55 @@ func processRequest(dasquery dasql.DASQuery, pid string, idx, limit int) map[str
 	defer utils.MeasureTime("web/handlers/processRequest")()
 
 	response := make(map[string]interface{})
-	if das.CheckDataReadiness(pid) { // data exists in cache and ready for retrieval
-		status, data := das.GetData(dasquery, "merge", idx, limit)
+	response["idx"] = idx
+	if das.CheckDataReadiness(pid) || stale { // data exists in cache and ready for retrieval
+		var status string
+		var data []mongo.DASRecord
+		var page das.Page
+		if cursor != "" {
+			status, data, page = das.GetDataCursor(dasquery, "merge", cursor, limit)
+		} else {
+			status, data = das.GetData(dasquery, "merge", idx, limit)
+			page = das.PageCursors(dasquery, data, idx, limit)
+		}
 		ts := das.TimeStamp(dasquery)
 		procTime := time.Now().Sub(time.Unix(ts, 0))
 		nrec := das.Count(pid)
 		size := das.Bytes(pid)
 		response["bytes"] = size
 		response["nresults"] = nrec
-		response["timestamp"] = das.GetTimestamp(pid)
+		timestamp := das.GetTimestamp(pid)
+		response["timestamp"] = timestamp
 		response["status"] = status
 		response["pid"] = pid
 		response["data"] = data
 		response["procTime"] = procTime
+		if report := das.GetReport(pid); report.State != "" {
+			response["state"] = report.State
+			response["services"] = report.Services
+		}
+		if stale {
+			if strings.HasPrefix(status, "ERROR") {
+				// stale records were just replaced by refreshed ones
+				response = map[string]interface{}{"status": "processing", "pid": pid, "idx": idx, "limit": limit}
+				return response
+			}
+			response["stale"] = true
+			response["age"] = age
+		}
+		response["idx"] = page.Index
+		response["next"] = page.Next
+		response["prev"] = page.Prev
 		log.Printf("%v pid=%v status=%v nrecords=%d idx=%v limit=%v bytes=%v processing_time=%v\n", dasquery, pid, status, nrec, idx, limit, size, procTime)
-	} else if das.CheckData(pid) { // data exists in cache but still processing
+	} else if das.CheckData(pid) || das.Refreshing(pid) { // data exists in cache but still processing
 		response["status"] = "processing"
 		response["pid"] = pid
 	} else { // no data in cache (even client supplied the pid), process it
 		log.Printf("%v pid=%v\n", dasquery, pid)
-		go das.Process(dasquery, _dasmaps)
+		go das.Process(dasquery, *currentMaps())
 		response["status"] = "requested"
 		response["pid"] = pid
 	}
-	response["idx"] = idx
 	response["limit"] = limit
 	return response
 }
@@ -219,7 +267,7 @@ func auth(r *http.Request) bool {
 func AuthHandler(w http.ResponseWriter, r *http.Request) {
 	/*
 		// check if server started with hkey file (auth is required)
-		if config.Config.Hkey != "" {
+		if config.Current().Hkey != "" {
 			status := _cmsAuth.CheckAuthnAuthz(r.Header)
 			if !status {
 				msg := "You are not allowed to access this resource"
@@ -260,6 +308,22 @@ func AuthHandler(w http.ResponseWriter, r *http.Request) {
 		SettingsHandler(w, r)
 	case "services":
 		ServicesHandler(w, r)
+	case "explain":
+		ExplainHandler(w, r)
+	case "reload":
+		ReloadHandler(w, r)
+	case "consistency":
+		ConsistencyHandler(w, r)
+	case "lineage":
+		LineageHandler(w, r)
+	case "bulk":
+		BulkHandler(w, r)
+	case "cache":
+		if strings.HasSuffix(r.URL.Path, "/admin/cache") {
+			CacheHandler(w, r)
+		} else {
+			RequestHandler(w, r)
+		}
 	default:
 		RequestHandler(w, r)
 	}
@@ -275,9 +339,9 @@ func CliHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	var templates DASTemplates
 	tmplData := make(map[string]interface{})
-	page := templates.CLI(config.Config.Templates, tmplData)
+	page := templates.CLI(config.Current().Templates, tmplData)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(_top + page + _bottom))
+	w.Write([]byte(currentPages().top + page + currentPages().bottom))
 }
 
 // FAQHandler handlers FAQ requests
@@ -290,11 +354,11 @@ func FAQHandler(w http.ResponseWriter, r *http.Request) {
 	tmplData := make(map[string]interface{})
 	tmplData["Operators"] = []string{"=", "between", "last", "in"}
 	tmplData["Daskeys"] = []string{}
-	tmplData["Aggregators"] = []string{}
-	tmplData["Base"] = config.Config.Base
-	page := templates.FAQ(config.Config.Templates, tmplData)
+	tmplData["Aggregators"] = utils.AggregatorNames()
+	tmplData["Base"] = config.Current().Base
+	page := templates.FAQ(config.Current().Templates, tmplData)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(_top + page + _bottom))
+	w.Write([]byte(currentPages().top + page + currentPages().bottom))
 }
 
 // KeysHandler handlers Keys requests
@@ -305,11 +369,11 @@ func KeysHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	var templates DASTemplates
 	tmplData := make(map[string]interface{})
-	tmplData["Keys"] = _dasmaps.DASKeys()
+	tmplData["Keys"] = currentMaps().DASKeys()
 	tmplData["Examples"] = examples()
-	page := templates.Keys(config.Config.Templates, tmplData)
+	page := templates.Keys(config.Current().Templates, tmplData)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(_top + page + _bottom))
+	w.Write([]byte(currentPages().top + page + currentPages().bottom))
 }
 
 // ApisHandler handlers Apis requests
@@ -322,10 +386,19 @@ func ApisHandler(w http.ResponseWriter, r *http.Request) {
 	api := r.FormValue("api")
 	var templates DASTemplates
 	tmplData := make(map[string]interface{})
-	tmplData["Record"] = _dasmaps.FindApiRecord(system, api).ToHtml()
-	page := templates.ApiRecord(config.Config.Templates, tmplData)
+	if system == "" && api == "" {
+		// list all registered local APIs
+		tmplData["Base"] = config.Current().Base
+		tmplData["LocalAPIs"] = services.LocalAPIList()
+		page := templates.LocalAPIs(config.Current().Templates, tmplData)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(currentPages().top + page + currentPages().bottom))
+		return
+	}
+	tmplData["Record"] = currentMaps().FindApiRecord(system, api).ToHtml()
+	page := templates.ApiRecord(config.Current().Templates, tmplData)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(_top + page + _bottom))
+	w.Write([]byte(currentPages().top + page + currentPages().bottom))
 }
 
 // Memory structure keeps track of server memory
@@ -384,7 +457,7 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 	queries := das.ProcessingQueries()
 	tmplData["Queries"] = strings.Join(queries, "\n")
 	tmplData["NQueries"] = len(queries)
-	tmplData["Base"] = config.Config.Base
+	tmplData["Base"] = config.Current().Base
 	tmplData["NGo"] = runtime.NumGoroutine()
 	virt := Memory{Total: m.Total, Free: m.Free, Used: m.Used, UsedPercent: m.UsedPercent}
 	swap := Memory{Total: s.Total, Free: s.Free, Used: s.Used, UsedPercent: s.UsedPercent}
@@ -429,9 +502,10 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 	tmplData["Uptime"] = time.Since(Time0).Seconds()
 	tmplData["getRequests"] = TotalGetRequests
 	tmplData["postRequests"] = TotalPostRequests
+	tmplData["Reload"] = reloadStatus()
 	tmplData["getCalls"] = utils.TotalGetCalls
 	tmplData["postCalls"] = utils.TotalPostCalls
-	page := templates.Status(config.Config.Templates, tmplData)
+	page := templates.Status(config.Current().Templates, tmplData)
 	if strings.Contains(accept, "json") || strings.Contains(content, "json") {
 		data, err := json.Marshal(tmplData)
 		if err != nil {
@@ -443,7 +517,7 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(_top + page + _bottom))
+	w.Write([]byte(currentPages().top + page + currentPages().bottom))
 }
 
 // ServicesHandler handlers Services requests
@@ -454,19 +528,199 @@ func ServicesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	var templates DASTemplates
 	tmplData := make(map[string]interface{})
-	tmplData["DBSList"] = config.Config.DbsInstances
-	tmplData["Systems"] = _dasmaps.Services()
-	tmplData["Base"] = config.Config.Base
+	tmplData["DBSList"] = config.Current().DbsInstances
+	tmplData["Systems"] = currentMaps().Services()
+	tmplData["Base"] = config.Current().Base
 	tmplData["Rows"] = keysrows()
 	tmplData["Apis"] = apisrows()
-	tmplData["Frontend"] = config.Config.Frontend
-	page := templates.Services(config.Config.Templates, tmplData)
+	tmplData["Frontend"] = config.Current().Frontend
+	page := templates.Services(config.Current().Templates, tmplData)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(currentPages().top + page + currentPages().bottom))
+}
+
+// ExplainHandler handlers Explain requests, it reports how given DAS query
+// would be processed without contacting any data-service
+func ExplainHandler(w http.ResponseWriter, r *http.Request) {
+	// use the same DAS maps during the whole request even if they are reloaded
+	dmaps := currentMaps()
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// check HTTP header
+	var accept string
+	if _, ok := r.Header["Accept"]; ok {
+		accept = r.Header["Accept"][0]
+	}
+	query := r.FormValue("input")
+	inst := r.FormValue("instance")
+	if inst == "" {
+		inst = dmaps.DBSInstance()
+		if inst == "" && len(config.Current().DbsInstances) > 0 { // case of dbs2go
+			inst = config.Current().DbsInstances[0]
+		}
+	}
+	dasquery, err, _ := dasql.Parse(query, inst, dmaps.DASKeys())
+	log.Printf("explain input=\"%s\" %s", query, dasquery)
+	var explain das.Explanation
+	if err == "" {
+		explain = das.Explain(dasquery, *dmaps)
+	} else {
+		explain.DASQuery = dasquery
+		explain.DASQuery.Error = err
+	}
+	if strings.Contains(accept, "json") || r.FormValue("format") == "json" {
+		data, err := json.Marshal(explain)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+	var templates DASTemplates
+	tmplData := make(map[string]interface{})
+	tmplData["Query"] = query
+	tmplData["Error"] = err
+	tmplData["DASQuery"] = dasquery.String()
+	tmplData["Maps"] = explain.Maps
+	tmplData["Pkeys"] = explain.Pkeys
+	tmplData["Urls"] = explain.Urls
+	tmplData["LocalApis"] = explain.LocalApis
+	page := templates.Explain(config.Current().Templates, tmplData)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(currentPages().top + currentPages().search + currentPages().hiddenCards + page + currentPages().bottom))
+}
+
+// ConsistencyHandler provides downloadable DBS and Rucio consistency report
+// for given dataset or block, e.g. /das/consistency?dataset=/a/b/c&format=csv
+func ConsistencyHandler(w http.ResponseWriter, r *http.Request) {
+	dmaps := currentMaps()
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var query string
+	if blk := r.FormValue("block"); blk != "" {
+		query = fmt.Sprintf("consistency block=%s", blk)
+	} else if dataset := r.FormValue("dataset"); dataset != "" {
+		query = fmt.Sprintf("consistency dataset=%s", dataset)
+	} else {
+		http.Error(w, "Please provide either dataset or block parameter", http.StatusBadRequest)
+		return
+	}
+	inst := r.FormValue("instance")
+	if inst == "" {
+		inst = dmaps.DBSInstance()
+		if inst == "" && len(config.Current().DbsInstances) > 0 { // case of dbs2go
+			inst = config.Current().DbsInstances[0]
+		}
+	}
+	dasquery, err, _ := dasql.Parse(query, inst, dmaps.DASKeys())
+	if err != "" {
+		http.Error(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("consistency report %s", dasquery)
+	records := services.ConsistencyReport(dasquery)
+	if r.FormValue("format") == "json" {
+		data, err := json.Marshal(records)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=consistency.json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=consistency.csv")
+	w.WriteHeader(http.StatusOK)
+	writeConsistencyCSV(w, records)
+}
+
+// LineageHandler provides lineage graph of given dataset or file as expandable
+// tree, JSON or DOT, e.g. /das/lineage?dataset=/a/b/c&depth=3&format=dot
+func LineageHandler(w http.ResponseWriter, r *http.Request) {
+	dmaps := currentMaps()
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	dataset := r.FormValue("dataset")
+	lfn := r.FormValue("file")
+	var query string
+	if lfn != "" {
+		query = fmt.Sprintf("lineage file=%s", lfn)
+	} else if dataset != "" {
+		query = fmt.Sprintf("lineage dataset=%s", dataset)
+	} else {
+		http.Error(w, "Please provide either dataset or file parameter", http.StatusBadRequest)
+		return
+	}
+	if depth := r.FormValue("depth"); depth != "" {
+		query = fmt.Sprintf("%s depth=%s", query, depth)
+	}
+	inst := r.FormValue("instance")
+	if inst == "" {
+		inst = dmaps.DBSInstance()
+		if inst == "" && len(config.Current().DbsInstances) > 0 { // case of dbs2go
+			inst = config.Current().DbsInstances[0]
+		}
+	}
+	dasquery, err, _ := dasql.Parse(query, inst, dmaps.DASKeys())
+	if err != "" {
+		http.Error(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("lineage %s", dasquery)
+	var graph services.LineageGraph
+	if lfn != "" {
+		graph = services.FileLineage(dasquery)
+	} else {
+		graph = services.DatasetLineage(dasquery)
+	}
+	switch r.FormValue("format") {
+	case "json":
+		data, err := json.Marshal(graph)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Header().Set("Content-Disposition", "attachment; filename=lineage.dot")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(graph.Dot()))
+		return
+	}
+	ancestors, descendants := graph.Trees()
+	var templates DASTemplates
+	tmplData := make(map[string]interface{})
+	tmplData["Base"] = r.URL.Path
+	tmplData["Kind"] = graph.Kind
+	tmplData["Root"] = graph.Root
+	tmplData["Depth"] = graph.Depth
+	tmplData["Ancestors"] = ancestors
+	tmplData["Descendants"] = descendants
+	page := templates.Lineage(config.Current().Templates, tmplData)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(_top + page + _bottom))
+	w.Write([]byte(currentPages().top + currentPages().search + currentPages().hiddenCards + page + currentPages().bottom))
 }
 
 // RequestHandler is used by web server to handle incoming requests
 func RequestHandler(w http.ResponseWriter, r *http.Request) {
+	// use the same DAS maps during the whole request even if they are reloaded
+	dmaps := currentMaps()
 
 	// defer function profiler
 	defer utils.MeasureTime("web/handlers/RequestHandler")()
@@ -491,18 +745,22 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 	view := template.HTMLEscapeString(r.FormValue("view"))
 	inst := template.HTMLEscapeString(r.FormValue("instance"))
 	if inst == "" {
-		inst = _dasmaps.DBSInstance()
-		if inst == "" && len(config.Config.DbsInstances) > 0 { // case of dbs2go
-			inst = config.Config.DbsInstances[0]
+		inst = dmaps.DBSInstance()
+		if inst == "" && len(config.Current().DbsInstances) > 0 { // case of dbs2go
+			inst = config.Current().DbsInstances[0]
 		}
 	}
 	if hash != "" {
-		dasquery, err, _ := dasql.Parse(query, inst, _dasmaps.DASKeys())
+		dasquery, err, _ := dasql.Parse(query, inst, dmaps.DASKeys())
 		log.Printf("input=\"%s\" %s", query, dasquery)
 		msg := fmt.Sprintf("%s spec=%v filters=%v aggregators=%v err=%s", dasquery, dasquery.Spec, dasquery.Filters, dasquery.Aggregators, err)
 		w.Write([]byte(msg))
 		return
 	}
+	if r.FormValue("explain") != "" {
+		ExplainHandler(w, r)
+		return
+	}
 	limit, err := strconv.Atoi(r.FormValue("limit"))
 	if err != nil {
 		limit = 50
@@ -514,13 +772,14 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		idx = 0
 	}
+	cursor := template.HTMLEscapeString(r.FormValue("cursor"))
 	path := r.URL.Path
 	tmplData := make(map[string]interface{})
 
 	// process requests based on the path
-	base := config.Config.Base
+	base := config.Current().Base
 	if path == base || path == base+"/" {
-		w.Write([]byte(_top + _search + _cards + _bottom))
+		w.Write([]byte(currentPages().top + currentPages().search + currentPages().cards + currentPages().bottom))
 		return
 	}
 	// defer function will be fired when following processRequest will exit with error
@@ -534,8 +793,8 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 				response["Reason"] = err
 				response["PID"] = pid
 				var templates DASTemplates
-				msg := templates.DASRequest(config.Config.Templates, response)
-				//                 w.Write([]byte(_top + _search + _hiddenCards + msg + _bottom))
+				msg := templates.DASRequest(config.Current().Templates, response)
+				//                 w.Write([]byte(currentPages().top + currentPages().search + currentPages().hiddenCards + msg + currentPages().bottom))
 				w.Write([]byte(msg))
 				return
 			}
@@ -551,10 +810,26 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 			w.Write(js)
 		}
 	}()
-	dasquery, err2, pLine := dasql.Parse(query, inst, _dasmaps.DASKeys())
+	dasquery, err2, pLine := dasql.Parse(query, inst, dmaps.DASKeys())
 	log.Printf("input=\"%s\" %s", query, dasquery)
 	if err2 != "" {
-		w.Write([]byte(dasError(query, err2, pLine)))
+		suggestions := dmaps.Suggest(dasquery)
+		if strings.Contains(strings.ToLower(r.Header.Get("Accept")), "json") {
+			response := make(map[string]interface{})
+			response["status"] = "fail"
+			response["reason"] = err2
+			response["suggestions"] = suggestions
+			js, err := json.Marshal(&response)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(js)
+			return
+		}
+		w.Write([]byte(dasError(query, err2, pLine, suggestions)))
 		return
 	}
 	if pid == "" {
@@ -565,11 +840,22 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "DAS query pid is not valid", http.StatusInternalServerError)
 		return
 	}
-	// Remove expire records from cache
-	//         das.RemoveExpired(dasquery.Qhash)
-	das.RemoveExpired(pid)
+	// Remove expire records from cache, expired records can be served while
+	// query is refreshed in background, while refresh flag forces re-fetch
+	var stale bool
+	var age int64
+	if r.FormValue("refresh") != "" || r.FormValue("nocache") != "" {
+		refreshQuery(dasquery)
+	} else if age, stale = das.StaleData(pid, int64(config.Current().StaleMaxAge)); stale {
+		if !das.Refreshing(pid) {
+			go das.Refresh(dasquery, *currentMaps())
+		}
+	} else {
+		das.RemoveExpired(pid)
+	}
 	// process given query
-	response := processRequest(dasquery, pid, idx, limit)
+	recordQuery(dasquery)
+	response := processRequest(dasquery, pid, cursor, idx, limit, stale, age)
 	if path == base+"/cache" || path == base+"/cache/" {
 		//         status := response["status"]
 		//         if status != "ok" {
@@ -586,6 +872,17 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 		msg := "DAS web server no longer support python clients, please switch to dasgoclient"
 		http.Error(w, msg, http.StatusInternalServerError)
 	} else if path == base+"/request" || path == base+"/request/" {
+		if strings.Contains(strings.ToLower(r.Header.Get("Accept")), "json") {
+			// JSON clients page through results using next/prev cursors
+			js, err := json.Marshal(&response)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(js)
+			return
+		}
 		status := response["status"]
 		var procTime time.Duration
 		if response["procTime"] != nil {
@@ -599,21 +896,31 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 				w.Write([]byte(page))
 				return
 			}
+			if state, ok := response["state"].(string); ok {
+				page = stateSummary(state, response["services"].([]das.ServiceStatus))
+			}
 			nres := response["nresults"].(int)
 			if nres == 0 {
-				page = dasZero(config.Config.Base)
+				var suggestions dasmaps.Suggestions
+				if len(dmaps.FindServices(dasquery)) == 0 {
+					suggestions = dmaps.Suggest(dasquery)
+				}
+				page += dasZero(config.Current().Base, suggestions)
 			} else {
-				presentationMap := _dasmaps.PresentationMap()
-				page = PresentData(path, dasquery, data, presentationMap, nres, idx, limit, procTime)
+				presentationMap := dmaps.PresentationMap()
+				if response["stale"] != nil {
+					page += staleNotice(dasquery, response["age"].(int64))
+				}
+				page += PresentData(path, dasquery, data, presentationMap, nres, das.Page{Index: response["idx"].(int), Next: response["next"].(string), Prev: response["prev"].(string)}, limit, procTime)
 			}
 		} else {
-			tmplData["Base"] = config.Config.Base
+			tmplData["Base"] = config.Current().Base
 			tmplData["PID"] = pid
-			page = parseTmpl(config.Config.Templates, "check_pid.tmpl", tmplData)
-			page += fmt.Sprintf("<script>setTimeout('ajaxCheckPid(\"%s\", \"request\", \"%s\", \"%s\", \"%s\", \"%s\", \"%d\")', %d)</script>", config.Config.Base, query, inst, pid, view, 2500, 2500)
+			page = parseTmpl(config.Current().Templates, "check_pid.tmpl", tmplData)
+			page += fmt.Sprintf("<script>setTimeout('ajaxCheckPid(\"%s\", \"request\", \"%s\", \"%s\", \"%s\", \"%s\", \"%d\")', %d)</script>", config.Current().Base, query, inst, pid, view, 2500, 2500)
 		}
 		if ajax == "" {
-			w.Write([]byte(_top + _search + _hiddenCards + page + _bottom))
+			w.Write([]byte(currentPages().top + currentPages().search + currentPages().hiddenCards + page + currentPages().bottom))
 		} else {
 			w.Write([]byte(page))
 		}
@@ -0,0 +1,251 @@
+package web
+
+// das2go - DAS web server
+// reload module, it reloads DAS maps, templates and configuration of
+// running server either upon SIGHUP signal or via admin API
+//
+// Copyright (c) 2015-2016 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+//
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/dmwm/das2go/config"
+	"github.com/dmwm/das2go/dasmaps"
+	"github.com/dmwm/das2go/services"
+	"github.com/dmwm/das2go/utils"
+)
+
+// pageTemplates holds pre-rendered parts of DAS web pages
+type pageTemplates struct {
+	top, bottom, search, cards, hiddenCards string
+}
+
+// ReloadStatus represents outcome of the last reload of DAS server
+type ReloadStatus struct {
+	Time     time.Time `json:"time"`              // time of the reload
+	Trigger  string    `json:"trigger"`           // what triggered reload: startup, SIGHUP or admin DN
+	Status   string    `json:"status"`            // ok or failed
+	Error    string    `json:"error,omitempty"`   // reason of failed reload
+	Warnings []string  `json:"warnings"`          // warnings found during validation
+	Restart  []string  `json:"restart,omitempty"` // changed config keys which require restart
+	Services []string  `json:"services"`          // DAS services in use
+	Reloads  int       `json:"reloads"`           // number of successful reloads
+}
+
+// current DAS maps and pages, they are replaced atomically upon reload
+var _dasmaps atomic.Pointer[dasmaps.DASMaps]
+var _pages atomic.Pointer[pageTemplates]
+
+// lock which serializes reloads and protects reload status
+var _reloadLock sync.Mutex
+var _reloadStatus ReloadStatus
+
+// DAS server configuration file used by reload
+var _configFile string
+
+// helper function to get current DAS maps
+func currentMaps() *dasmaps.DASMaps {
+	if dmaps := _dasmaps.Load(); dmaps != nil {
+		return dmaps
+	}
+	return &dasmaps.DASMaps{}
+}
+
+// helper function to get current pages
+func currentPages() *pageTemplates {
+	if pages := _pages.Load(); pages != nil {
+		return pages
+	}
+	return &pageTemplates{}
+}
+
+// helper function to get status of the last reload
+func reloadStatus() ReloadStatus {
+	_reloadLock.Lock()
+	defer _reloadLock.Unlock()
+	return _reloadStatus
+}
+
+// helper function to load and validate DAS maps for given configuration
+func loadMaps(cfg config.Configuration) (*dasmaps.DASMaps, []string, error) {
+	var dmaps dasmaps.DASMaps
+	dmaps.LoadMaps("mapping", "db")
+	if len(cfg.Services) > 0 {
+		dmaps.AssignServices(cfg.Services)
+	}
+	if len(dmaps.Services()) == 0 {
+		return nil, nil, errors.New("no DAS maps found")
+	}
+	if len(cfg.DbsInstances) == 0 {
+		return nil, nil, errors.New("no DBS instances found in configuration")
+	}
+	warnings := services.ValidateLocalAPIs(dmaps)
+	if dmaps.FindApiRecord("dbs3", "datasets") == nil {
+		warnings = append(warnings, "DAS maps do not contain dbs3 datasets map")
+	}
+	return &dmaps, warnings, nil
+}
+
+// helper function to render DAS pages from given templates and configuration
+func renderPages(tmap map[string]*template.Template, cfg config.Configuration, dmaps *dasmaps.DASMaps) (*pageTemplates, error) {
+	daskeys, err := execTmpl(tmap, "das_keys.tmpl", map[string]interface{}{"daskeys": dmaps.DASKeysMaps()})
+	if err != nil {
+		return nil, err
+	}
+	tmplData := make(map[string]interface{})
+	tmplData["Base"] = cfg.Base
+	tmplData["Time"] = time.Now()
+	tmplData["Input"] = ""
+	tmplData["DBSinstance"] = cfg.DbsInstances[0]
+	tmplData["Views"] = []string{"list", "plain"}
+	tmplData["DBSes"] = cfg.DbsInstances
+	tmplData["CardClass"] = "show"
+	tmplData["CardsClass"] = "hide"
+	tmplData["Version"] = utils.VERSION
+	tmplData["Daskeys"] = template.HTML(daskeys)
+	pages := &pageTemplates{}
+	if pages.top, err = execTmpl(tmap, "top.tmpl", tmplData); err != nil {
+		return nil, err
+	}
+	if pages.bottom, err = execTmpl(tmap, "bottom.tmpl", tmplData); err != nil {
+		return nil, err
+	}
+	if pages.search, err = execTmpl(tmap, "searchform.tmpl", tmplData); err != nil {
+		return nil, err
+	}
+	if pages.cards, err = execTmpl(tmap, "cards.tmpl", tmplData); err != nil {
+		return nil, err
+	}
+	tmplData["CardClass"] = "hide"
+	if pages.hiddenCards, err = execTmpl(tmap, "cards.tmpl", tmplData); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// helper function to propagate configuration to DAS modules
+func applyConfig(dmaps *dasmaps.DASMaps) {
+	utils.VERBOSE = config.Current().Verbose
+	utils.UrlQueueLimit = config.Current().UrlQueueLimit
+	utils.UrlRetry = config.Current().UrlRetry
+	utils.DASMAPS = config.Current().DasMaps
+	utils.TIMEOUT = config.Current().Timeout
+	services.FrontendURL = config.Current().Frontend
+	services.RucioURL = config.Current().RucioUrl
+	// set default urls for our services
+	urlMap := make(map[string]string)
+	for _, srv := range dmaps.Services() {
+		urlMap[srv] = dmaps.GetUrl(srv)
+	}
+	services.UrlMap = urlMap
+}
+
+// Reload reloads DAS configuration, DAS maps, presentation and templates.
+// New settings are validated first and put in place only if all of them are
+// valid, otherwise server keeps using its current settings.
+func Reload(trigger string) ReloadStatus {
+	_reloadLock.Lock()
+	defer _reloadLock.Unlock()
+	status := ReloadStatus{Time: time.Now(), Trigger: trigger, Status: "failed", Reloads: _reloadStatus.Reloads}
+	fail := func(err error) ReloadStatus {
+		status.Error = err.Error()
+		log.Printf("ERROR: reload triggered by %s failed, error %v\n", trigger, err)
+		_reloadStatus = status
+		return status
+	}
+
+	// validate new settings
+	newConfig, err := config.ReadConfig(_configFile)
+	if err != nil {
+		return fail(err)
+	}
+	oldConfig := *config.Current()
+	cfg := config.Reload(oldConfig, newConfig)
+	status.Restart = config.RestartKeys(oldConfig, newConfig)
+	tmap, err := loadTemplates(cfg.Templates)
+	if err != nil {
+		return fail(err)
+	}
+	dmaps, warnings, err := loadMaps(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	status.Warnings = warnings
+
+	pages, err := renderPages(tmap, cfg, dmaps)
+	if err != nil {
+		return fail(err)
+	}
+
+	// put new settings in place
+	_templatesLock.Lock()
+	DASTemplateMap = tmap
+	_templatesLock.Unlock()
+	config.Publish(cfg)
+	_dasmaps.Store(dmaps)
+	_pages.Store(pages)
+	applyConfig(dmaps)
+
+	status.Status = "ok"
+	status.Services = dmaps.Services()
+	if trigger != "startup" {
+		status.Reloads++
+	}
+	for _, key := range status.Restart {
+		log.Printf("WARNING: change of %s requires server restart\n", key)
+	}
+	for _, msg := range warnings {
+		log.Println("WARNING:", msg)
+	}
+	log.Printf("reload triggered by %s, DAS services %v\n", trigger, status.Services)
+	_reloadStatus = status
+	return status
+}
+
+// helper function to reload DAS server upon SIGHUP signal
+func reloadOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			Reload("SIGHUP")
+		}
+	}()
+}
+
+// ReloadHandler reloads DAS server settings, it is only allowed for admin DNs
+func ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userDN, ok := adminRequest(w, r, "reload DAS server")
+	if !ok {
+		return
+	}
+	status := Reload(userDN)
+	data, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to marshal data, error=%v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status != "ok" {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.Write(data)
+}
@@ -15,7 +15,6 @@ package web
 import (
 	"crypto/tls"
 	"fmt"
-	"html/template"
 	"log"
 	"net/http"
 	"net/url"
@@ -37,8 +36,6 @@ import (
 
 // Config describes DAS server configuration
 // global variables used in this module
-var _dasmaps dasmaps.DASMaps
-var _top, _bottom, _search, _cards, _hiddenCards string
 var _cmsAuth cmsauth.CMSAuth
 var _auth bool
 
@@ -78,11 +75,11 @@ func userDNs() []string {
 }
 
 // helper function to get DAS keys description
-func daskeysDescription() string {
+func daskeysDescription(dmaps *dasmaps.DASMaps) string {
 	tmplData := make(map[string]interface{})
-	tmplData["daskeys"] = _dasmaps.DASKeysMaps()
+	tmplData["daskeys"] = dmaps.DASKeysMaps()
 	var templates DASTemplates
-	desc := templates.DasKeys(config.Config.Templates, tmplData)
+	desc := templates.DasKeys(config.Current().Templates, tmplData)
 	return desc
 }
 
@@ -108,12 +105,13 @@ func (w rotateLogWriter) Write(data []byte) (int, error) {
 
 // Server is proxy server. It defines /fetch public interface
 func Server(configFile string) {
+	_configFile = configFile
 	err := config.ParseConfig(configFile)
-	if config.Config.LogFile != "" {
-		logName := config.Config.LogFile + "-%Y%m%d"
+	if config.Current().LogFile != "" {
+		logName := config.Current().LogFile + "-%Y%m%d"
 		hostname, err := os.Hostname()
 		if err == nil {
-			logName = config.Config.LogFile + "-" + hostname + "-%Y%m%d"
+			logName = config.Current().LogFile + "-" + hostname + "-%Y%m%d"
 		}
 		rl, err := rotatelogs.New(logName)
 		if err == nil {
@@ -131,17 +129,17 @@ func Server(configFile string) {
 		log.Println("ERROR: unable to parse config file", configFile)
 	}
 
-	utils.VERBOSE = config.Config.Verbose
-	utils.UrlQueueLimit = config.Config.UrlQueueLimit
-	utils.UrlRetry = config.Config.UrlRetry
-	utils.DASMAPS = config.Config.DasMaps
-	utils.TIMEOUT = config.Config.Timeout
-	services.FrontendURL = config.Config.Frontend
-	services.RucioURL = config.Config.RucioUrl
-	interval := time.Duration(config.Config.TLSCertsRenewInterval)
+	utils.VERBOSE = config.Current().Verbose
+	utils.UrlQueueLimit = config.Current().UrlQueueLimit
+	utils.UrlRetry = config.Current().UrlRetry
+	utils.DASMAPS = config.Current().DasMaps
+	utils.TIMEOUT = config.Current().Timeout
+	services.FrontendURL = config.Current().Frontend
+	services.RucioURL = config.Current().RucioUrl
+	interval := time.Duration(config.Current().TLSCertsRenewInterval)
 	utils.TLSCertsRenewInterval = time.Duration(interval * time.Second)
-	utils.RucioTokenCurl = config.Config.RucioTokenCurl
-	log.Println(config.Config.String())
+	utils.RucioTokenCurl = config.Current().RucioTokenCurl
+	log.Println(config.Current().String())
 
 	// acquire rucio token
 	log.Println("rucio", utils.RucioAuth.String())
@@ -149,15 +147,15 @@ func Server(configFile string) {
 	log.Println("rucio token", token, terr)
 
 	// init CMS Authentication module
-	if config.Config.Hkey != "" {
-		_cmsAuth.Init(config.Config.Hkey)
+	if config.Current().Hkey != "" {
+		_cmsAuth.Init(config.Current().Hkey)
 	}
 	// enable function profiler
-	if config.Config.ProfileFile != "" {
-		utils.InitFunctionProfiler(config.Config.ProfileFile)
+	if config.Current().ProfileFile != "" {
+		utils.InitFunctionProfiler(config.Current().ProfileFile)
 	}
 	// enable DNS resolver
-	if config.Config.UseDNSCache {
+	if config.Current().UseDNSCache {
 		utils.UseDNSCache = true
 		log.Println("UseDNSCache", utils.UseDNSCache)
 	}
@@ -165,72 +163,47 @@ func Server(configFile string) {
 	// call utils init
 	utils.Init()
 
-	// load DAS Maps if necessary
-	if len(_dasmaps.Services()) == 0 {
-		log.Println("Load DAS maps")
-		_dasmaps.LoadMaps("mapping", "db")
-		if len(config.Config.Services) > 0 {
-			_dasmaps.AssignServices(config.Config.Services)
-		}
-		log.Println("DAS services ", _dasmaps.Services())
-		log.Println("DAS keys ", _dasmaps.DASKeys())
-	}
-	// set default urls for our services
-	services.UrlMap = make(map[string]string)
-	for _, srv := range _dasmaps.Services() {
-		services.UrlMap[srv] = _dasmaps.GetUrl(srv)
+	// load DAS Maps and templates, the same procedure is used upon reload
+	log.Println("Load DAS maps")
+	status := Reload("startup")
+	if status.Status != "ok" {
+		log.Fatalf("unable to initialize DAS server, error %s\n", status.Error)
 	}
+	log.Println("DAS services ", currentMaps().Services())
+	log.Println("DAS keys ", currentMaps().DASKeys())
 	log.Println("DAS url map", services.UrlMap)
+	reloadOnSignal()
 
 	// list URLs we're going to use
-	log.Println("DBSUrl: ", services.DBSUrl(config.Config.DbsInstances[0]))
+	log.Println("DBSUrl: ", services.DBSUrl(config.Current().DbsInstances[0]))
 	log.Println("PhedexUrl: ", services.PhedexUrl())
 	log.Println("SitedbUrl: ", services.SitedbUrl())
 	log.Println("CricUrl w/ site API: ", services.CricUrl("site"))
 	log.Println("RucioUrl: ", services.RucioUrl())
 	log.Println("RucioAuthUrl: ", utils.RucioAuth.Url())
-	log.Println("DBS instances", config.Config.DbsInstances)
-
-	// DAS templates
-	tmplData := make(map[string]interface{})
-	tmplData["Base"] = config.Config.Base
-	tmplData["Time"] = time.Now()
-	tmplData["Input"] = ""
-	tmplData["DBSinstance"] = config.Config.DbsInstances[0]
-	tmplData["Views"] = []string{"list", "plain"}
-	tmplData["DBSes"] = config.Config.DbsInstances
-	tmplData["CardClass"] = "show"
-	tmplData["Version"] = utils.VERSION
-	tmplData["Daskeys"] = template.HTML(daskeysDescription())
-	var templates DASTemplates
-	_top = templates.Top(config.Config.Templates, tmplData)
-	_bottom = templates.Bottom(config.Config.Templates, tmplData)
-	_search = templates.SearchForm(config.Config.Templates, tmplData)
-	_cards = templates.Cards(config.Config.Templates, tmplData)
-	tmplData["CardClass"] = "hide"
-	_hiddenCards = templates.Cards(config.Config.Templates, tmplData)
+	log.Println("DBS instances", config.Current().DbsInstances)
 
 	// create all required indexes in das.cache, das.merge collections
-	indexes := []string{"qhash", "das.expire", "das.record", "dataset.name", "file.name"}
+	indexes := []string{"qhash", "das.expire", "das.record", "das.access", "dataset.name", "file.name"}
 	mongo.CreateIndexes("das", "cache", indexes)
 	mongo.CreateIndexes("das", "merge", indexes)
 
 	// assign handlers
-	base := config.Config.Base
-	http.Handle(base+"/css/", http.StripPrefix(base+"/css/", http.FileServer(http.Dir(config.Config.Styles))))
-	http.Handle(base+"/js/", http.StripPrefix(base+"/js/", http.FileServer(http.Dir(config.Config.Jscripts))))
-	http.Handle(base+"/images/", http.StripPrefix(base+"/images/", http.FileServer(http.Dir(config.Config.Images))))
+	base := config.Current().Base
+	http.Handle(base+"/css/", http.StripPrefix(base+"/css/", http.FileServer(http.Dir(config.Current().Styles))))
+	http.Handle(base+"/js/", http.StripPrefix(base+"/js/", http.FileServer(http.Dir(config.Current().Jscripts))))
+	http.Handle(base+"/images/", http.StripPrefix(base+"/images/", http.FileServer(http.Dir(config.Current().Images))))
 	//     http.Handle(base+"/debug/pprof/", http.StripPrefix(base, http.RedirectHandler("/debug/pprof/", http.StatusTemporaryRedirect)))
-	http.HandleFunc(fmt.Sprintf("%s/", config.Config.Base), AuthHandler)
+	http.HandleFunc(fmt.Sprintf("%s/", config.Current().Base), AuthHandler)
 
 	// init userDNs and update it periodically
-	_auth = config.Config.AuthDN
+	_auth = config.Current().AuthDN
 	log.Println("enable user DN authentication", _auth)
 	if _auth {
 		_userDNs = UserDNs{DNs: userDNs(), Time: time.Now()}
 		go func() {
 			for {
-				interval := config.Config.UpdateDNs
+				interval := config.Current().UpdateDNs
 				if interval == 0 {
 					interval = 60
 				}
@@ -242,11 +215,15 @@ func Server(configFile string) {
 		}()
 	}
 
+	// start cache warming scheduler and DAS cache sweeper
+	go warmScheduler()
+	go sweepScheduler()
+
 	// start http(s) server
 	Time0 = time.Now()
-	addr := fmt.Sprintf(":%d", config.Config.Port)
-	_, e1 := os.Stat(config.Config.ServerCrt)
-	_, e2 := os.Stat(config.Config.ServerKey)
+	addr := fmt.Sprintf(":%d", config.Current().Port)
+	_, e1 := os.Stat(config.Current().ServerCrt)
+	_, e2 := os.Stat(config.Current().ServerKey)
 	if e1 == nil && e2 == nil {
 		//start HTTPS server which require user certificates
 		server := &http.Server{
@@ -256,7 +233,7 @@ func Server(configFile string) {
 			},
 		}
 		log.Println("starting HTTPs server", addr)
-		err = server.ListenAndServeTLS(config.Config.ServerCrt, config.Config.ServerKey)
+		err = server.ListenAndServeTLS(config.Current().ServerCrt, config.Current().ServerKey)
 	} else {
 		// Start server without user certificates
 		log.Println("starting HTTP server", addr)
@@ -2,9 +2,12 @@ package web
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
 	"log"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/dmwm/das2go/config"
 )
@@ -12,6 +15,24 @@ import (
 // global map of templates
 var DASTemplateMap map[string]*template.Template
 
+// lock which protects DASTemplateMap
+var _templatesLock sync.RWMutex
+
+// functions available in DAS templates
+var templateFuncs = template.FuncMap{
+	// The name "oddFunc" is what the function will be called in the template text.
+	"oddFunc": func(i int) bool {
+		if i%2 == 0 {
+			return true
+		}
+		return false
+	},
+	// format unix timestamp
+	"unixTime": func(ts int64) string {
+		return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+	},
+}
+
 // consume list of templates and release their full path counterparts
 func fileNames(tdir string, filenames ...string) []string {
 	flist := []string{}
@@ -21,36 +42,64 @@ func fileNames(tdir string, filenames ...string) []string {
 	return flist
 }
 
+// helper function to parse all templates from given area
+func loadTemplates(tdir string) (map[string]*template.Template, error) {
+	files, err := filepath.Glob(filepath.Join(tdir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates found in %s", tdir)
+	}
+	tmap := make(map[string]*template.Template)
+	for _, fname := range files {
+		tmpl := filepath.Base(fname)
+		t, err := template.New(tmpl).Funcs(templateFuncs).ParseFiles(fname)
+		if err != nil {
+			return nil, err
+		}
+		tmap[tmpl] = t
+	}
+	return tmap, nil
+}
+
 // parse template with given data
 func parseTmpl(tdir, tmpl string, data interface{}) string {
-	if DASTemplateMap == nil {
-		DASTemplateMap = make(map[string]*template.Template)
-	}
-	buf := new(bytes.Buffer)
-	var err error
-	if t, ok := DASTemplateMap[tmpl]; ok {
-		err = t.Execute(buf, data)
-	} else {
+	_templatesLock.RLock()
+	t, ok := DASTemplateMap[tmpl]
+	_templatesLock.RUnlock()
+	if !ok {
 		filenames := fileNames(tdir, tmpl)
-		funcMap := template.FuncMap{
-			// The name "oddFunc" is what the function will be called in the template text.
-			"oddFunc": func(i int) bool {
-				if i%2 == 0 {
-					return true
-				}
-				return false
-			},
+		t = template.Must(template.New(tmpl).Funcs(templateFuncs).ParseFiles(filenames...))
+		_templatesLock.Lock()
+		if DASTemplateMap == nil {
+			DASTemplateMap = make(map[string]*template.Template)
 		}
-		t := template.Must(template.New(tmpl).Funcs(funcMap).ParseFiles(filenames...))
 		DASTemplateMap[tmpl] = t
-		err = t.Execute(buf, data)
+		_templatesLock.Unlock()
 	}
+	buf := new(bytes.Buffer)
+	err := t.Execute(buf, data)
 	if err != nil {
 		log.Fatal("ERROR ", err)
 	}
 	return buf.String()
 }
 
+// helper function to execute template from given template map, unlike
+// parseTmpl it returns execution errors
+func execTmpl(tmap map[string]*template.Template, tmpl string, data interface{}) (string, error) {
+	t, ok := tmap[tmpl]
+	if !ok {
+		return "", fmt.Errorf("template %s is not found", tmpl)
+	}
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("unable to render template %s: %v", tmpl, err)
+	}
+	return buf.String(), nil
+}
+
 // DASTemplates structure
 type DASTemplates struct {
 	top, bottom, searchForm, cards, dasError, dasKeys, dasZero string
@@ -61,7 +110,7 @@ func (q DASTemplates) Top(tdir string, tmplData map[string]interface{}) string {
 	if q.top != "" {
 		return q.top
 	}
-	q.top = parseTmpl(config.Config.Templates, "top.tmpl", tmplData)
+	q.top = parseTmpl(config.Current().Templates, "top.tmpl", tmplData)
 	return q.top
 }
 
@@ -70,7 +119,7 @@ func (q DASTemplates) Bottom(tdir string, tmplData map[string]interface{}) strin
 	if q.bottom != "" {
 		return q.bottom
 	}
-	q.bottom = parseTmpl(config.Config.Templates, "bottom.tmpl", tmplData)
+	q.bottom = parseTmpl(config.Current().Templates, "bottom.tmpl", tmplData)
 	return q.bottom
 }
 
@@ -79,7 +128,7 @@ func (q DASTemplates) SearchForm(tdir string, tmplData map[string]interface{}) s
 	if q.searchForm != "" {
 		return q.searchForm
 	}
-	q.searchForm = parseTmpl(config.Config.Templates, "searchform.tmpl", tmplData)
+	q.searchForm = parseTmpl(config.Current().Templates, "searchform.tmpl", tmplData)
 	return q.searchForm
 }
 
@@ -89,7 +138,7 @@ func (q DASTemplates) Cards(tdir string, tmplData map[string]interface{}) string
 	if q.cards != "" {
 		return q.cards
 	}
-	q.cards = parseTmpl(config.Config.Templates, "cards.tmpl", tmplData)
+	q.cards = parseTmpl(config.Current().Templates, "cards.tmpl", tmplData)
 	return q.cards
 }
 
@@ -98,7 +147,7 @@ func (q DASTemplates) CLI(tdir string, tmplData map[string]interface{}) string {
 	if q.top != "" {
 		return q.top
 	}
-	q.top = parseTmpl(config.Config.Templates, "cli.tmpl", tmplData)
+	q.top = parseTmpl(config.Current().Templates, "cli.tmpl", tmplData)
 	return q.top
 }
 
@@ -107,7 +156,7 @@ func (q DASTemplates) FAQ(tdir string, tmplData map[string]interface{}) string {
 	if q.top != "" {
 		return q.top
 	}
-	q.top = parseTmpl(config.Config.Templates, "faq.tmpl", tmplData)
+	q.top = parseTmpl(config.Current().Templates, "faq.tmpl", tmplData)
 	return q.top
 }
 
@@ -116,7 +165,7 @@ func (q DASTemplates) ApiRecord(tdir string, tmplData map[string]interface{}) st
 	if q.top != "" {
 		return q.top
 	}
-	q.top = parseTmpl(config.Config.Templates, "api_record.tmpl", tmplData)
+	q.top = parseTmpl(config.Current().Templates, "api_record.tmpl", tmplData)
 	return q.top
 }
 
@@ -125,7 +174,7 @@ func (q DASTemplates) Keys(tdir string, tmplData map[string]interface{}) string
 	if q.top != "" {
 		return q.top
 	}
-	q.top = parseTmpl(config.Config.Templates, "keys.tmpl", tmplData)
+	q.top = parseTmpl(config.Current().Templates, "keys.tmpl", tmplData)
 	return q.top
 }
 
@@ -134,7 +183,7 @@ func (q DASTemplates) Services(tdir string, tmplData map[string]interface{}) str
 	if q.top != "" {
 		return q.top
 	}
-	q.top = parseTmpl(config.Config.Templates, "services.tmpl", tmplData)
+	q.top = parseTmpl(config.Current().Templates, "services.tmpl", tmplData)
 	return q.top
 }
 
@@ -143,7 +192,7 @@ func (q DASTemplates) Pagination(tdir string, tmplData map[string]interface{}) s
 	if q.searchForm != "" {
 		return q.searchForm
 	}
-	q.searchForm = parseTmpl(config.Config.Templates, "pagination.tmpl", tmplData)
+	q.searchForm = parseTmpl(config.Current().Templates, "pagination.tmpl", tmplData)
 	return q.searchForm
 }
 
@@ -152,7 +201,7 @@ func (q DASTemplates) DASRequest(tdir string, tmplData map[string]interface{}) s
 	if q.dasError != "" {
 		return q.dasError
 	}
-	q.dasError = parseTmpl(config.Config.Templates, "request.tmpl", tmplData)
+	q.dasError = parseTmpl(config.Current().Templates, "request.tmpl", tmplData)
 	return q.dasError
 }
 
@@ -161,7 +210,7 @@ func (q DASTemplates) DASError(tdir string, tmplData map[string]interface{}) str
 	if q.dasError != "" {
 		return q.dasError
 	}
-	q.dasError = parseTmpl(config.Config.Templates, "error.tmpl", tmplData)
+	q.dasError = parseTmpl(config.Current().Templates, "error.tmpl", tmplData)
 	return q.dasError
 }
 
@@ -170,7 +219,7 @@ func (q DASTemplates) DASZeroResults(tdir string, tmplData map[string]interface{
 	if q.dasZero != "" {
 		return q.dasZero
 	}
-	q.dasZero = parseTmpl(config.Config.Templates, "zero_results.tmpl", tmplData)
+	q.dasZero = parseTmpl(config.Current().Templates, "zero_results.tmpl", tmplData)
 	return q.dasZero
 }
 
@@ -179,7 +228,7 @@ func (q DASTemplates) Status(tdir string, tmplData map[string]interface{}) strin
 	if q.dasError != "" {
 		return q.dasError
 	}
-	q.dasError = parseTmpl(config.Config.Templates, "status.tmpl", tmplData)
+	q.dasError = parseTmpl(config.Current().Templates, "status.tmpl", tmplData)
 	return q.dasError
 }
 
@@ -188,6 +237,26 @@ func (q DASTemplates) DasKeys(tdir string, tmplData map[string]interface{}) stri
 	if q.dasKeys != "" {
 		return q.dasKeys
 	}
-	q.dasKeys = parseTmpl(config.Config.Templates, "das_keys.tmpl", tmplData)
+	q.dasKeys = parseTmpl(config.Current().Templates, "das_keys.tmpl", tmplData)
 	return q.dasKeys
 }
+
+// Explain method for DASTemplates structure
+func (q DASTemplates) Explain(tdir string, tmplData map[string]interface{}) string {
+	return parseTmpl(config.Current().Templates, "explain.tmpl", tmplData)
+}
+
+// Lineage method for DASTemplates structure
+func (q DASTemplates) Lineage(tdir string, tmplData map[string]interface{}) string {
+	return parseTmpl(config.Current().Templates, "lineage.tmpl", tmplData)
+}
+
+// LocalAPIs method for DASTemplates structure
+func (q DASTemplates) LocalAPIs(tdir string, tmplData map[string]interface{}) string {
+	return parseTmpl(config.Current().Templates, "local_apis.tmpl", tmplData)
+}
+
+// Cache method for DASTemplates structure
+func (q DASTemplates) Cache(tdir string, tmplData map[string]interface{}) string {
+	return parseTmpl(config.Current().Templates, "cache.tmpl", tmplData)
+}
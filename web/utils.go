@@ -2,8 +2,11 @@ package web
 
 import (
 	"crypto/md5"
+	"encoding/csv"
 	"encoding/hex"
 	"fmt"
+	"html"
+	"io"
 	"log"
 	"net/url"
 	"sort"
@@ -15,6 +18,7 @@ import (
 	"github.com/dmwm/das2go/das"
 	"github.com/dmwm/das2go/dasql"
 	"github.com/dmwm/das2go/mongo"
+	"github.com/dmwm/das2go/services"
 	"github.com/dmwm/das2go/utils"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -131,27 +135,95 @@ func colServices(services []string) string {
 	//     return "Sources: " + strings.Join(utils.MapKeys(out), "")
 }
 
-// helper function to create links
-func dasLinks(path, inst, val string, links []interface{}) string {
+// helper function to show DBS instance(s) record came from in fan-out queries
+func colInstances(instances string) string {
+	var out []string
+	for _, inst := range strings.Split(instances, ",") {
+		bkg, col := genColor(inst)
+		out = append(out, fmt.Sprintf("<span style=\"background-color:%s;color:%s;padding:2px\">%s</span>", bkg, col, inst))
+	}
+	return "Instance: " + strings.Join(out, "")
+}
+
+// helper function to show conflicts between services found by diff action
+// of merge step, it returns set of conflicting DAS keys and their description
+func colConflicts(dasrec mongo.DASRecord) (map[string]bool, string) {
+	keys := make(map[string]bool)
+	var conflicts []interface{}
+	switch v := dasrec["conflicts"].(type) {
+	case []interface{}:
+		conflicts = v
+	case []mongo.DASRecord:
+		for _, r := range v {
+			conflicts = append(conflicts, r)
+		}
+	}
+	var out []string
+	for _, item := range conflicts {
+		rec := mongo.Convert2DASRecord(item)
+		key, _ := rec["key"].(string)
+		keys[key] = true
+		var vals []string
+		switch values := rec["values"].(type) {
+		case []interface{}:
+			for _, v := range values {
+				r := mongo.Convert2DASRecord(v)
+				vals = append(vals, fmt.Sprintf("%v=%v", r["service"], r["value"]))
+			}
+		case []mongo.DASRecord:
+			for _, r := range values {
+				vals = append(vals, fmt.Sprintf("%v=%v", r["service"], r["value"]))
+			}
+		}
+		out = append(out, fmt.Sprintf("%s (%s)", key, strings.Join(vals, ", ")))
+	}
+	if len(out) == 0 {
+		return keys, ""
+	}
+	return keys, fmt.Sprintf("<br/>\n<b>Conflict:</b> <span style=\"color:red\">%s</span>", strings.Join(out, "; "))
+}
+
+// helper function to return values substituted into link of DAS record, it
+// is either given value or values of DAS keys listed in keys of the link,
+// e.g. "keys":["lineage.kind", "lineage.name"]
+func linkValues(rec mongo.DASRecord, val string, link mongo.DASRecord) []interface{} {
+	keys, ok := link["keys"].([]interface{})
+	if !ok {
+		return []interface{}{val}
+	}
+	var out []interface{}
+	for _, key := range keys {
+		attr := fmt.Sprintf("%v", key)
+		if idx := strings.Index(attr, "."); idx >= 0 {
+			attr = attr[idx+1:]
+		}
+		out = append(out, ExtractValue(rec, attr))
+	}
+	return out
+}
+
+// helper function to create links, rec is the record of primary key value
+func dasLinks(path, inst, val string, rec mongo.DASRecord, links []interface{}) string {
 	var out []string
 	for _, row := range links {
-		rec := row.(mongo.DASRecord)
-		name := rec["name"].(string)
+		link := row.(mongo.DASRecord)
+		name := link["name"].(string)
 		if strings.Contains(name, "%s") {
 			name = fmt.Sprintf(name, val)
 		}
-		if v, ok := rec["query"]; ok {
+		vals := linkValues(rec, val, link)
+		if v, ok := link["query"]; ok {
 			q := v.(string)
 			if q != "" {
-				query := fmt.Sprintf(q, val)
+				query := fmt.Sprintf(q, vals...)
 				link := fmt.Sprintf("<a href=\"%s?instance=%s&input=%s\">%s</a>", path, inst, url.QueryEscape(query), name)
 				out = append(out, link)
 			}
 		}
-		if v, ok := rec["url"]; ok {
+		if v, ok := link["url"]; ok {
 			q := v.(string)
 			if q != "" {
-				qurl := fmt.Sprintf(q, val)
+				qurl := fmt.Sprintf(q, vals...)
 				link := fmt.Sprintf("<a href=\"%s\">%s</a>", qurl, name)
 				out = append(out, link)
 			}
@@ -160,6 +232,35 @@ func dasLinks(path, inst, val string, links []interface{}) string {
 	return "<br/>" + strings.Join(out, ", ")
 }
 
+// helper function to show data-service source of sub-record, identical
+// sub-records of other services are marked as duplicates
+func colSource(src services.Source) string {
+	ts := time.Unix(src.Ts, 0).Format("2006-01-02 15:04:05")
+	msg := fmt.Sprintf("URL: %s fetched: %s", html.EscapeString(src.Url), ts)
+	if src.Duplicate {
+		msg = fmt.Sprintf("Identical sub-record is provided by %s, %s", src.Service, msg)
+	}
+	return msg
+}
+
+// helper function to show data-services which provided fields of DAS record
+func colFieldSources(das mongo.DASRecord) string {
+	fsources := services.FieldSources(das)
+	var keys []string
+	for key := range fsources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var out []string
+	for _, key := range keys {
+		out = append(out, fmt.Sprintf("%s: %s", key, strings.Join(fsources[key], ", ")))
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Field sources:\n<pre>%s</pre>", strings.Join(out, "\n"))
+}
+
 // helper function to show|hide DAS record on web UI
 func showRecord(data mongo.DASRecord) string {
 	var out []string
@@ -174,6 +275,10 @@ func showRecord(data mongo.DASRecord) string {
 	}
 	das := data["das"].(mongo.DASRecord)
 	pkey := strings.Split(das["primary_key"].(string), ".")[0]
+	sources := services.Provenance(das)
+	if fields := colFieldSources(das); fields != "" {
+		out = append(out, fields)
+	}
 	for i, v := range das["services"].([]interface{}) {
 		srv := v.(string)
 		arr := strings.Split(srv, ":")
@@ -182,6 +287,11 @@ func showRecord(data mongo.DASRecord) string {
 		bkg, col := genColor(system)
 		srvval := fmt.Sprintf("<span style=\"background-color:%s;color:%s;padding:2px\">%s</span>", bkg, col, system)
 		out = append(out, fmt.Sprintf("DAS service: %v DAS api: %s", srvval, dasapi))
+		for _, src := range sources {
+			if src.Key == pkey && src.Index == i && (src.Duplicate || src.Service == srv) {
+				out = append(out, colSource(src))
+			}
+		}
 		var rec mongo.DASRecord
 		if data[pkey] != nil {
 			switch r := data[pkey].(type) {
@@ -211,9 +321,24 @@ func showRecord(data mongo.DASRecord) string {
 	return wrap + val
 }
 
-// helper function to provide proper url
-func makeUrl(url, urlType string, startIdx, limit, nres int) string {
-	var out string
+// helper function to provide proper url, pages are referred by their cursors
+// when they are known and by index otherwise
+func makeUrl(url, urlType string, page das.Page, dasquery dasql.DASQuery, limit, nres int) string {
+	var cursor string
+	switch urlType {
+	case "prev":
+		cursor = page.Prev
+	case "next":
+		cursor = page.Next
+	case "last":
+		if limit > 0 && nres > limit {
+			cursor = das.LastCursor(dasquery, nres, limit)
+		}
+	}
+	if cursor != "" {
+		return fmt.Sprintf("%s&cursor=%s&limit=%d", url, cursor, limit)
+	}
+	startIdx := page.Index
 	var idx int
 	if urlType == "first" {
 		idx = 0
@@ -235,14 +360,14 @@ func makeUrl(url, urlType string, startIdx, limit, nres int) string {
 		}
 		idx = j
 	}
-	out = fmt.Sprintf("%s&idx=%d&limit=%d", url, idx, limit)
-	return out
+	return fmt.Sprintf("%s&idx=%d&limit=%d", url, idx, limit)
 }
 
 // helper function to provide pagination
-func pagination(base, query, inst string, nres, startIdx, limit int) string {
+func pagination(base string, dasquery dasql.DASQuery, nres int, page das.Page, limit int) string {
 	var templates DASTemplates
-	url := fmt.Sprintf("%s?input=%s&instance=%s", base, url.QueryEscape(query), inst)
+	url := fmt.Sprintf("%s?input=%s&instance=%s", base, url.QueryEscape(dasquery.Query), dasquery.Instance)
+	startIdx := page.Index
 	tmplData := make(map[string]interface{})
 	if nres > 0 {
 		tmplData["StartIndex"] = fmt.Sprintf("%d", startIdx+1)
@@ -255,13 +380,13 @@ func pagination(base, query, inst string, nres, startIdx, limit int) string {
 		tmplData["EndIndex"] = fmt.Sprintf("%d", nres)
 	}
 	tmplData["Total"] = fmt.Sprintf("%d", nres)
-	tmplData["FirstUrl"] = makeUrl(url, "first", startIdx, limit, nres)
-	tmplData["PrevUrl"] = makeUrl(url, "prev", startIdx, limit, nres)
-	tmplData["NextUrl"] = makeUrl(url, "next", startIdx, limit, nres)
-	tmplData["LastUrl"] = makeUrl(url, "last", startIdx, limit, nres)
-	page := templates.Pagination(config.Config.Templates, tmplData)
+	tmplData["FirstUrl"] = makeUrl(url, "first", page, dasquery, limit, nres)
+	tmplData["PrevUrl"] = makeUrl(url, "prev", page, dasquery, limit, nres)
+	tmplData["NextUrl"] = makeUrl(url, "next", page, dasquery, limit, nres)
+	tmplData["LastUrl"] = makeUrl(url, "last", page, dasquery, limit, nres)
+	html := templates.Pagination(config.Current().Templates, tmplData)
 	line := "<hr class=\"line\" />"
-	return fmt.Sprintf("%s%s<br/>", page, line)
+	return fmt.Sprintf("%s%s<br/>", html, line)
 }
 
 // helper function to
@@ -401,7 +526,7 @@ func parseDBSError(dbsErr mongo.DASRecord) string {
 }
 
 // PresentData represents DAS records for web UI
-func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, pmap mongo.DASRecord, nres, startIdx, limit int, procTime time.Duration) string {
+func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, pmap mongo.DASRecord, nres int, page das.Page, limit int, procTime time.Duration) string {
 	var out []string
 	line := "<hr class=\"line\" />"
 	red := "style=\"color:red\""
@@ -411,14 +536,14 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 	if len(dasquery.Aggregators) > 0 {
 		total = len(dasquery.Aggregators)
 	}
-	out = append(out, pagination(path, dasquery.Query, dasquery.Instance, total, startIdx, limit))
+	out = append(out, pagination(path, dasquery, total, page, limit))
 	patMsg := datasetPattern(dasquery.Query)
 	if patMsg != "" {
 		out = append(out, patMsg)
 	}
 	//     br := "<br/>"
 	fields := dasquery.Fields
-	var pkey, inst string
+	var pkey, inst, rowInstances string
 	var dasrec mongo.DASRecord
 	var services []string
 	for jdx, item := range data {
@@ -440,17 +565,21 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 			services = append(services, srv)
 		}
 		pkey = dasrec["primary_key"].(string)
-		inst = dasrec["instance"].(string)
+		// merged records of fan-out queries may come from several DBS instances,
+		// links are made against the first one
+		rowInstances, _ = dasrec["instance"].(string)
+		inst = strings.Split(rowInstances, ",")[0]
+		conflictKeys, conflicts := colConflicts(dasrec)
 		// aggregator part
 		if len(dasquery.Aggregators) > 0 {
 			fname := item["function"].(string)
 			fkey := item["key"].(string)
 			res := item["result"].(mongo.DASRecord)
 			var val string
-			if strings.Contains(fkey, "_size") {
-				val = fmt.Sprintf("%s(%s)=%v<br/>\n", fname, fkey, utils.SizeFormat(res["value"]))
+			if bins, ok := res["value"].([]utils.HistogramBin); ok {
+				val = fmt.Sprintf("%s(%s)<br/>\n%s", fname, fkey, histogramChart(fkey, bins))
 			} else {
-				val = fmt.Sprintf("%s(%s)=%v<br/>\n", fname, fkey, res["value"])
+				val = fmt.Sprintf("%s(%s)=%v<br/>\n", fname, fkey, aggregatorValue(fname, fkey, res["value"]))
 			}
 			out = append(out, val)
 			out = append(out, colServices(services))
@@ -463,6 +592,7 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 		// record part
 		var links []interface{}
 		var pval string
+		var prec mongo.DASRecord
 		dtypes := make(map[string]string)
 		var values []string
 		for _, key := range fields {
@@ -541,7 +671,7 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 							if cname, ok := rmap[cid]; ok {
 								name = cname
 							}
-							furl := config.Config.Frontend
+							furl := config.Current().Frontend
 							v := fmt.Sprintf("<a href=\"%s/couchdb/reqmgr_config_cache/%s/configFile\">%s</a>", furl, cid, name)
 							vals = append(vals, v)
 						}
@@ -549,6 +679,7 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 					}
 					if pval == "" {
 						pval = value
+						prec = rec
 					}
 					if pkey == "dataset.name" {
 						dtypes[pval] = ExtractValue(rec, "datatype")
@@ -585,6 +716,9 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 							value = fmt.Sprintf("<b><span %s>%s</span></b>", color, value)
 							webkey = tooltip(webkey)
 						}
+						if conflictKeys[daskey] {
+							value = fmt.Sprintf("<b><span %s>%s</span></b>", red, value)
+						}
 						if daskey == pkey {
 							row = fmt.Sprintf("%s: %v\n<br/>\n", webkey, href(path, pkey, value, inst, dasquery.Query))
 						} else {
@@ -613,12 +747,12 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 		if len(values) == 1 {
 			values[0] = strings.Replace(values[0], "<br/>", "", 1)
 		}
-		out = append(out, strings.Join(utils.List2Set(values), " "))
+		out = append(out, strings.Join(utils.List2Set(values), " ")+conflicts)
 		// add lumis/events pairs for queries which contains events
 		if utils.InList("events", fields) {
 			out = append(out, lumiEvents(item))
 		}
-		out = append(out, dasLinks(path, inst, pval, links))
+		out = append(out, dasLinks(path, inst, pval, prec, links))
 		if pkey == "dataset.name" {
 			arr := strings.Split(pval, "/")
 			if len(arr) > 1 {
@@ -633,13 +767,16 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 				}
 			}
 		}
+		if len(dasquery.Instances) > 1 {
+			out = append(out, colInstances(rowInstances))
+		}
 		out = append(out, colServices(services))
 		out = append(out, showRecord(item))
 		if jdx != len(data) {
 			out = append(out, line)
 		}
 	}
-	out = append(out, pagination(path, dasquery.Query, dasquery.Instance, total, startIdx, limit))
+	out = append(out, pagination(path, dasquery, total, page, limit))
 	if procTime.Seconds() == 0 { // look-up processing time if it is not provided
 		ts := das.TimeStamp(dasquery)
 		procTime = time.Now().Sub(time.Unix(ts, 0))
@@ -648,6 +785,46 @@ func PresentData(path string, dasquery dasql.DASQuery, data []mongo.DASRecord, p
 	return strings.Join(out, "\n")
 }
 
+// helper function to check if given DAS key represents size attribute
+func isSizeKey(key string) bool {
+	return strings.HasSuffix(key, "size") || strings.HasSuffix(key, "bytes")
+}
+
+// helper function to format aggregator value, count-like aggregators are
+// not formatted since they do not carry units of DAS key
+func aggregatorValue(fname, fkey string, value interface{}) interface{} {
+	if fname == "count" || fname == "count_distinct" || !isSizeKey(fkey) {
+		return value
+	}
+	return utils.SizeFormat(value)
+}
+
+// helper function to represent histogram aggregator as simple bar chart
+func histogramChart(fkey string, bins []utils.HistogramBin) string {
+	var maxCount int
+	for _, b := range bins {
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+	var rows []string
+	for _, b := range bins {
+		low := fmt.Sprintf("%v", b.Low)
+		high := fmt.Sprintf("%v", b.High)
+		if isSizeKey(fkey) {
+			low = utils.SizeFormat(int64(b.Low))
+			high = utils.SizeFormat(int64(b.High))
+		}
+		width := 0
+		if maxCount > 0 {
+			width = 100 * b.Count / maxCount
+		}
+		row := fmt.Sprintf("<tr><td class=\"histogram-range\">%s &#8212; %s</td><td class=\"histogram-bar\"><div style=\"width:%d%%\">&nbsp;</div></td><td>%d</td></tr>", low, high, width, b.Count)
+		rows = append(rows, row)
+	}
+	return fmt.Sprintf("<table class=\"histogram\">%s</table>\n", strings.Join(rows, "\n"))
+}
+
 // helper function to sort ui rows to have persistent view on DAS web page for ui names
 func sortUiRows(uiRows []interface{}, pkey string) []interface{} {
 	var out []interface{}
@@ -769,3 +946,77 @@ func tooltip(key string) string {
 	}
 	return page
 }
+
+// helper function to write consistency report records in CSV format, every
+// block is described by summary row followed by one row per issue
+func writeConsistencyCSV(w io.Writer, records []mongo.DASRecord) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"block", "issue", "file", "dbs", "rucio"})
+	for _, rec := range records {
+		blk := fmt.Sprintf("%v", rec["name"])
+		writer.Write([]string{blk, fmt.Sprintf("%v", rec["status"]), "", fmt.Sprintf("%v", rec["nfiles_dbs"]), fmt.Sprintf("%v", rec["nfiles_rucio"])})
+		for _, issue := range []string{"missing_in_rucio", "missing_in_dbs", "invalid_in_dbs"} {
+			files, _ := rec[issue].([]string)
+			for _, fname := range files {
+				writer.Write([]string{blk, issue, fname, "", ""})
+			}
+		}
+		for _, issue := range []string{"size_mismatch", "checksum_mismatch"} {
+			items, _ := rec[issue].([]mongo.DASRecord)
+			for _, r := range items {
+				writer.Write([]string{blk, issue, fmt.Sprintf("%v", r["file"]), fmt.Sprintf("%v", r["dbs"]), fmt.Sprintf("%v", r["rucio"])})
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// helper function to create notice about stale DAS records which are shown
+// while DAS query is refreshed
+func staleNotice(dasquery dasql.DASQuery, age int64) string {
+	rurl := fmt.Sprintf("%s/request?input=%s&instance=%s&refresh=1", config.Current().Base, url.QueryEscape(dasquery.Query), dasquery.Instance)
+	return fmt.Sprintf("<div style=\"background-color:#ffe4b5;padding:5px;\">These results are stale, they were fetched %v ago and are refreshed in background, <a href=\"%s\">refresh now</a></div>", time.Duration(age)*time.Second, rurl)
+}
+
+// helper function to summarise state of DAS query and outcome of its API
+// calls, failed and skipped calls are listed with their errors
+func stateSummary(state string, calls []das.ServiceStatus) string {
+	counts := make(map[string]int)
+	var failed []string
+	for _, call := range calls {
+		counts[call.Status] += 1
+		if call.Status == "ok" || call.Status == "empty" {
+			continue
+		}
+		msg := fmt.Sprintf("%s %s", call.Service, call.Status)
+		if call.Instance != "" {
+			msg = fmt.Sprintf("%s (%s) %s", call.Service, call.Instance, call.Status)
+		}
+		if call.Latency > 0 {
+			msg = fmt.Sprintf("%s after %.1fs", msg, call.Latency)
+		}
+		if call.Error != "" {
+			msg = fmt.Sprintf("%s: %s", msg, html.EscapeString(call.Error))
+		}
+		failed = append(failed, msg)
+	}
+	var summary []string
+	for _, status := range []string{"ok", "empty", "error", "timeout", "skipped"} {
+		if counts[status] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	color := "#e0ffe0"
+	switch state {
+	case "partial", "skipped":
+		color = "#ffe4b5"
+	case "failed":
+		color = "#ffd0d0"
+	}
+	out := fmt.Sprintf("<div style=\"background-color:%s;padding:5px;\">Query is <b>%s</b>, API calls: %s", color, state, strings.Join(summary, ", "))
+	if len(failed) > 0 {
+		out += "<br/>" + strings.Join(failed, "<br/>")
+	}
+	return out + "</div>"
+}
@@ -0,0 +1,226 @@
+package web
+
+// das2go - DAS cache warming scheduler
+//
+// Copyright (c) 2015-2017 - Valentin Kuznetsov <vkuznet AT gmail dot com>
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmwm/das2go/config"
+	"github.com/dmwm/das2go/das"
+	"github.com/dmwm/das2go/dasql"
+	"github.com/dmwm/das2go/utils"
+)
+
+// QueryStats represents request statistics of DAS query
+type QueryStats struct {
+	Query       string `json:"query"`        // DAS query
+	Instance    string `json:"instance"`     // DBS instance of the query
+	Pid         string `json:"pid"`          // DAS query hash
+	Hits        int    `json:"hits"`         // number of recent requests, it decays over time
+	LastHit     int64  `json:"last_hit"`     // time of last request
+	Refreshes   int    `json:"refreshes"`    // number of refreshes made by scheduler
+	LastRefresh int64  `json:"last_refresh"` // time of last refresh
+}
+
+// request statistics of DAS queries
+var _queryStats = struct {
+	sync.Mutex
+	stats   map[string]*QueryStats
+	decayed int64
+}{stats: make(map[string]*QueryStats)}
+
+// interval in seconds after which hits of queries are halved
+var warmDecayInterval int64 = 3600
+
+// helper function to record request of given DAS query
+func recordQuery(dasquery dasql.DASQuery) {
+	_queryStats.Lock()
+	defer _queryStats.Unlock()
+	stats, ok := _queryStats.stats[dasquery.Qhash]
+	if !ok {
+		stats = &QueryStats{Query: dasquery.Query, Instance: dasquery.Instance, Pid: dasquery.Qhash}
+		_queryStats.stats[dasquery.Qhash] = stats
+	}
+	stats.Hits += 1
+	stats.LastHit = time.Now().Unix()
+}
+
+// helper function to halve hits of all queries once per decay interval, it
+// removes queries which are no longer requested
+func decayQueryStats() {
+	_queryStats.Lock()
+	defer _queryStats.Unlock()
+	now := time.Now().Unix()
+	if now-_queryStats.decayed < warmDecayInterval {
+		return
+	}
+	_queryStats.decayed = now
+	for pid, stats := range _queryStats.stats {
+		stats.Hits /= 2
+		if stats.Hits == 0 {
+			delete(_queryStats.stats, pid)
+		}
+	}
+}
+
+// PopularQueries returns given number of queries with at least minHits
+// requests, queries are ordered by number of hits
+func PopularQueries(stats []QueryStats, top, minHits int) []QueryStats {
+	var out []QueryStats
+	for _, s := range stats {
+		if s.Hits >= minHits {
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Hits == out[j].Hits {
+			return out[i].LastHit > out[j].LastHit
+		}
+		return out[i].Hits > out[j].Hits
+	})
+	if top > 0 && len(out) > top {
+		out = out[:top]
+	}
+	return out
+}
+
+// QueryStatistics returns request statistics of DAS queries
+func QueryStatistics() []QueryStats {
+	_queryStats.Lock()
+	defer _queryStats.Unlock()
+	var out []QueryStats
+	for _, stats := range _queryStats.stats {
+		out = append(out, *stats)
+	}
+	return out
+}
+
+// helper function to record refresh of given DAS query
+func recordRefresh(pid string) {
+	_queryStats.Lock()
+	defer _queryStats.Unlock()
+	if stats, ok := _queryStats.stats[pid]; ok {
+		stats.Refreshes += 1
+		stats.LastRefresh = time.Now().Unix()
+	}
+}
+
+// helper function to return integer setting or its default value
+func intSetting(val, def int) int {
+	if val > 0 {
+		return val
+	}
+	return def
+}
+
+// helper function to return list of DAS queries to keep warm, configured
+// queries go first and are followed by popular ones
+func warmQueries() []dasql.DASQuery {
+	dmaps := currentMaps()
+	var out []dasql.DASQuery
+	pids := make(map[string]bool)
+	inst := dmaps.DBSInstance()
+	if inst == "" && len(config.Current().DbsInstances) > 0 { // case of dbs2go
+		inst = config.Current().DbsInstances[0]
+	}
+	for _, query := range config.Current().WarmQueries {
+		dasquery, qlerr, _ := dasql.Parse(query, inst, dmaps.DASKeys())
+		if qlerr != "" {
+			log.Printf("ERROR: unable to parse warm query %s, error %s\n", query, qlerr)
+			continue
+		}
+		if !pids[dasquery.Qhash] {
+			pids[dasquery.Qhash] = true
+			out = append(out, dasquery)
+		}
+	}
+	top := intSetting(config.Current().WarmTop, 20)
+	minHits := intSetting(config.Current().WarmMinHits, 5)
+	for _, stats := range PopularQueries(QueryStatistics(), top, minHits) {
+		if pids[stats.Pid] {
+			continue
+		}
+		dasquery, qlerr, _ := dasql.Parse(stats.Query, stats.Instance, dmaps.DASKeys())
+		if qlerr != "" {
+			continue
+		}
+		pids[dasquery.Qhash] = true
+		out = append(out, dasquery)
+	}
+	return out
+}
+
+// helper function to check if upstream services are busy with user requests
+func upstreamBusy() bool {
+	limit := utils.UrlQueueLimit
+	return limit > 0 && atomic.LoadInt32(&utils.UrlQueueSize) > limit/2
+}
+
+// helper function to refresh queries which are about to expire, number of
+// refreshes per scheduler run is limited by warmBudget
+func warmCache() {
+	decayQueryStats()
+	if upstreamBusy() {
+		log.Println("cache warming is skipped, upstream queue size", atomic.LoadInt32(&utils.UrlQueueSize))
+		return
+	}
+	lead := int64(intSetting(config.Current().WarmLead, 120))
+	budget := intSetting(config.Current().WarmBudget, 5)
+	now := time.Now().Unix()
+	var due []dasql.DASQuery
+	for _, dasquery := range warmQueries() {
+		pid := dasquery.Qhash
+		if das.Refreshing(pid) || (das.CheckData(pid) && !das.CheckDataReadiness(pid)) {
+			continue // query is processing
+		}
+		if expire := das.Expire(pid); expire == 0 || expire-now <= lead {
+			due = append(due, dasquery)
+		}
+		if len(due) == budget {
+			break
+		}
+	}
+	var wg sync.WaitGroup
+	dmaps := *currentMaps()
+	for _, dasquery := range due {
+		wg.Add(1)
+		go func(dasquery dasql.DASQuery) {
+			defer wg.Done()
+			defer func() {
+				if err := recover(); err != nil {
+					log.Printf("ERROR: cache warming %s, error %v\n", dasquery, err)
+				}
+			}()
+			pid := dasquery.Qhash
+			das.RemoveExpired(pid)
+			if das.CheckDataReadiness(pid) {
+				das.Refresh(dasquery, dmaps)
+			} else {
+				das.Process(dasquery, dmaps)
+			}
+			recordRefresh(pid)
+			log.Printf("cache warming %s pid=%s", dasquery, pid)
+		}(dasquery)
+	}
+	wg.Wait()
+}
+
+// helper function to run cache warming scheduler, it is disabled when
+// warmInterval is not set
+func warmScheduler() {
+	for {
+		interval := config.Current().WarmInterval
+		if interval <= 0 {
+			time.Sleep(time.Minute) // check again if scheduler was enabled by reload
+			continue
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+		warmCache()
+	}
+}